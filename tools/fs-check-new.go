@@ -1,43 +1,121 @@
 package main
 
 import (
+	"context"
+	_ "embed"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/xml"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"maps"
 	"net"
+	"net/http"
 	"net/url"
 	"os"
 	"regexp"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
 	"unicode/utf8"
 
 	"github.com/miekg/dns"
+	"golang.org/x/net/idna"
+	"golang.org/x/text/unicode/norm"
+	"gopkg.in/yaml.v3"
 )
 
 // fs-check: sanity checker for _for-sale DNS TXT records
 //
 // Usage: fs-check domain.tld
+//        fs-check -record 'v=FORSALE1;fval=EUR5' [domain.tld]
 //
 // Flags:
 //   -json                output machine-readable JSON; JSON output includes full values
+//   -format f            output format: text (default), json, ndjson, yaml, csv, tap, junit,
+//                        sarif or markdown; json, ndjson and yaml follow
+//                        schema/fs-check-new.schema.json (see schema_version)
+//   -fcod-store file     fcod code store (as written by fs-generate) used to interpret fcod values
+//   -fcod-base64 list    comma-separated fcod prefixes whose payload is shown Base64-decoded
+//   -brands file         protected names (one per line) that furi hosts must not be confusable with
+//   -confusables file    UTS #39 confusables.txt to extend the built-in look-alike table
+//   -sanitize policy     also show ftxt/furi values sanitised for display: "space" or "fffd"
+//                        (replacement character); raw values are always shown
+//   -rdap-bootstrap file IANA RDAP bootstrap file (dns.json); enables RDAP lookups of
+//                        registrar/abuse contacts when the content is absent or invalid
+//   -whois               fall back to port-43 WHOIS when RDAP is unavailable or fails
+//   -whois-server host   WHOIS server to use instead of the one whois.iana.org refers to
+//   -registry-status     look up the registry status (needs -rdap-bootstrap or -whois) and
+//                        flag domains in redemption or pendingDelete, where offers are likely void
+//   -unreliable mode     "flag" (default) or "skip" such domains
+//   -psl file            Public Suffix List; classifies the name as public suffix, registrable
+//                        domain or subdomain and adds the placement note of the draft
+//   -special-use file    IANA special-use domain names registry extending the built-in list;
+//                        such names (.arpa, .onion, .alt, .local, ...) are reported out of
+//                        scope before any DNS query is sent
+//   -record rdata        check a record offline, without DNS: raw RDATA ('v=FORSALE1;fval=EUR5'),
+//                        quoted character-strings or a full RR ("_for-sale 3600 IN TXT ...",
+//                        owners relative to the domain);
+//                        repeatable, "-" reads lines from stdin (only one flag may read stdin)
+//   -zone-snippet file   check the _for-sale TXT records in a zone file fragment offline ("-" for stdin);
+//                        the domain argument, if given, is the origin
+//   -ttl seconds         TTL of offline records that have none (default 3600)
+//   -compare file        query the resolvers in file (one per line: [name] address[:port]) in
+//                        parallel instead of /etc/resolv.conf, show where their rcodes, RRsets
+//                        and TTLs differ, and analyse the majority answer
+//   -batch file          check the domains in file (one per line, - for stdin); with -json,
+//                        one JSON document per domain
+//   -doctor              after the check, probe the resolver for common mistakes: the version tag
+//                        at the apex or in the SPF type, misspelt labels (_forsale, _for_sale, the
+//                        origin twice), a CNAME, SPF-style or other-type records at _for-sale,
+//                        names or a wildcard below it; every finding comes with the exact fix
+//   -explain             without records, exit with the code of the negative answer (4 to 9)
+//                        instead of 2, or 3 when the lookup failed, like fs-check -explain
 //
 // Behavior:
 //   - queries resolver(s) from /etc/resolv.conf using EDNS0 with larger UDP buffer
 //     and falls back to TCP if the UDP reply is truncated.
+//   - unpacks the character-strings from the wire-format RDATA of the response
+//     and reports the responding server, transport, rcode, AD/TC flags, EDNS UDP
+//     size, NSID, response size and RTT.
+//   - without TXT records, tells NXDOMAIN of _for-sale from NXDOMAIN of the domain itself,
+//     NODATA, SERVFAIL (repeated with CD set to detect DNSSEC failures, with any extended
+//     DNS errors) and timeouts, with the negative TTL from the SOA record (RFC 2308)
 //   - validates TXT RRs at _for-sale.<domain> according to draft-davids-forsalereg-19,
 //     including UTF-8 / control-character checks derived from the draft's
 //     recommendation about encoding and Unicode subsets.
-//   - decodes presentation escapes (e.g., \240\159\142\133) into raw bytes before parsing
-//   - prints human-readable diagnostics or JSON (when -json is set)
+//   - flags bidirectional controls, zero-width characters, mixed-script host labels
+//     and hosts confusable with protected names (draft security considerations)
+//   - decodes presentation escapes (e.g., \240\159\142\133) into raw bytes for offline records
+//   - prints human-readable diagnostics or one of the -format outputs
 //   - output is sorted: VALID, INVALID, IGNORED (both human and JSON modes)
 //
 // Exit codes:
 //   0 : at least one valid _for-sale TXT record found (with or without warnings)
-//   2 : TXT records found but none considered valid (all invalid/ignored)
-//   3 : usage error or DNS/network error
+//   2 : no TXT records found, or none considered valid (all invalid/ignored)
+//   3 : usage error or DNS/network error (SERVFAIL, timeout, another rcode such as REFUSED)
+//  10 : out of scope: a special-use domain name (.arpa, .onion, ...), no query sent
+//   With -explain, a lookup without records exits with the class of the negative answer:
+//   3 : another rcode such as REFUSED
+//   4 : _for-sale.<domain> does not exist (NXDOMAIN), the domain does
+//   5 : _for-sale.<domain> exists without TXT records (NODATA)
+//   6 : the domain itself does not exist (NXDOMAIN)
+//   7 : SERVFAIL
+//   8 : SERVFAIL because DNSSEC validation failed (the query with CD set is answered,
+//       or an extended DNS error says so)
+//   9 : no resolver answered in time
+//   With -batch: 3 if any domain could not be checked (3, 7, 8 or 9), else 0 if any domain
+//   has a valid record, else 2. Domains skipped by -unreliable skip and domains out of
+//   scope count as 2.
 
 const (
 	versionTag     = "v=FORSALE1;"
@@ -52,40 +130,379 @@ var (
 
 // recordResult holds diagnostics for one TXT RR. `Rr` is omitted from JSON.
 type recordResult struct {
-	Rr                     dns.RR   `json:"-"`
-	Content                string   `json:"content"`                       // decoded concatenated character-strings (full)
-	RawTxts                []string `json:"raw_txts"`                      // raw presentation strings from the RR
-	RawDecodedLens         []int    `json:"raw_decoded_lens,omitempty"`    // decoded octet length per raw part
-	TTL                    uint32   `json:"ttl"`
-	RawCount               int      `json:"raw_count"`                     // number of character-strings as seen in the RR
-	FitsSingleCharstring   bool     `json:"fits_single_charstring"`        // true if concatenation fits in single char-string <=255
-	Valid                  bool     `json:"valid"`
-	Ignored                bool     `json:"ignored"`
-	Tag                    string   `json:"tag,omitempty"`
-	TagValue               string   `json:"tag_value,omitempty"`
-	Messages               []string `json:"messages,omitempty"`
-	ConcatenatedLength     int      `json:"concatenated_length"` // bytes
+	Rr                   dns.RR          `json:"-"`
+	Content              string          `json:"content"`                    // decoded concatenated character-strings (full)
+	RawTxts              []string        `json:"raw_txts"`                   // raw presentation strings from the RR
+	RawDecodedLens       []int           `json:"raw_decoded_lens,omitempty"` // decoded octet length per raw part
+	TTL                  uint32          `json:"ttl"`
+	RawCount             int             `json:"raw_count"`              // number of character-strings as seen in the RR
+	FitsSingleCharstring bool            `json:"fits_single_charstring"` // true if concatenation fits in single char-string <=255
+	Valid                bool            `json:"valid"`
+	Ignored              bool            `json:"ignored"`
+	Tag                  string          `json:"tag,omitempty"`
+	TagValue             string          `json:"tag_value,omitempty"`
+	SanitizedValue       string          `json:"sanitized_value,omitempty"` // display-safe TagValue (with -sanitize, ftxt/furi only)
+	Messages             []string        `json:"messages,omitempty"`
+	Findings             []recordFinding `json:"-"`                     // Messages with their severity and rule
+	ConcatenatedLength   int             `json:"concatenated_length"`   // bytes
+	WireRDATA            string          `json:"wire_rdata,omitempty"`  // hex RDATA as received; the octets analysed for DNS answers
+	FcodAction           *FcodAction     `json:"fcod_action,omitempty"` // set when a registered FcodHandler recognised the fcod value
+}
+
+// recordFinding is one message of the validator with its severity ("error",
+// "warning" or "note") and the rule it comes from, such as "ttl",
+// "version-tag", "furi" or "security", so that callers need not parse the
+// message text. fs-lint reports them as they are.
+type recordFinding struct {
+	Severity string
+	Rule     string
+	Message  string
+}
+
+// add records a finding and its message for display.
+func (res *recordResult) add(severity, rule, msg string) {
+	res.Findings = append(res.Findings, recordFinding{severity, rule, msg})
+	switch {
+	case rule == "security":
+		msg = "Warning (security): " + msg
+	case severity == "warning":
+		msg = "Warning: " + msg
+	}
+	res.Messages = append(res.Messages, msg)
+}
+
+// FcodAction is a handler's interpretation of an fcod value.
+type FcodAction struct {
+	Handler     string `json:"handler"`                // prefix of the handler that recognised the value
+	Description string `json:"description"`            // human-readable meaning
+	LandingPage string `json:"landing_page,omitempty"` // sales page, if any; never followed automatically
+}
+
+// FcodHandler interprets the fcod values of one party (registry, registrar
+// or marketplace). Values are matched on the prefix before the first "-",
+// e.g. "EXCO" for "EXCO-S2lscm95IHdhcyBoZXJl", as in the draft's examples.
+type FcodHandler interface {
+	Prefix() string
+	Interpret(value string) (FcodAction, error)
+}
+
+// fcodHandlers holds the registered handlers by prefix.
+var fcodHandlers = map[string]FcodHandler{}
+
+// registerFcodHandler adds h to the registry. A prefix can have only one
+// handler.
+func registerFcodHandler(h FcodHandler) error {
+	if _, dup := fcodHandlers[h.Prefix()]; dup {
+		return fmt.Errorf("fcod prefix %q has more than one handler", h.Prefix())
+	}
+	fcodHandlers[h.Prefix()] = h
+	return nil
+}
+
+// interpretFcod runs the handler registered for value's prefix. ok is false
+// if no handler recognises the prefix.
+func interpretFcod(value string) (action FcodAction, ok bool, err error) {
+	prefix, _, found := strings.Cut(value, "-")
+	if !found {
+		return FcodAction{}, false, nil
+	}
+	h := fcodHandlers[prefix]
+	if h == nil {
+		return FcodAction{}, false, nil
+	}
+	action, err = h.Interpret(value)
+	return action, true, err
+}
+
+// fcodEntry is one code in the fcod store written by fs-generate.
+type fcodEntry struct {
+	Code   string `json:"code"`
+	Prefix string `json:"prefix"`
+	URL    string `json:"url"`
+}
+
+// storeFcodHandler resolves codes minted by fs-generate through the fcod store.
+type storeFcodHandler struct {
+	prefix string
+	codes  map[string]fcodEntry
+}
+
+func (h storeFcodHandler) Prefix() string { return h.prefix }
+
+func (h storeFcodHandler) Interpret(value string) (FcodAction, error) {
+	e, ok := h.codes[value]
+	if !ok {
+		return FcodAction{}, fmt.Errorf("code %q is not in the %s registry", value, h.prefix)
+	}
+	return FcodAction{Handler: h.prefix, Description: "registered sales landing page", LandingPage: e.URL}, nil
+}
+
+// base64FcodHandler shows the decoded payload of Base64 codes.
+type base64FcodHandler struct {
+	prefix string
+}
+
+func (h base64FcodHandler) Prefix() string { return h.prefix }
+
+func (h base64FcodHandler) Interpret(value string) (FcodAction, error) {
+	payload := strings.TrimPrefix(value, h.prefix+"-")
+	// standard Base64 with padding, as in the draft's examples
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return FcodAction{}, fmt.Errorf("payload is not Base64: %w", err)
+	}
+	if !utf8.Valid(data) {
+		return FcodAction{Handler: h.prefix, Description: fmt.Sprintf("%d octets of binary data", len(data))}, nil
+	}
+	return FcodAction{Handler: h.prefix, Description: fmt.Sprintf("payload %q", data)}, nil
+}
+
+// registerStoreFcodHandlers registers a store-backed handler for every prefix
+// found in the fcod store at path.
+func registerStoreFcodHandlers(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var entries []fcodEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	byPrefix := map[string]map[string]fcodEntry{}
+	for _, e := range entries {
+		if byPrefix[e.Prefix] == nil {
+			byPrefix[e.Prefix] = map[string]fcodEntry{}
+		}
+		byPrefix[e.Prefix][e.Code] = e
+	}
+	for prefix, codes := range byPrefix {
+		if err := registerFcodHandler(storeFcodHandler{prefix: prefix, codes: codes}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// annotateFcod adds the interpretation of a registered handler to a valid
+// fcod record.
+func annotateFcod(res *recordResult) {
+	if res.Tag != "fcod" || !res.Valid {
+		return
+	}
+	action, ok, err := interpretFcod(res.TagValue)
+	if !ok {
+		return
+	}
+	if err != nil {
+		res.add("warning", "fcod", fmt.Sprintf("fcod prefix is handled by a registered handler, but the value was not understood: %v", err))
+		return
+	}
+	res.FcodAction = &action
+	msg := fmt.Sprintf("fcod recognised by %s handler: %s", action.Handler, action.Description)
+	if action.LandingPage != "" {
+		msg += fmt.Sprintf(", landing page %s (do NOT follow without user confirmation)", action.LandingPage)
+	}
+	res.add("note", "fcod", msg)
 }
 
 type jsonOutput struct {
-	Query        string         `json:"query"`
-	Records      []recordResult `json:"records"`
-	TTLCounts    map[uint32]int `json:"ttl_counts,omitempty"`
-	Summary      string         `json:"summary"`
-	ValidCount   int            `json:"valid_count"`
-	IgnoredCount int            `json:"ignored_count"`
-	InvalidCount int            `json:"invalid_count"`
+	SchemaVersion     string            `json:"schema_version"` // see schemaVersion
+	Query             string            `json:"query"`
+	Records           []recordResult    `json:"records"`
+	TTLCounts         map[uint32]int    `json:"ttl_counts,omitempty"`
+	Summary           string            `json:"summary"`
+	ValidCount        int               `json:"valid_count"`
+	IgnoredCount      int               `json:"ignored_count"`
+	InvalidCount      int               `json:"invalid_count"`
+	Registration      *registrationInfo `json:"registration,omitempty"` // contacts via RDAP/WHOIS when content is absent or invalid
+	RegistrationError string            `json:"registration_error,omitempty"`
+	RegistryWarning   string            `json:"registry_warning,omitempty"` // set when the domain is in redemption or pendingDelete
+	Skipped           bool              `json:"skipped,omitempty"`          // with -unreliable skip
+	Placement         *placement        `json:"placement,omitempty"`        // with -psl
+	OutOfScope        string            `json:"out_of_scope,omitempty"`     // special-use domain name; no query sent
+	Response          *responseInfo     `json:"response,omitempty"`         // the DNS response; absent offline
+	Comparison        *comparison       `json:"comparison,omitempty"`       // with -compare
+	Negative          *negativeAnswer   `json:"negative,omitempty"`         // why there are no records: NXDOMAIN, NODATA, SERVFAIL or timeout
+	Doctor            *doctorReport     `json:"doctor,omitempty"`           // with -doctor
+	Error             string            `json:"error,omitempty"`            // the check failed, e.g. the DNS query
 }
 
+// schemaVersion is the version of the JSON output, described by
+// schema/fs-check-new.schema.json. The major version changes when fields are
+// removed, renamed or change meaning; the minor version when fields are added.
+const schemaVersion = "1.0"
+
 func main() {
 	flag.Usage = func() {
 		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] domain\n", os.Args[0])
 		fmt.Fprintf(flag.CommandLine.Output(), "Example: %s example.com\n", os.Args[0])
 		flag.PrintDefaults()
 	}
-	jsonOutFlag := flag.Bool("json", false, "output machine-readable JSON (includes full values)")
+	jsonOutFlag := flag.Bool("json", false, "output machine-readable JSON (includes full values); same as -format json")
+	formatFlag := flag.String("format", "text", "output format: text, json, ndjson, yaml, csv, tap, junit, sarif or markdown")
+	fcodStore := flag.String("fcod-store", "", "fcod code store (as written by fs-generate) used to interpret fcod values")
+	fcodBase64 := flag.String("fcod-base64", "", "comma-separated fcod prefixes whose payload is shown Base64-decoded")
+	brandsFile := flag.String("brands", "", "file with protected names (one per line) that furi hosts must not be confusable with")
+	confusablesFile := flag.String("confusables", "", "UTS #39 confusables.txt extending the built-in look-alike table")
+	sanitizeFlag := flag.String("sanitize", "", "also show ftxt/furi values sanitised for display: space or fffd")
+	rdapBootstrapFile := flag.String("rdap-bootstrap", "", "IANA RDAP bootstrap file (dns.json) used to look up contacts when the content is absent or invalid")
+	flag.BoolVar(&whoisFallback, "whois", false, "fall back to port-43 WHOIS when RDAP is unavailable or fails")
+	flag.StringVar(&whoisServer, "whois-server", "", "WHOIS server to use instead of the one whois.iana.org refers to")
+	registryStatus := flag.Bool("registry-status", false, "look up the registry status via RDAP/WHOIS and flag domains in redemption or pendingDelete")
+	unreliable := flag.String("unreliable", "flag", "what to do with domains in redemption or pendingDelete: flag or skip")
+	specialUseFile := flag.String("special-use", "", "IANA special-use domain names registry (CSV or one name per line) extending the built-in list")
+	pslFile := flag.String("psl", "", "Public Suffix List file, to classify the name as public suffix, registrable domain or subdomain")
+	var records stringList
+	flag.Var(&records, "record", "check this TXT record offline instead of querying DNS (raw RDATA, quoted strings or a full RR; repeatable, - reads lines from stdin)")
+	zoneSnippet := flag.String("zone-snippet", "", "check the _for-sale TXT records in this zone file fragment offline (- for stdin)")
+	offlineTTL := flag.Uint("ttl", 3600, "TTL assumed for offline records that do not have one")
+	compareFile := flag.String("compare", "", "query the resolvers in this file (one per line: [name] address[:port]) in parallel and compare their answers")
+	batchFile := flag.String("batch", "", "check the domains in this file, one per line (- for stdin), instead of a single domain")
+	explain := flag.Bool("explain", false, "without records, exit with the code of the negative answer (4 to 9) instead of 2, or 3 when the lookup failed")
+	doctorFlag := flag.Bool("doctor", false, "also probe for common mistakes (version tag at the apex, misspelt labels, CNAME or other types at _for-sale, names below it) and suggest fixes")
 	flag.Parse()
 
+	if *rdapBootstrapFile != "" {
+		if err := loadRDAPBootstrap(*rdapBootstrapFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load RDAP bootstrap file: %v\n", err)
+			os.Exit(3)
+		}
+	}
+
+	var policy sanitizePolicy
+	if *sanitizeFlag != "" {
+		p, err := parseSanitizePolicy(*sanitizeFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(3)
+		}
+		policy = p
+	}
+
+	if *confusablesFile != "" {
+		if err := loadConfusables(*confusablesFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load confusables: %v\n", err)
+			os.Exit(3)
+		}
+	}
+	if *brandsFile != "" {
+		if err := loadBrands(*brandsFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load protected names: %v\n", err)
+			os.Exit(3)
+		}
+	}
+
+	if *fcodStore != "" {
+		if err := registerStoreFcodHandlers(*fcodStore); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load fcod store: %v\n", err)
+			os.Exit(3)
+		}
+	}
+	if *fcodBase64 != "" {
+		for _, p := range strings.Split(*fcodBase64, ",") {
+			if err := registerFcodHandler(base64FcodHandler{prefix: strings.TrimSpace(p)}); err != nil {
+				fmt.Fprintf(os.Stderr, "Invalid -fcod-base64: %v\n", err)
+				os.Exit(3)
+			}
+		}
+	}
+
+	if *specialUseFile != "" {
+		if err := loadSpecialUseNames(*specialUseFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load special-use domain names: %v\n", err)
+			os.Exit(3)
+		}
+	}
+	if *pslFile != "" {
+		l, err := loadPublicSuffixList(*pslFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load Public Suffix List: %v\n", err)
+			os.Exit(3)
+		}
+		psl = l
+	}
+	if *registryStatus && rdapServices == nil && !whoisFallback {
+		fmt.Fprintln(os.Stderr, "Error: -registry-status needs -rdap-bootstrap or -whois.")
+		os.Exit(3)
+	}
+	if *unreliable != "flag" && *unreliable != "skip" {
+		fmt.Fprintln(os.Stderr, "Error: -unreliable must be flag or skip.")
+		os.Exit(3)
+	}
+	if *jsonOutFlag && *formatFlag == "text" {
+		*formatFlag = "json"
+	}
+	if _, ok := reportWriters[*formatFlag]; !ok && *formatFlag != "text" {
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q (want text, json, ndjson, yaml, csv, tap, junit, sarif or markdown)\n", *formatFlag)
+		os.Exit(3)
+	}
+	opts := checkOptions{
+		format:         *formatFlag,
+		sanitize:       *sanitizeFlag != "",
+		policy:         policy,
+		registryStatus: *registryStatus,
+		skipUnreliable: *unreliable == "skip",
+		doctor:         *doctorFlag,
+		explain:        *explain,
+	}
+
+	if *compareFile != "" {
+		list, err := loadResolvers(*compareFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load resolvers: %v\n", err)
+			os.Exit(3)
+		}
+		opts.compare = list
+	}
+
+	if len(records) > 0 || *zoneSnippet != "" {
+		// stdin can be read only once
+		stdin := 0
+		for _, f := range append(slices.Clone(records), *zoneSnippet, *batchFile) {
+			if f == "-" {
+				stdin++
+			}
+		}
+		if stdin > 1 {
+			fmt.Fprintln(os.Stderr, "Error: standard input (-) can be read only once; give one of -record, -zone-snippet or -batch as -.")
+			os.Exit(3)
+		}
+		if opts.doctor {
+			fmt.Fprintln(os.Stderr, "Error: -doctor probes DNS and cannot be used with -record or -zone-snippet.")
+			os.Exit(3)
+		}
+		if flag.NArg() > 1 {
+			flag.Usage()
+			os.Exit(3)
+		}
+		exit(checkOffline(strings.TrimSpace(flag.Arg(0)), records, *zoneSnippet, uint32(*offlineTTL), opts), opts)
+	}
+
+	if *batchFile != "" {
+		domains, err := readLines(*batchFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read batch file: %v\n", err)
+			os.Exit(3)
+		}
+		// 3 if any domain could not be checked (DNS errors, SERVFAIL, timeouts),
+		// else 0 if any is validly for sale
+		code := 2
+		for i, domain := range domains {
+			if i > 0 && opts.format == "text" {
+				fmt.Println(strings.Repeat("=", 72))
+			}
+			switch checkDomain(strings.TrimSpace(domain), opts) {
+			case 3, 7, 8, 9:
+				code = 3
+			case 0:
+				if code == 2 {
+					code = 0
+				}
+			}
+		}
+		exit(code, opts)
+	}
+
 	if flag.NArg() != 1 {
 		fmt.Fprintln(os.Stderr, "Error: missing domain argument.")
 		flag.Usage()
@@ -96,63 +513,456 @@ func main() {
 		fmt.Fprintln(os.Stderr, "Error: empty domain.")
 		os.Exit(3)
 	}
+	exit(checkDomain(domain, opts), opts)
+}
 
-	lower := strings.ToLower(strings.TrimSuffix(domain, "."))
-	if lower == "arpa" || strings.HasSuffix(lower, ".arpa") {
-		fmt.Printf("Domain %q is in the .arpa hierarchy - records under .arpa are out of scope and MUST be ignored per the draft.\n", domain)
-		os.Exit(0)
+// exit writes the collected reports in the machine-readable formats and
+// exits with code.
+func exit(code int, opts checkOptions) {
+	if write := reportWriters[opts.format]; write != nil {
+		if err := write(os.Stdout, reports, code); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write %s output: %v\n", opts.format, err)
+			os.Exit(3)
+		}
 	}
+	os.Exit(code)
+}
 
-	fqdn := dns.Fqdn("_for-sale." + domain) // trailing dot
+// stringList is a flag that can be given more than once.
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ", ") }
+func (l *stringList) Set(v string) error { *l = append(*l, v); return nil }
+
+// escapeTXT renders raw octets in the presentation form miekg/dns keeps in
+// TXT.Txt: '"' and '\' escaped, other non-printable octets as \DDD.
+func escapeTXT(b []byte) string {
+	var sb strings.Builder
+	for _, c := range b {
+		switch {
+		case c == '"' || c == '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case c < 0x20 || c > 0x7e:
+			fmt.Fprintf(&sb, "\\%03d", c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
 
-	conf, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+// parseZoneTXT returns the TXT RRs in zone-file text. RRs without a TTL get
+// ttl, relative names are completed with origin.
+func parseZoneTXT(r io.Reader, origin, file string, ttl uint32) ([]*dns.TXT, error) {
+	zp := dns.NewZoneParser(r, dns.Fqdn(origin), file)
+	zp.SetDefaultTTL(ttl)
+	var txts []*dns.TXT
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		if t, ok := rr.(*dns.TXT); ok {
+			txts = append(txts, t)
+		}
+	}
+	return txts, zp.Err()
+}
+
+var (
+	reOwnerField = regexp.MustCompile(`^(@|[A-Za-z0-9_*-]+(\.[A-Za-z0-9_-]+)*\.?)$`)
+	reTTLField   = regexp.MustCompile(`(?i)^[0-9]+([smhdw][0-9]*)*$`)
+	reClassField = regexp.MustCompile(`(?i)^(IN|CH|HS|CS|CLASS[0-9]+)$`)
+)
+
+// isTXTLine reports whether fields are a TXT RR in presentation format:
+// an owner name, an optional TTL and class, TXT and RDATA.
+func isTXTLine(fields []string) bool {
+	if len(fields) < 3 || !reOwnerField.MatchString(fields[0]) {
+		return false
+	}
+	for _, f := range fields[1:min(len(fields)-1, 4)] {
+		switch {
+		case strings.EqualFold(f, "TXT"):
+			return true
+		case !reTTLField.MatchString(f) && !reClassField.MatchString(f):
+			return false
+		}
+	}
+	return false
+}
+
+// parseRecordArg turns one -record value into a TXT RR at owner. It accepts
+// a complete RR in presentation format, one or more quoted
+// character-strings, or raw RDATA; raw RDATA is split into
+// character-strings of at most 255 octets, like a zone editor would.
+// A value is an RR only when it has an owner name and TXT in the type
+// position, so RDATA that mentions TXT stays RDATA. As in -zone-snippet,
+// relative owners and @ are relative to the domain. An RR at another name
+// than owner is an error, unless the domain is not known.
+func parseRecordArg(arg, owner string, ttl uint32) (*dns.TXT, error) {
+	line := strings.TrimSpace(arg)
+	isRR := isTXTLine(strings.Fields(line))
+	if strings.HasPrefix(line, `"`) {
+		line = owner + " TXT " + line
+		isRR = true
+	}
+	if isRR {
+		origin := strings.TrimPrefix(owner, "_for-sale.")
+		if origin == "" {
+			origin = "."
+		}
+		txts, err := parseZoneTXT(strings.NewReader(line), origin, "record", ttl)
+		if err != nil {
+			return nil, err
+		}
+		if len(txts) != 1 {
+			return nil, fmt.Errorf("not a TXT record: %s", arg)
+		}
+		if name := txts[0].Hdr.Name; owner != "_for-sale." && !strings.EqualFold(name, owner) {
+			return nil, fmt.Errorf("record is at %s, not at %s", name, owner)
+		}
+		return txts[0], nil
+	}
+
+	t := &dns.TXT{Hdr: dns.RR_Header{Name: dns.Fqdn(owner), Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: ttl}}
+	raw := []byte(arg)
+	for len(raw) > maxTxtStr {
+		t.Txt = append(t.Txt, escapeTXT(raw[:maxTxtStr]))
+		raw = raw[maxTxtStr:]
+	}
+	t.Txt = append(t.Txt, escapeTXT(raw))
+	return t, nil
+}
+
+// readLines returns the non-empty lines of path ("-" for stdin), skipping
+// comments starting with # or ;.
+func readLines(path string) ([]string, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to read /etc/resolv.conf: %v\n", err)
-		os.Exit(3)
+		return nil, err
 	}
-	if len(conf.Servers) == 0 {
-		fmt.Fprintf(os.Stderr, "No DNS servers configured in resolv.conf\n")
-		os.Exit(3)
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(string(data), "\r", ""), "\n") {
+		if t := strings.TrimSpace(line); t != "" && !strings.HasPrefix(t, "#") && !strings.HasPrefix(t, ";") {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// checkOffline validates records given with -record or -zone-snippet
+// instead of querying DNS, so records can be checked before they are
+// published. domain is the owner's parent, or "" when unknown.
+func checkOffline(domain string, records []string, snippet string, ttl uint32, opts checkOptions) int {
+	opts.offline = true
+	owner := "_for-sale."
+	if domain != "" {
+		owner = dns.Fqdn("_for-sale." + domain)
 	}
 
-	// Query using EDNS0 and TCP fallback when truncated (fixed default timeout)
-	var resp *dns.Msg
-	var lastErr error
-	for _, server := range conf.Servers {
-		serverAddr := server + ":" + conf.Port
-		r, err := queryTXTWithFallback(fqdn, serverAddr, defaultTimeout)
+	var txts []*dns.TXT
+	for _, rec := range records {
+		lines := []string{rec}
+		if rec == "-" {
+			var err error
+			if lines, err = readLines("-"); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to read records: %v\n", err)
+				return 3
+			}
+		}
+		for _, line := range lines {
+			t, err := parseRecordArg(line, owner, ttl)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Invalid record %q: %v\n", line, err)
+				return 3
+			}
+			txts = append(txts, t)
+		}
+	}
+	if snippet != "" {
+		var r io.Reader = os.Stdin
+		if snippet != "-" {
+			f, err := os.Open(snippet)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to read zone snippet: %v\n", err)
+				return 3
+			}
+			defer f.Close()
+			r = f
+		}
+		origin := domain
+		if origin == "" {
+			origin = "."
+		}
+		zt, err := parseZoneTXT(r, origin, snippet, ttl)
 		if err != nil {
-			lastErr = err
+			fmt.Fprintf(os.Stderr, "Failed to parse zone snippet: %v\n", err)
+			return 3
+		}
+		txts = append(txts, zt...)
+	}
+
+	// group into RRsets by owner; only _for-sale leaf names are relevant
+	rrsets := map[string][]*dns.TXT{}
+	for _, t := range txts {
+		name := strings.ToLower(t.Hdr.Name)
+		switch {
+		case strings.HasPrefix(name, "_for-sale."):
+			rrsets[name] = append(rrsets[name], t)
+		case strings.Contains(name, "._for-sale."):
+			w := os.Stdout
+			if opts.format != "text" {
+				w = os.Stderr // keep machine-readable output parseable
+			}
+			fmt.Fprintf(w, "Warning: %s is below _for-sale; the _for-sale label must be the leaf (non-conformant placement), record ignored\n", t.Hdr.Name)
+		}
+	}
+	if len(rrsets) == 0 {
+		if opts.format != "text" {
+			emitReport(jsonOutput{Query: owner, Records: []recordResult{}, Summary: "No _for-sale TXT records given"})
+		} else {
+			fmt.Println("No _for-sale TXT records given")
+		}
+		return 2
+	}
+
+	// out of scope only when every name is
+	code, inScope := 2, 0
+	for i, name := range slices.Sorted(maps.Keys(rrsets)) {
+		if i > 0 && opts.format == "text" {
+			fmt.Println(strings.Repeat("=", 72))
+		}
+		d := strings.TrimSuffix(strings.TrimPrefix(name, "_for-sale."), ".")
+		if su, ok := lookupSpecialUse(d); ok && d != "" {
+			if opts.format != "text" {
+				emitReport(jsonOutput{Query: name, Summary: "out of scope", OutOfScope: su.String()})
+			} else {
+				fmt.Printf("Domain %q is out of scope - %s\n", d, su)
+			}
 			continue
 		}
-		resp = r
-		break
+		inScope++
+		var place *placement
+		if psl != nil && d != "" {
+			p := psl.classifyPlacement(d)
+			place = &p
+		}
+		switch c := reportRRset(d, name, place, rrsets[name], nil, opts); {
+		case c == 3:
+			code = 3
+		case c == 0 && code == 2:
+			code = 0
+		}
 	}
-	if resp == nil {
-		fmt.Fprintf(os.Stderr, "DNS query failed: %v\n", lastErr)
-		os.Exit(3)
+	if inScope == 0 {
+		return exitOutOfScope
 	}
+	return code
+}
 
-	// collect TXT answers
-	var txtRRs []*dns.TXT
-	for _, a := range resp.Answer {
-		if t, ok := a.(*dns.TXT); ok {
-			txtRRs = append(txtRRs, t)
+// checkOptions are the settings that apply to every checked domain.
+type checkOptions struct {
+	format         string // "text" or one of reportWriters
+	sanitize       bool
+	policy         sanitizePolicy
+	registryStatus bool       // look up the registry status via RDAP/WHOIS
+	skipUnreliable bool       // skip, rather than flag, domains in redemption or pendingDelete
+	offline        bool       // records come from the command line; no network lookups
+	compare        []resolver // with -compare: query these resolvers instead of /etc/resolv.conf
+	doctor         bool       // probe for common mistakes after the check
+	explain        bool       // exit with the code of the negative answer
+}
+
+// checkDomain checks the _for-sale records of one domain, prints the
+// report and returns the exit code for it.
+func checkDomain(domain string, opts checkOptions) int {
+	// special-use names are out of scope; no query is sent for them
+	fqdn := dns.Fqdn("_for-sale." + domain) // trailing dot
+	if su, ok := lookupSpecialUse(domain); ok {
+		if opts.format != "text" {
+			emitReport(jsonOutput{Query: fqdn, Summary: "out of scope", OutOfScope: su.String()})
+		} else {
+			fmt.Printf("Domain %q is out of scope, no DNS query sent - %s\n", domain, su)
+		}
+		return exitOutOfScope
+	}
+
+	// the resolver that answered is the one -doctor probes, after the
+	// report of the check
+	var server string
+	if opts.doctor {
+		defer func() { doctor(domain, fqdn, server, opts) }()
+	}
+
+	// where the name sits relative to the registry boundaries (placement table)
+	var place *placement
+	if psl != nil {
+		p := psl.classifyPlacement(domain)
+		place = &p
+	}
+
+	var wire []byte
+	ans := &dnsAnswer{}
+	if len(opts.compare) > 0 {
+		// the answer of the majority is analysed, see compareResolvers
+		cmp, w, info, err := compareResolvers(fqdn, opts.compare)
+		if err != nil {
+			if isTimeout(err) {
+				return reportNegative(fqdn, place, nil, timeoutAnswer(err), opts)
+			}
+			return checkFailed(fqdn, err.Error(), opts)
+		}
+		wire, ans.info, ans.comparison = w, info, cmp
+	} else {
+		conf, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+		if err != nil {
+			return checkFailed(fqdn, fmt.Sprintf("Failed to read /etc/resolv.conf: %v", err), opts)
+		}
+		if len(conf.Servers) == 0 {
+			return checkFailed(fqdn, "No DNS servers configured in resolv.conf", opts)
+		}
+
+		// Query using EDNS0 and TCP fallback when truncated (fixed default timeout)
+		var lastErr error
+		for _, server := range conf.Servers {
+			serverAddr := net.JoinHostPort(server, conf.Port)
+			_, w, info, err := queryTXTWithFallback(fqdn, serverAddr, defaultTimeout)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			wire, ans.info = w, info
+			break
+		}
+		if wire == nil {
+			if isTimeout(lastErr) {
+				return reportNegative(fqdn, place, nil, timeoutAnswer(lastErr), opts)
+			}
+			return checkFailed(fqdn, fmt.Sprintf("DNS query failed: %v", lastErr), opts)
 		}
 	}
 
+	server = ans.info.Server
+
+	// collect TXT answers from the wire format, not from miekg/dns's
+	// presentation strings, so no octets are lost in escaping
+	var err error
+	ans.wire, err = unpackWireTXT(wire)
+	if err != nil {
+		return checkFailed(fqdn, fmt.Sprintf("Malformed DNS response from %s: %v", ans.info.Server, err), opts)
+	}
+	var txtRRs []*dns.TXT
+	for _, a := range ans.wire {
+		txtRRs = append(txtRRs, a.txt())
+	}
+
 	if len(txtRRs) == 0 {
-		fmt.Printf("No TXT records found at %s\n", fqdn)
-		os.Exit(2)
+		r := new(dns.Msg)
+		if err := r.Unpack(wire); err != nil {
+			return checkFailed(fqdn, fmt.Sprintf("Malformed DNS response from %s: %v", ans.info.Server, err), opts)
+		}
+		return reportNegative(fqdn, place, ans, classifyNegative(domain, r, ans.info.Server), opts)
+	}
+	return reportRRset(domain, fqdn, place, txtRRs, ans, opts)
+}
+
+// reportNegative reports that fqdn has no TXT records, or that it could not
+// be found out, and returns the exit code for it (see exitCode). ans is nil
+// when no resolver answered.
+func reportNegative(fqdn string, place *placement, ans *dnsAnswer, neg *negativeAnswer, opts checkOptions) int {
+	if ans == nil {
+		ans = &dnsAnswer{}
+	}
+	if opts.format != "text" {
+		out := jsonOutput{Query: fqdn, Summary: "No TXT records found: " + neg.Explanation, Placement: place, Response: ans.info, Comparison: ans.comparison, Negative: neg}
+		if neg.failed() {
+			out.Summary, out.Error = "check failed", neg.Explanation
+			fmt.Fprintln(os.Stderr, neg.Explanation)
+		}
+		emitReport(out)
+		return neg.exitCode(opts.explain)
+	}
+
+	if ans.comparison != nil {
+		printComparison(fqdn, ans.comparison)
+	}
+	if ans.info != nil {
+		fmt.Println(ans.info)
 	}
+	if neg.failed() {
+		fmt.Printf("Could not look up %s: %s\n", fqdn, neg.Explanation)
+	} else {
+		fmt.Printf("No TXT records found at %s: %s\n", fqdn, neg.Explanation)
+	}
+	if neg.Zone != "" {
+		fmt.Printf("Negative TTL: %d s (SOA of %s); resolvers may cache this answer that long\n", neg.NegativeTTL, neg.Zone)
+	}
+	for _, e := range neg.EDE {
+		fmt.Printf("Extended DNS error: %s\n", e)
+	}
+	return neg.exitCode(opts.explain)
+}
+
+// doctor runs -doctor for domain against server and adds the findings to
+// the report of fqdn.
+func doctor(domain, fqdn, server string, opts checkOptions) {
+	rep := &doctorReport{Error: "skipped, no resolver answered", Findings: []doctorFinding{}}
+	if server != "" {
+		rep = diagnose(domain, server)
+	}
+	if opts.format == "text" {
+		printDoctor(rep)
+		return
+	}
+	if n := len(reports); n > 0 && reports[n-1].Query == fqdn {
+		reports[n-1].Doctor = rep
+	}
+}
+
+// dnsAnswer is what a DNS lookup adds to the records: the same RRs as they
+// were on the wire, the response metadata and, with -compare, how the
+// resolvers compared. It is nil for offline records.
+type dnsAnswer struct {
+	wire       []wireTXT
+	info       *responseInfo
+	comparison *comparison
+}
+
+// checkFailed reports that the check of fqdn could not be done and returns
+// exit code 3. The message always goes to stderr.
+func checkFailed(fqdn, msg string, opts checkOptions) int {
+	fmt.Fprintln(os.Stderr, msg)
+	if opts.format != "text" {
+		emitReport(jsonOutput{Query: fqdn, Summary: "check failed", Error: msg})
+	}
+	return 3
+}
 
+// reportRRset analyses the TXT RRset found at fqdn, prints the report and
+// returns the exit code. The RRset comes from DNS, described by ans, or,
+// offline, from the records given on the command line (ans is nil).
+func reportRRset(domain, fqdn string, place *placement, txtRRs []*dns.TXT, ans *dnsAnswer, opts checkOptions) int {
 	results := make([]recordResult, 0, len(txtRRs))
 	ttls := make(map[uint32]int)
 	var anyValid bool
 
-	for _, t := range txtRRs {
-		res := analyzeTXT(t)
+	for i, t := range txtRRs {
+		var res recordResult
+		if ans != nil {
+			res = analyzeWireTXT(t, ans.wire[i].Strings)
+			res.WireRDATA = hex.EncodeToString(ans.wire[i].RDATA)
+		} else {
+			res = analyzeTXT(t)
+		}
 		res.Rr = t
+		annotateFcod(&res)
+		if opts.sanitize && (res.Tag == "ftxt" || res.Tag == "furi") {
+			res.SanitizedValue = displaySafe(res.TagValue, opts.policy)
+		}
 		results = append(results, res)
 		if res.TTL > 0 {
 			ttls[res.TTL]++
@@ -180,12 +990,46 @@ func main() {
 	sorted = append(sorted, invalids...)
 	sorted = append(sorted, ignored...)
 
-	// JSON mode: emit structured output including full values (no truncation)
-	if *jsonOutFlag {
+	// The draft leaves contact details to RDAP/WHOIS when the version tag is
+	// present but no record carries valid content. The same lookup gives the
+	// registry status, during which the records may be void.
+	absent := contentAbsentOrInvalid(results)
+	versioned := len(valids)+len(invalids) > 0
+	var registration *registrationInfo
+	var registrationErr error
+	if !opts.offline && (rdapServices != nil || whoisFallback) && (absent || opts.registryStatus && versioned) {
+		// registries only know registrable domains
+		regDomain := domain
+		if place != nil && place.RegistrableDomain != "" {
+			regDomain = place.RegistrableDomain
+		}
+		registration, registrationErr = lookupRegistration(context.Background(), regDomain)
+	}
+	var registryWarning string
+	if opts.registryStatus && registration != nil {
+		if st := unreliableRegistryStatus(registration.Status); st != "" {
+			registryWarning = fmt.Sprintf("record present but domain in %s - offer likely void", st)
+		}
+	}
+	if registryWarning != "" && opts.skipUnreliable {
+		if opts.format != "text" {
+			emitReport(jsonOutput{Query: fqdn, Summary: "skipped", Skipped: true, RegistryWarning: registryWarning, Registration: registration})
+		} else {
+			fmt.Printf("Skipped %s: %s\n", domain, registryWarning)
+		}
+		return 2
+	}
+
+	// machine-readable formats: structured output including full values (no truncation)
+	if opts.format != "text" {
 		out := jsonOutput{
 			Query:     fqdn,
 			Records:   sorted,
 			TTLCounts: ttls,
+			Placement: place,
+		}
+		if ans != nil {
+			out.Response, out.Comparison = ans.info, ans.comparison
 		}
 		validCount := len(valids)
 		ignoredCount := len(ignored)
@@ -195,21 +1039,27 @@ func main() {
 		out.InvalidCount = invalidCount
 		out.Summary = fmt.Sprintf("%d record(s) total: %d valid, %d ignored (no version), %d invalid",
 			len(sorted), validCount, ignoredCount, invalidCount)
-
-		enc, err := json.MarshalIndent(out, "", "  ")
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to marshal JSON output: %v\n", err)
-			os.Exit(3)
+		out.Registration = registration
+		out.RegistryWarning = registryWarning
+		if registrationErr != nil {
+			out.RegistrationError = registrationErr.Error()
 		}
-		fmt.Println(string(enc))
+
+		emitReport(out)
 		// exit code based on validity
 		if anyValid {
-			os.Exit(0)
+			return 0
 		}
-		os.Exit(2)
+		return 2
 	}
 
 	// Human-readable output (always full content), sorted as requested
+	if ans != nil {
+		if ans.comparison != nil {
+			printComparison(fqdn, ans.comparison)
+		}
+		fmt.Println(ans.info)
+	}
 	fmt.Printf("Found %d TXT record(s) at %s\n\n", len(sorted), fqdn)
 	for i, r := range sorted {
 		fmt.Printf("Record #%d (TTL=%d, raw-strings=%d, concatenated-bytes=%d, fits_single_charstring=%v):\n",
@@ -228,132 +1078,2153 @@ func main() {
 				}
 			}
 		}
-		// show decoded content (always full)
-		if r.Content != "" {
-			fmt.Printf("  Decoded content (len=%d): %s\n", len(r.Content), r.Content)
-		} else {
-			fmt.Printf("  Decoded content: <empty>\n")
+		if r.WireRDATA != "" {
+			fmt.Printf("  Wire RDATA (%d octets): %s\n", len(r.WireRDATA)/2, r.WireRDATA)
+		}
+		// show decoded content (always full)
+		if r.Content != "" {
+			fmt.Printf("  Decoded content (len=%d): %s\n", len(r.Content), r.Content)
+		} else {
+			fmt.Printf("  Decoded content: <empty>\n")
+		}
+		if r.Ignored {
+			fmt.Printf("  Verdict: IGNORED (no valid version tag found)\n")
+		} else if r.Valid {
+			fmt.Printf("  Verdict: VALID\n")
+		} else {
+			fmt.Printf("  Verdict: INVALID\n")
+		}
+		if r.Tag != "" {
+			fmt.Printf("  Content tag: %s\n", r.Tag)
+			if r.TagValue != "" {
+				fmt.Printf("  Content value (len=%d): %s\n", len(r.TagValue), r.TagValue)
+				if r.SanitizedValue != "" {
+					fmt.Printf("  Content value (sanitised): %s\n", r.SanitizedValue)
+				}
+			}
+		} else {
+			fmt.Printf("  No content tag present (empty content after version tag)\n")
+		}
+		for _, m := range r.Messages {
+			fmt.Printf("  - %s\n", m)
+		}
+		fmt.Println()
+	}
+
+	// RRset TTL checks
+	if len(ttls) > 1 {
+		fmt.Printf("Warning: TXT RRset contains records with differing TTLs (RRset TTLs must be the same per RFC2181 Section 5.2). TTLs seen:\n")
+		// Print TTLs in deterministic order
+		keys := make([]int, 0, len(ttls))
+		for k := range ttls {
+			keys = append(keys, int(k))
+		}
+		sort.Ints(keys)
+		for _, ttl := range keys {
+			fmt.Printf("  TTL %d: %d record(s)\n", ttl, ttls[uint32(ttl)])
+		}
+	} else {
+		for ttl := range ttls {
+			if ttl > 3600 {
+				fmt.Printf("Warning: TTL=%d is greater than the recommended 3600s (1 hour). Long TTLs increase the risk of outdated sale information.\n", ttl)
+			}
+		}
+	}
+
+	// Summary & exit code
+	validCount := len(valids)
+	ignoredCount := len(ignored)
+	invalidCount := len(invalids)
+
+	fmt.Printf("\nSummary: %d record(s) total: %d valid, %d ignored (no version), %d invalid\n",
+		len(sorted), validCount, ignoredCount, invalidCount)
+	if place != nil {
+		fmt.Printf("Placement: %s\n", place.Note)
+	}
+
+	if registryWarning != "" {
+		fmt.Printf("\nWarning: %s (registry status via %s: %s)\n", registryWarning, strings.ToUpper(registration.Source), strings.Join(registration.Status, ", "))
+	}
+	if registrationErr != nil {
+		fmt.Printf("\nRegistration lookup failed: %v\n", registrationErr)
+	} else if registration != nil && absent {
+		fmt.Printf("\nContent absent or invalid; contacts via %s (%s):\n", strings.ToUpper(registration.Source), registration.Server)
+		if len(registration.Contacts) == 0 {
+			fmt.Println("  (none published)")
+		}
+		for _, c := range registration.Contacts {
+			fmt.Printf("  %s:", c.Role)
+			for _, v := range []string{c.Name, c.Email, c.Phone, c.URL} {
+				if v != "" {
+					fmt.Printf(" %s", v)
+				}
+			}
+			fmt.Println()
+		}
+	}
+
+	if anyValid {
+		return 0
+	}
+	return 2
+}
+
+// reports collects the reports of all checked domains for the
+// machine-readable formats, which are written when the tool exits.
+var reports []jsonOutput
+
+func emitReport(out jsonOutput) {
+	out.SchemaVersion = schemaVersion
+	if out.Records == nil {
+		out.Records = []recordResult{}
+	}
+	reports = append(reports, out)
+}
+
+// reportWriters write the collected reports in each machine-readable format.
+// code is the exit code of the run, for the formats that report a verdict.
+var reportWriters = map[string]func(w io.Writer, reports []jsonOutput, code int) error{
+	"json":     writeJSON,
+	"ndjson":   writeNDJSON,
+	"yaml":     writeYAML,
+	"csv":      writeCSV,
+	"tap":      writeTAP,
+	"junit":    writeJUnit,
+	"sarif":    writeSARIF,
+	"markdown": writeMarkdown,
+}
+
+// verdict is the verdict on one record as used in the output formats.
+func (r recordResult) verdict() string {
+	switch {
+	case r.Ignored:
+		return "ignored"
+	case r.Valid:
+		return "valid"
+	}
+	return "invalid"
+}
+
+// writeJSON writes one indented JSON document per domain.
+func writeJSON(w io.Writer, reports []jsonOutput, _ int) error {
+	for _, out := range reports {
+		enc, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintln(w, string(enc)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeNDJSON writes one JSON document per domain per line.
+func writeNDJSON(w io.Writer, reports []jsonOutput, _ int) error {
+	enc := json.NewEncoder(w)
+	for _, out := range reports {
+		if err := enc.Encode(out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeYAML writes the JSON documents as a YAML stream, with the same keys
+// in the same order.
+func writeYAML(w io.Writer, reports []jsonOutput, _ int) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	for _, out := range reports {
+		data, err := json.Marshal(out)
+		if err != nil {
+			return err
+		}
+		var doc yaml.Node
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		blockStyle(&doc)
+		if err := enc.Encode(&doc); err != nil {
+			return err
+		}
+	}
+	return enc.Close()
+}
+
+// blockStyle drops the flow style and quoting the JSON input gave the
+// nodes, so they are written in the usual YAML block style.
+func blockStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		blockStyle(c)
+	}
+}
+
+// writeCSV writes one row per record, and one row without record fields for
+// domains that have none.
+func writeCSV(w io.Writer, reports []jsonOutput, _ int) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"query", "record", "verdict", "tag", "value", "ttl", "content", "messages"})
+	for _, out := range reports {
+		if len(out.Records) == 0 {
+			verdict, msg := "none", out.Summary
+			switch {
+			case out.Error != "":
+				verdict, msg = "error", out.Error
+			case out.OutOfScope != "":
+				verdict, msg = "out_of_scope", out.OutOfScope
+			case out.Skipped:
+				verdict, msg = "skipped", out.RegistryWarning
+			}
+			cw.Write([]string{out.Query, "", verdict, "", "", "", "", msg})
+			continue
+		}
+		for i, r := range out.Records {
+			cw.Write([]string{out.Query, strconv.Itoa(i + 1), r.verdict(), r.Tag, r.TagValue,
+				strconv.FormatUint(uint64(r.TTL), 10), r.Content, strings.Join(r.Messages, " | ")})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeTAP writes a Test Anything Protocol stream with one test per record,
+// and one per domain without records. Tests that do not pass (invalid and
+// ignored records, domains without records or out of scope) are "not ok"
+// only when the run fails, so the stream fails exactly when the exit code
+// is not 0: in a batch where another domain has a valid record they are
+// skipped instead. Failed checks are always "not ok", as they exit 3.
+func writeTAP(w io.Writer, reports []jsonOutput, code int) error {
+	var sb strings.Builder
+	n := 0
+	point := func(pass bool, desc, reason string) {
+		n++
+		switch {
+		case pass:
+			fmt.Fprintf(&sb, "ok %d - %s\n", n, desc)
+		case code != 0:
+			fmt.Fprintf(&sb, "not ok %d - %s\n", n, desc)
+		default:
+			fmt.Fprintf(&sb, "ok %d - %s # SKIP %s\n", n, desc, reason)
+		}
+	}
+	yamlBlock := func(key string, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+		fmt.Fprintf(&sb, "  ---\n  %s:\n", key)
+		for _, l := range lines {
+			fmt.Fprintf(&sb, "    - %s\n", strconv.Quote(l))
+		}
+		sb.WriteString("  ...\n")
+	}
+	for _, out := range reports {
+		switch {
+		case out.Error != "":
+			n++
+			fmt.Fprintf(&sb, "not ok %d - %s\n", n, out.Query)
+			yamlBlock("errors", []string{out.Error})
+		case len(out.Records) == 0:
+			reason := out.Summary
+			if out.OutOfScope != "" {
+				reason = "out of scope: " + out.OutOfScope
+			} else if out.Skipped {
+				reason = out.RegistryWarning
+			}
+			point(false, out.Query, reason)
+			if code != 0 {
+				yamlBlock("messages", []string{reason})
+			}
+		}
+		for i, r := range out.Records {
+			point(r.Valid, fmt.Sprintf("%s record %d: %s", out.Query, i+1, strings.TrimSpace(r.verdict()+" "+r.Tag)), r.verdict())
+			yamlBlock("messages", r.Messages)
+		}
+	}
+	_, err := fmt.Fprintf(w, "TAP version 14\n1..%d\n%s", n, sb.String())
+	return err
+}
+
+// writeJUnit writes JUnit XML with a test suite per domain and a test case
+// per record.
+func writeJUnit(w io.Writer, reports []jsonOutput, _ int) error {
+	type message struct {
+		Message string `xml:"message,attr"`
+		Text    string `xml:",chardata"`
+	}
+	type testcase struct {
+		Name      string   `xml:"name,attr"`
+		Classname string   `xml:"classname,attr"`
+		Failure   *message `xml:"failure,omitempty"`
+		Error     *message `xml:"error,omitempty"`
+		Skipped   *message `xml:"skipped,omitempty"`
+		SystemOut string   `xml:"system-out,omitempty"`
+	}
+	type testsuite struct {
+		Name      string     `xml:"name,attr"`
+		Tests     int        `xml:"tests,attr"`
+		Failures  int        `xml:"failures,attr"`
+		Errors    int        `xml:"errors,attr"`
+		Skipped   int        `xml:"skipped,attr"`
+		Testcases []testcase `xml:"testcase"`
+	}
+	type testsuites struct {
+		XMLName xml.Name    `xml:"testsuites"`
+		Name    string      `xml:"name,attr"`
+		Suites  []testsuite `xml:"testsuite"`
+	}
+
+	all := testsuites{Name: "fs-check-new"}
+	for _, out := range reports {
+		suite := testsuite{Name: out.Query}
+		switch {
+		case out.Error != "":
+			suite.Testcases = append(suite.Testcases, testcase{Name: "lookup", Classname: out.Query, Error: &message{Message: out.Error}})
+			suite.Errors++
+		case len(out.Records) == 0:
+			reason := out.Summary
+			if out.OutOfScope != "" {
+				reason = out.OutOfScope
+			} else if out.Skipped {
+				reason = out.RegistryWarning
+			}
+			suite.Testcases = append(suite.Testcases, testcase{Name: "records", Classname: out.Query, Skipped: &message{Message: reason}})
+			suite.Skipped++
+		}
+		for i, r := range out.Records {
+			tc := testcase{Name: fmt.Sprintf("record %d (%s)", i+1, r.Tag), Classname: out.Query}
+			if r.Tag == "" {
+				tc.Name = fmt.Sprintf("record %d", i+1)
+			}
+			if !r.Valid {
+				tc.Failure = &message{Message: r.verdict(), Text: strings.Join(r.Messages, "\n")}
+				suite.Failures++
+			} else {
+				tc.SystemOut = strings.Join(r.Messages, "\n")
+			}
+			suite.Testcases = append(suite.Testcases, tc)
+		}
+		suite.Tests = len(suite.Testcases)
+		all.Suites = append(all.Suites, suite)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(all); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// writeSARIF writes a SARIF 2.1.0 log with a result for every invalid or
+// ignored record, every warning on a valid record and every failed check.
+// Locations are logical: the queried name.
+func writeSARIF(w io.Writer, reports []jsonOutput, _ int) error {
+	type text struct {
+		Text string `json:"text"`
+	}
+	type logicalLocation struct {
+		FullyQualifiedName string `json:"fullyQualifiedName"`
+		Kind               string `json:"kind"`
+	}
+	type location struct {
+		LogicalLocations []logicalLocation `json:"logicalLocations"`
+	}
+	type result struct {
+		RuleID    string     `json:"ruleId"`
+		Level     string     `json:"level"`
+		Message   text       `json:"message"`
+		Locations []location `json:"locations"`
+	}
+	type rule struct {
+		ID               string `json:"id"`
+		ShortDescription text   `json:"shortDescription"`
+	}
+
+	rules := []rule{
+		{"forsale-invalid", text{"TXT record with the version tag but invalid content"}},
+		{"forsale-ignored", text{"TXT record without the version tag, ignored by processors"}},
+		{"forsale-warning", text{"valid TXT record that ignores a recommendation or security consideration of the draft"}},
+		{"check-failed", text{"the records could not be looked up"}},
+		{"doctor", text{"common mistake in publishing the records, found by -doctor"}},
+	}
+	results := []result{}
+	add := func(query, ruleID, level, msg string) {
+		loc := location{[]logicalLocation{{query, "resource"}}}
+		results = append(results, result{ruleID, level, text{msg}, []location{loc}})
+	}
+	for _, out := range reports {
+		if out.Error != "" {
+			add(out.Query, "check-failed", "error", out.Error)
+		}
+		if out.Doctor != nil {
+			for _, f := range out.Doctor.Findings {
+				msg := f.Problem
+				if len(f.Fix) > 0 {
+					msg += "\nFix:\n" + strings.Join(f.Fix, "\n")
+				}
+				add(f.Name, "doctor", f.Severity, msg)
+			}
+		}
+		for i, r := range out.Records {
+			switch {
+			case r.Ignored:
+				add(out.Query, "forsale-ignored", "warning", fmt.Sprintf("record %d: %s", i+1, strings.Join(r.Messages, " ")))
+			case !r.Valid:
+				add(out.Query, "forsale-invalid", "error", fmt.Sprintf("record %d: %s", i+1, strings.Join(r.Messages, " ")))
+			default:
+				for j, f := range r.Findings {
+					if f.Severity == "warning" {
+						add(out.Query, "forsale-warning", "warning", fmt.Sprintf("record %d: %s", i+1, r.Messages[j]))
+					}
+				}
+			}
+		}
+	}
+	log := map[string]any{
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"version": "2.1.0",
+		"runs": []any{map[string]any{
+			"tool": map[string]any{"driver": map[string]any{
+				"name":           "fs-check-new",
+				"informationUri": "https://github.com/mdavids/rfc",
+				"rules":          rules,
+			}},
+			"results": results,
+		}},
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(log)
+}
+
+// writeMarkdown writes a section with a table of the records per domain,
+// e.g. for a pull request comment or job summary.
+func writeMarkdown(w io.Writer, reports []jsonOutput, _ int) error {
+	cell := strings.NewReplacer("|", `\|`, "\n", " ", "\r", " ", "`", "\\`")
+	var sb strings.Builder
+	for i, out := range reports {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "### %s\n\n", cell.Replace(out.Query))
+		if cmp := out.Comparison; cmp != nil {
+			sb.WriteString("| Resolver | Server | Rcode | Variant | TTL | Status |\n|---|---|---|---|---|---|\n")
+			for _, ra := range cmp.Resolvers {
+				if ra.Status == "failed" {
+					fmt.Fprintf(&sb, "| %s | %s | | | | failed: %s |\n", cell.Replace(ra.Name), cell.Replace(ra.Server), cell.Replace(ra.Error))
+					continue
+				}
+				fmt.Fprintf(&sb, "| %s | %s | %s | %d | %d | %s |\n", cell.Replace(ra.Name), cell.Replace(ra.Server), ra.Rcode, ra.Variant, ra.TTLMax, ra.Status)
+			}
+			sb.WriteString("\n")
+		}
+		switch {
+		case out.Error != "":
+			fmt.Fprintf(&sb, "**Check failed:** %s\n", cell.Replace(out.Error))
+			writeMarkdownDoctor(&sb, out.Doctor)
+			continue
+		case out.OutOfScope != "":
+			fmt.Fprintf(&sb, "**Out of scope:** %s\n", cell.Replace(out.OutOfScope))
+			continue
+		case out.Skipped:
+			fmt.Fprintf(&sb, "**Skipped:** %s\n", cell.Replace(out.RegistryWarning))
+			continue
+		case len(out.Records) == 0:
+			fmt.Fprintf(&sb, "%s\n", cell.Replace(out.Summary))
+			writeMarkdownDoctor(&sb, out.Doctor)
+			continue
+		}
+		sb.WriteString("| # | Verdict | Tag | Value | TTL |\n|---|---|---|---|---|\n")
+		for j, r := range out.Records {
+			fmt.Fprintf(&sb, "| %d | %s | %s | %s | %d |\n", j+1, r.verdict(), r.Tag, cell.Replace(r.TagValue), r.TTL)
+		}
+		sb.WriteString("\n")
+		for j, r := range out.Records {
+			for _, m := range r.Messages {
+				fmt.Fprintf(&sb, "- Record %d: %s\n", j+1, cell.Replace(m))
+			}
+		}
+		fmt.Fprintf(&sb, "\n**Summary:** %s\n", out.Summary)
+		if out.Placement != nil {
+			fmt.Fprintf(&sb, "\n**Placement:** %s\n", cell.Replace(out.Placement.Note))
+		}
+		if out.RegistryWarning != "" {
+			fmt.Fprintf(&sb, "\n**Warning:** %s\n", cell.Replace(out.RegistryWarning))
+		}
+		writeMarkdownDoctor(&sb, out.Doctor)
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// writeMarkdownDoctor writes the -doctor findings, with the fixes as a diff.
+func writeMarkdownDoctor(sb *strings.Builder, rep *doctorReport) {
+	if rep == nil {
+		return
+	}
+	if rep.Error != "" {
+		fmt.Fprintf(sb, "\n**Doctor:** %s\n", rep.Error)
+		return
+	}
+	if len(rep.Findings) == 0 {
+		sb.WriteString("\n**Doctor:** no common mistakes found\n")
+		return
+	}
+	sb.WriteString("\n**Doctor:**\n")
+	for _, f := range rep.Findings {
+		fmt.Fprintf(sb, "\n- %s at `%s`: %s\n", f.Severity, f.Name, f.Problem)
+		if len(f.Fix) > 0 {
+			fmt.Fprintf(sb, "\n  ```diff\n  %s\n  ```\n", strings.Join(f.Fix, "\n  "))
+		}
+	}
+}
+
+// specialUse is a special-use domain name (RFC 6761). The draft puts these
+// out of scope, and records under .arpa MUST be ignored.
+type specialUse struct {
+	Name      string // without trailing dot, e.g. "onion"
+	Reference string // e.g. "RFC 7686"
+	Reason    string
+}
+
+// exitOutOfScope is the exit code for special-use domain names, the same
+// in fs-check, fs-check-new and fs-generate.
+const exitOutOfScope = 10
+
+// specialUseNames holds the special-use domain names by name: the built-in
+// list in special-use.csv, extended by the IANA registry loaded from disk.
+var specialUseNames = map[string]specialUse{}
+
+//go:embed special-use.csv
+var builtinSpecialUse string
+
+func init() {
+	addSpecialUseNames(builtinSpecialUse)
+}
+
+// loadSpecialUseNames adds the names from the IANA "Special-Use Domain
+// Names" registry, saved as CSV (special-use-domain.csv: Name,Reference) or
+// as plain text with one name per line.
+func loadSpecialUseNames(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	addSpecialUseNames(string(data))
+	return nil
+}
+
+// addSpecialUseNames adds the names in data, one per line as
+// Name[,Reference[,Reason]]. Names already known keep their entry.
+func addSpecialUseNames(data string) {
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), ",", 3)
+		name := strings.ToLower(strings.TrimSuffix(strings.Trim(fields[0], `"`), "."))
+		if name == "" || name == "name" || strings.HasPrefix(name, "#") {
+			continue
+		}
+		if _, ok := specialUseNames[name]; ok {
+			continue
+		}
+		su := specialUse{Name: name, Reason: "listed in the IANA Special-Use Domain Names registry"}
+		if len(fields) > 1 {
+			ref := strings.NewReplacer("[", "", "]", "", `"`, "").Replace(strings.TrimSpace(fields[1]))
+			if !strings.Contains(ref, "RFC ") {
+				ref = strings.Replace(ref, "RFC", "RFC ", 1)
+			}
+			su.Reference = ref
+		}
+		if len(fields) > 2 {
+			su.Reason = strings.TrimSpace(fields[2])
+		}
+		specialUseNames[name] = su
+	}
+}
+
+// lookupSpecialUse reports whether domain is, or is under, a special-use
+// domain name. The shortest match wins, so anything under .arpa is .arpa.
+func lookupSpecialUse(domain string) (specialUse, bool) {
+	labels := strings.Split(strings.ToLower(strings.TrimSuffix(domain, ".")), ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		if su, ok := specialUseNames[strings.Join(labels[i:], ".")]; ok {
+			return su, true
+		}
+	}
+	return specialUse{}, false
+}
+
+// String describes the name for the user.
+func (su specialUse) String() string {
+	if su.Name == "arpa" {
+		return "." + su.Name + ": " + su.Reason
+	}
+	ref := ""
+	if su.Reference != "" {
+		ref = " (" + su.Reference + ")"
+	}
+	return "." + su.Name + ref + ": " + su.Reason + "; the draft does not apply to special-use domain names"
+}
+
+// publicSuffixList holds the rules of the Public Suffix List
+// (https://publicsuffix.org/list/public_suffix_list.dat), loaded from disk,
+// with internationalised rules in Unicode as in the file.
+type publicSuffixList struct {
+	rules      map[string]bool // "co.uk"
+	wildcards  map[string]bool // "*.ck" stored as "ck"
+	exceptions map[string]bool // "!www.ck" stored as "www.ck"
+}
+
+// psl is nil when no list was loaded.
+var psl *publicSuffixList
+
+func loadPublicSuffixList(path string) (*publicSuffixList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	l := &publicSuffixList{rules: map[string]bool{}, wildcards: map[string]bool{}, exceptions: map[string]bool{}}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "//") {
+			continue
+		}
+		rule := strings.ToLower(fields[0])
+		switch {
+		case strings.HasPrefix(rule, "!"):
+			l.exceptions[rule[1:]] = true
+		case strings.HasPrefix(rule, "*."):
+			l.wildcards[rule[2:]] = true
+		default:
+			l.rules[rule] = true
+		}
+	}
+	if len(l.rules) == 0 {
+		return nil, fmt.Errorf("%s: no rules found", path)
+	}
+	return l, nil
+}
+
+// publicSuffix returns the public suffix of domain following the PSL
+// algorithm: exceptions win, then the longest matching rule; "*" is the
+// implicit default rule.
+func (l *publicSuffixList) publicSuffix(domain string) string {
+	labels := strings.Split(strings.ToLower(strings.TrimSuffix(domain, ".")), ".")
+	// the list is in Unicode; match A-labels in their Unicode form
+	ulabels := make([]string, len(labels))
+	for i, label := range labels {
+		ulabels[i] = label
+		if strings.HasPrefix(label, "xn--") {
+			if u, err := idna.Punycode.ToUnicode(label); err == nil {
+				ulabels[i] = u
+			}
+		}
+	}
+	for i := range labels {
+		name := strings.Join(ulabels[i:], ".")
+		if l.exceptions[name] {
+			return strings.Join(labels[i+1:], ".")
+		}
+		if l.rules[name] || i+1 < len(labels) && l.wildcards[strings.Join(ulabels[i+1:], ".")] {
+			return strings.Join(labels[i:], ".")
+		}
+	}
+	return labels[len(labels)-1]
+}
+
+// placement is where a _for-sale name sits relative to the registry
+// boundaries of the Public Suffix List, with the matching row of the
+// draft's placement table.
+type placement struct {
+	Class             string `json:"class"` // "public_suffix", "registrable" or "subdomain"
+	PublicSuffix      string `json:"public_suffix"`
+	RegistrableDomain string `json:"registrable_domain,omitempty"`
+	Note              string `json:"note"`
+}
+
+// classifyPlacement classifies domain, the name the _for-sale label is
+// placed under.
+func (l *publicSuffixList) classifyPlacement(domain string) placement {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	suffix := l.publicSuffix(domain)
+	p := placement{PublicSuffix: suffix}
+	switch {
+	case domain == suffix:
+		p.Class = "public_suffix"
+		p.Note = "the name is a public suffix, administered by a registry itself: for sale"
+	case strings.Count(domain, ".") == strings.Count(suffix, ".")+1:
+		p.Class = "registrable"
+		p.RegistrableDomain = domain
+		p.Note = "registrable domain with a public registry: for sale"
+	default:
+		p.Class = "subdomain"
+		labels := strings.Split(domain, ".")
+		p.RegistrableDomain = strings.Join(labels[len(labels)-strings.Count(suffix, ".")-2:], ".")
+		p.Note = "subdomain of " + p.RegistrableDomain + ", without a public registry to record the rights to it " +
+			"(draft placement note 1): not a violation, but the parties need their own agreement"
+	}
+	return p
+}
+
+// contentAbsentOrInvalid reports whether the version tag is present but no
+// record carries valid content.
+func contentAbsentOrInvalid(results []recordResult) bool {
+	versioned := false
+	for _, r := range results {
+		if r.Ignored {
+			continue
+		}
+		versioned = true
+		if r.Valid && r.Tag != "" {
+			return false
+		}
+	}
+	return versioned
+}
+
+// registrationInfo holds contact information from RDAP or WHOIS, shown when
+// the version tag is present but the content is absent or invalid, as the
+// draft suggests.
+type registrationInfo struct {
+	Source   string    `json:"source"` // "rdap" or "whois"
+	Server   string    `json:"server"`
+	Contacts []contact `json:"contacts,omitempty"`
+	Status   []string  `json:"status,omitempty"` // registry statuses, e.g. "active" or "pending delete"
+}
+
+// contact is one entity of the registration, e.g. the registrar or its abuse desk.
+type contact struct {
+	Role  string `json:"role"`
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email,omitempty"`
+	Phone string `json:"phone,omitempty"`
+	URL   string `json:"url,omitempty"`
+}
+
+const registrationTimeout = 10 * time.Second
+
+var (
+	// rdapServices maps domain suffixes (usually TLDs) to RDAP base URLs,
+	// from the IANA bootstrap file (RFC 9224); nil when RDAP is disabled.
+	rdapServices map[string][]string
+	// whoisFallback enables port-43 WHOIS when RDAP is unavailable or fails.
+	whoisFallback bool
+	// whoisServer overrides the WHOIS server found via whois.iana.org.
+	whoisServer string
+)
+
+// loadRDAPBootstrap reads an IANA RDAP bootstrap file for DNS, such as
+// https://data.iana.org/rdap/dns.json saved to disk.
+func loadRDAPBootstrap(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var bootstrap struct {
+		Services [][][]string `json:"services"`
+	}
+	if err := json.Unmarshal(data, &bootstrap); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	rdapServices = map[string][]string{}
+	for _, svc := range bootstrap.Services {
+		if len(svc) != 2 {
+			continue
+		}
+		for _, suffix := range svc[0] {
+			rdapServices[strings.ToLower(suffix)] = svc[1]
+		}
+	}
+	return nil
+}
+
+// rdapBaseURL returns the RDAP base URL for domain, using the longest
+// matching suffix in the bootstrap file and preferring HTTPS.
+func rdapBaseURL(domain string) string {
+	labels := strings.Split(strings.ToLower(strings.TrimSuffix(domain, ".")), ".")
+	for i := range labels {
+		urls := rdapServices[strings.Join(labels[i:], ".")]
+		if len(urls) == 0 {
+			continue
+		}
+		base := urls[0]
+		for _, u := range urls {
+			if strings.HasPrefix(u, "https://") {
+				base = u
+				break
+			}
+		}
+		if !strings.HasSuffix(base, "/") {
+			base += "/"
+		}
+		return base
+	}
+	return ""
+}
+
+// lookupRegistration finds the contacts of domain via RDAP and, if that is
+// not possible and the fallback is enabled, via WHOIS.
+func lookupRegistration(ctx context.Context, domain string) (*registrationInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, registrationTimeout)
+	defer cancel()
+	var rdapErr error
+	if rdapServices != nil {
+		info, err := lookupRDAP(ctx, domain)
+		if err == nil || !whoisFallback {
+			return info, err
+		}
+		rdapErr = err
+	}
+	if !whoisFallback {
+		return nil, errors.New("RDAP and WHOIS lookups are disabled")
+	}
+	info, err := lookupWHOIS(ctx, domain)
+	if err != nil && rdapErr != nil {
+		return nil, fmt.Errorf("RDAP: %v; WHOIS: %w", rdapErr, err)
+	}
+	return info, err
+}
+
+// rdapEntity is the part of an RDAP entity object (RFC 9083) used here.
+type rdapEntity struct {
+	Roles      []string          `json:"roles"`
+	VcardArray []json.RawMessage `json:"vcardArray"`
+	Entities   []rdapEntity      `json:"entities"`
+}
+
+func lookupRDAP(ctx context.Context, domain string) (*registrationInfo, error) {
+	base := rdapBaseURL(domain)
+	if base == "" {
+		return nil, fmt.Errorf("no RDAP service for %s in the bootstrap file", domain)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"domain/"+url.PathEscape(strings.TrimSuffix(domain, ".")), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/rdap+json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("RDAP server %s answered %s", req.URL.Host, resp.Status)
+	}
+	var obj struct {
+		Status   []string     `json:"status"`
+		Entities []rdapEntity `json:"entities"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&obj); err != nil {
+		return nil, fmt.Errorf("invalid RDAP response: %w", err)
+	}
+	info := &registrationInfo{Source: "rdap", Server: req.URL.Host, Status: obj.Status}
+	var walk func([]rdapEntity)
+	walk = func(entities []rdapEntity) {
+		for _, e := range entities {
+			c := vcardContact(e.VcardArray)
+			if c != (contact{}) {
+				for _, role := range e.Roles {
+					c.Role = role
+					info.Contacts = append(info.Contacts, c)
+				}
+			}
+			walk(e.Entities)
+		}
+	}
+	walk(obj.Entities)
+	return info, nil
+}
+
+// vcardContact extracts the name, e-mail, phone and URL from a jCard
+// (RFC 7095): ["vcard", [["fn", {}, "text", "Example Registrar"], ...]].
+func vcardContact(vcard []json.RawMessage) contact {
+	var c contact
+	if len(vcard) != 2 {
+		return c
+	}
+	var props [][]json.RawMessage
+	if err := json.Unmarshal(vcard[1], &props); err != nil {
+		return c
+	}
+	for _, p := range props {
+		if len(p) < 4 {
+			continue
+		}
+		var name, value string
+		if json.Unmarshal(p[0], &name) != nil || json.Unmarshal(p[3], &value) != nil || value == "" {
+			continue
+		}
+		switch name {
+		case "fn":
+			c.Name = value
+		case "email":
+			c.Email = value
+		case "tel":
+			if c.Phone == "" {
+				c.Phone = strings.TrimPrefix(value, "tel:")
+			}
+		case "url":
+			c.URL = value
+		}
+	}
+	return c
+}
+
+// whoisQuery sends query to a port-43 WHOIS server (RFC 3912).
+func whoisQuery(ctx context.Context, server, query string) (string, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "43")
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", server)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if _, err := io.WriteString(conn, query+"\r\n"); err != nil {
+		return "", err
+	}
+	data, err := io.ReadAll(io.LimitReader(conn, 1<<20))
+	return string(data), err
+}
+
+func lookupWHOIS(ctx context.Context, domain string) (*registrationInfo, error) {
+	domain = strings.TrimSuffix(domain, ".")
+	server := whoisServer
+	if server == "" {
+		// ask IANA which server serves the TLD
+		tld := domain[strings.LastIndex(domain, ".")+1:]
+		answer, err := whoisQuery(ctx, "whois.iana.org", tld)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(answer, "\n") {
+			key, value, ok := strings.Cut(line, ":")
+			if ok && (strings.EqualFold(strings.TrimSpace(key), "refer") || strings.EqualFold(strings.TrimSpace(key), "whois")) {
+				server = strings.TrimSpace(value)
+				break
+			}
+		}
+		if server == "" {
+			return nil, fmt.Errorf("no WHOIS server known for .%s", tld)
+		}
+	}
+	answer, err := whoisQuery(ctx, server, domain)
+	if err != nil {
+		return nil, err
+	}
+	contacts, status := parseWHOIS(answer)
+	return &registrationInfo{Source: "whois", Server: server, Contacts: contacts, Status: status}, nil
+}
+
+// parseWHOIS picks the registrar and abuse contacts and the domain statuses
+// from a WHOIS answer.
+// The format is not standardised; this understands the common gTLD keys
+// and the block style used by several ccTLDs, where the value follows on
+// indented lines:
+//
+//	Registrar:
+//	   Example Registrar B.V.
+func parseWHOIS(answer string) ([]contact, []string) {
+	var registrar, abuse contact
+	var status []string
+	registrar.Role, abuse.Role = "registrar", "abuse"
+	lines := strings.Split(strings.ReplaceAll(answer, "\r", ""), "\n")
+	for i, line := range lines {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+		if value == "" && i+1 < len(lines) && strings.HasPrefix(lines[i+1], " ") {
+			value = strings.TrimSpace(lines[i+1])
+		}
+		if value == "" {
+			continue
+		}
+		switch key {
+		case "registrar", "registrar name", "sponsoring registrar":
+			if registrar.Name == "" {
+				registrar.Name = value
+			}
+		case "registrar url", "referral url":
+			registrar.URL = value
+		case "registrar abuse contact email", "abuse email", "abuse-mailbox", "abuse contact":
+			abuse.Email = value
+		case "registrar abuse contact phone", "abuse phone":
+			abuse.Phone = value
+		case "domain status", "status":
+			status = append(status, value)
+		}
+	}
+	var contacts []contact
+	if registrar.Name != "" || registrar.URL != "" {
+		contacts = append(contacts, registrar)
+	}
+	if abuse.Email != "" || abuse.Phone != "" {
+		contacts = append(contacts, abuse)
+	}
+	return contacts, status
+}
+
+// unreliableStatuses are the registry statuses during which the draft's
+// Scope section says _for-sale records cannot be relied on, keyed by their
+// normalised RDAP (RFC 8056) or EPP form.
+var unreliableStatuses = map[string]string{
+	"pendingdelete":    "pendingDelete",
+	"redemptionperiod": "redemption",
+	"pendingrestore":   "pendingRestore",
+	// .nl calls its redemption period quarantine
+	"quarantine":   "redemption",
+	"inquarantine": "redemption",
+}
+
+// unreliableRegistryStatus returns the first status that makes the records
+// unreliable, e.g. "pendingDelete", or "".
+func unreliableRegistryStatus(statuses []string) string {
+	for _, st := range statuses {
+		// WHOIS appends a URL: "pendingDelete https://icann.org/epp#pendingDelete"
+		if f := strings.Fields(st); len(f) > 1 && strings.HasPrefix(f[len(f)-1], "http") {
+			st = strings.Join(f[:len(f)-1], " ")
+		}
+		key := strings.NewReplacer(" ", "", "_", "", "-", "").Replace(strings.ToLower(st))
+		if name, ok := unreliableStatuses[key]; ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// resolver is one of the resolvers compared with -compare.
+type resolver struct {
+	Name string
+	Addr string // host:port
+}
+
+// loadResolvers reads the -compare file: one resolver per line, as an
+// address with optional port (default 53), optionally preceded by a name,
+// e.g. "quad9 9.9.9.9" or "[2001:db8::53]:5353".
+func loadResolvers(path string) ([]resolver, error) {
+	lines, err := readLines(path)
+	if err != nil {
+		return nil, err
+	}
+	var list []resolver
+	for _, line := range lines {
+		f := strings.Fields(line)
+		var r resolver
+		switch len(f) {
+		case 1:
+			r.Addr = f[0]
+		case 2:
+			r.Name, r.Addr = f[0], f[1]
+		default:
+			return nil, fmt.Errorf("invalid line %q: want [name] address[:port]", line)
+		}
+		if _, _, err := net.SplitHostPort(r.Addr); err != nil {
+			r.Addr = net.JoinHostPort(strings.Trim(r.Addr, "[]"), "53")
+		}
+		if r.Name == "" {
+			r.Name = r.Addr
+		}
+		list = append(list, r)
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("no resolvers in %s", path)
+	}
+	return list, nil
+}
+
+// comparison is the outcome of -compare: the answer of every resolver, and
+// the distinct answers (variants) they gave.
+type comparison struct {
+	Consistent bool             `json:"consistent"`  // every resolver answered, with the same rcode, RRset and TTLs
+	TTLsDiffer bool             `json:"ttls_differ"` // see rank
+	Resolvers  []resolverAnswer `json:"resolvers"`
+	Variants   []answerVariant  `json:"variants"` // the first is the majority answer, which is analysed
+}
+
+// resolverAnswer is the answer of one resolver. Status is "consensus" (the
+// majority answer), "stale" (another RRset, cached before every copy of the
+// majority answer), "missing" (no records where the majority has them),
+// "extra" (records where the majority has none), "differs" (another RRset or
+// rcode) or "failed" (no answer).
+type resolverAnswer struct {
+	Name     string        `json:"name"`
+	Server   string        `json:"server"`
+	Status   string        `json:"status"`
+	Variant  int           `json:"variant,omitempty"` // 1-based index into variants; absent when failed
+	Rcode    string        `json:"rcode,omitempty"`
+	TTLMin   uint32        `json:"ttl_min,omitempty"` // remaining TTLs of the records in this resolver's cache
+	TTLMax   uint32        `json:"ttl_max,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Response *responseInfo `json:"response,omitempty"`
+}
+
+// answerVariant is one distinct answer: an rcode and RRset, compared on the
+// RDATA octets regardless of order and TTL.
+type answerVariant struct {
+	Rcode     string   `json:"rcode"`
+	Records   []string `json:"records"`   // decoded contents, sorted
+	Resolvers []string `json:"resolvers"` // names, as in the -compare file
+	Servers   []string `json:"servers"`   // addresses (host:port), which tell resolvers with the same name apart
+}
+
+// compareResolvers queries all resolvers in parallel and compares their
+// answers. It returns the comparison and the wire-format response and
+// metadata of the first resolver that gave the majority answer (ties go to
+// the variant of the resolver listed first). It fails only if no resolver
+// answered.
+func compareResolvers(fqdn string, resolvers []resolver) (*comparison, []byte, *responseInfo, error) {
+	type reply struct {
+		wire []byte
+		info *responseInfo
+		txts []wireTXT
+		err  error
+	}
+	replies := make([]reply, len(resolvers))
+	var wg sync.WaitGroup
+	for i, r := range resolvers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, wire, info, err := queryTXTWithFallback(fqdn, r.Addr, defaultTimeout)
+			if err == nil {
+				replies[i].txts, err = unpackWireTXT(wire)
+			}
+			replies[i].wire, replies[i].info, replies[i].err = wire, info, err
+		}()
+	}
+	wg.Wait()
+
+	cmp := &comparison{}
+	keys := map[string]int{} // variant key -> index into cmp.Variants
+	for i, r := range resolvers {
+		ra := resolverAnswer{Name: r.Name, Server: r.Addr}
+		rep := replies[i]
+		if rep.err != nil {
+			ra.Status, ra.Error = "failed", rep.err.Error()
+			cmp.Resolvers = append(cmp.Resolvers, ra)
+			continue
+		}
+		ra.Rcode, ra.Response = rep.info.Rcode, rep.info
+		records, octets := []string{}, []string{} // records is never null in JSON
+		for j, t := range rep.txts {
+			var content []byte
+			for _, s := range t.Strings {
+				content = append(content, s...)
+			}
+			records = append(records, string(content))
+			octets = append(octets, string(t.RDATA))
+			if j == 0 || t.TTL < ra.TTLMin {
+				ra.TTLMin = t.TTL
+			}
+			ra.TTLMax = max(ra.TTLMax, t.TTL)
+		}
+		sort.Strings(records)
+		sort.Strings(octets)
+		key := ra.Rcode + "\x00" + strings.Join(octets, "\x00")
+		v, ok := keys[key]
+		if !ok {
+			v = len(cmp.Variants)
+			keys[key] = v
+			cmp.Variants = append(cmp.Variants, answerVariant{Rcode: ra.Rcode, Records: records})
+		}
+		cmp.Variants[v].Resolvers = append(cmp.Variants[v].Resolvers, r.Name)
+		cmp.Variants[v].Servers = append(cmp.Variants[v].Servers, r.Addr)
+		ra.Variant = v + 1
+		cmp.Resolvers = append(cmp.Resolvers, ra)
+	}
+	if len(cmp.Variants) == 0 {
+		return nil, nil, nil, fmt.Errorf("DNS query failed at every resolver (%d): %w", len(resolvers), replies[0].err)
+	}
+
+	first := cmp.rank()
+	return cmp, replies[first].wire, replies[first].info, nil
+}
+
+// rank puts the majority answer first, sets the status of every resolver and
+// whether the answers are consistent, and returns the index of the first
+// resolver with the majority answer.
+//
+// Resolvers report the remaining TTL of what they cached, so a resolver
+// that fetched the records earlier shows a lower TTL. Another RRset with a
+// TTL below that of every copy of the majority answer was cached before all
+// of them, and is stale; one with a higher TTL may be the newer answer and
+// only "differs". Authoritative answers (AA) carry the TTL of the zone and
+// are never stale.
+//
+// The TTLs differ when records of one RRset have different TTLs, when
+// authoritative servers with the same answer give different TTLs, or when a
+// resolver holds the records longer than the authoritative TTL.
+func (cmp *comparison) rank() int {
+	// the majority answer goes first; stable, so ties keep the resolver order
+	order := make([]int, len(cmp.Variants))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return len(cmp.Variants[order[a]].Resolvers) > len(cmp.Variants[order[b]].Resolvers)
+	})
+	renumber := make([]int, len(order))
+	variants := make([]answerVariant, len(order))
+	for newIdx, oldIdx := range order {
+		renumber[oldIdx] = newIdx + 1
+		variants[newIdx] = cmp.Variants[oldIdx]
+	}
+	cmp.Variants = variants
+	for i := range cmp.Resolvers {
+		if ra := &cmp.Resolvers[i]; ra.Status != "failed" {
+			ra.Variant = renumber[ra.Variant-1]
+		}
+	}
+
+	// the TTLs of the majority answer in caches, and per variant at the
+	// authoritative servers
+	var majorityMin uint32
+	cached := false
+	authTTL := map[int][2]uint32{} // variant -> lowest and highest authoritative TTL
+	for _, ra := range cmp.Resolvers {
+		if ra.Status == "failed" || len(cmp.Variants[ra.Variant-1].Records) == 0 {
+			continue
+		}
+		if ra.TTLMin != ra.TTLMax {
+			cmp.TTLsDiffer = true
+		}
+		if ra.Response.AA {
+			if r, ok := authTTL[ra.Variant]; !ok {
+				authTTL[ra.Variant] = [2]uint32{ra.TTLMax, ra.TTLMax}
+			} else {
+				authTTL[ra.Variant] = [2]uint32{min(r[0], ra.TTLMax), max(r[1], ra.TTLMax)}
+			}
+			continue
+		}
+		if ra.Variant == 1 {
+			if !cached || ra.TTLMin < majorityMin {
+				majorityMin = ra.TTLMin
+			}
+			cached = true
+		}
+	}
+	for _, r := range authTTL {
+		if r[0] != r[1] {
+			cmp.TTLsDiffer = true
+		}
+	}
+
+	first := -1
+	majority := variants[0]
+	cmp.Consistent = len(variants) == 1
+	for i := range cmp.Resolvers {
+		ra := &cmp.Resolvers[i]
+		if ra.Status == "failed" {
+			cmp.Consistent = false
+			continue
+		}
+		v := variants[ra.Variant-1]
+		if r, ok := authTTL[ra.Variant]; ok && ra.TTLMax > r[1] {
+			cmp.TTLsDiffer = true
+		}
+		switch {
+		case ra.Variant == 1:
+			ra.Status = "consensus"
+			if first < 0 {
+				first = i
+			}
+		case len(majority.Records) > 0 && len(v.Records) == 0:
+			ra.Status = "missing"
+		case len(majority.Records) == 0 && len(v.Records) > 0:
+			ra.Status = "extra"
+		case cached && !ra.Response.AA && len(v.Records) > 0 && ra.TTLMax < majorityMin:
+			ra.Status = "stale"
+		default:
+			ra.Status = "differs"
+		}
+	}
+	if cmp.TTLsDiffer {
+		cmp.Consistent = false
+	}
+	return first
+}
+
+// printComparison prints the -compare section of the human-readable output.
+func printComparison(fqdn string, cmp *comparison) {
+	verdict := "consistent"
+	if !cmp.Consistent {
+		verdict = "INCONSISTENT"
+	}
+	fmt.Printf("Compared %d resolvers for %s: %s\n", len(cmp.Resolvers), fqdn, verdict)
+	nameWidth, serverWidth := 0, 0
+	for _, ra := range cmp.Resolvers {
+		nameWidth = max(nameWidth, len(ra.Name))
+		serverWidth = max(serverWidth, len(ra.Server))
+	}
+	for _, ra := range cmp.Resolvers {
+		fmt.Printf("  %-*s  %-*s  ", nameWidth, ra.Name, serverWidth, ra.Server)
+		if ra.Status == "failed" {
+			fmt.Printf("FAILED: %s\n", ra.Error)
+			continue
+		}
+		ttl := "-"
+		if ra.TTLMax > 0 {
+			ttl = fmt.Sprintf("%d", ra.TTLMin)
+			if ra.TTLMin != ra.TTLMax {
+				ttl += fmt.Sprintf("-%d", ra.TTLMax)
+			}
+		}
+		fmt.Printf("%-8s  variant %d  TTL %-9s  %.1f ms  %s", ra.Rcode, ra.Variant, ttl, ra.Response.RTTMillis, ra.Status)
+		switch ra.Status {
+		case "stale":
+			fmt.Printf(" - cached before every copy of variant 1; expires in %d s", ra.TTLMax)
+		case "missing", "differs", "extra":
+			// what a resolver has cached stays until its TTL runs out
+			if ra.TTLMax > 0 {
+				fmt.Printf(" - stale or not yet updated; cached for up to %d s", ra.TTLMax)
+			} else {
+				fmt.Printf(" - stale or not yet updated")
+			}
+		}
+		fmt.Println()
+	}
+	if len(cmp.Variants) > 1 {
+		fmt.Println("Variants:")
+		for i, v := range cmp.Variants {
+			fmt.Printf("  %d (%s): %s, %d record(s)\n", i+1, strings.Join(v.Servers, ", "), v.Rcode, len(v.Records))
+			for _, r := range v.Records {
+				fmt.Printf("      %q\n", r)
+			}
+		}
+	}
+	if cmp.TTLsDiffer {
+		fmt.Println("TTLs differ: records of one RRset, authoritative servers, or a cache and the authoritative TTL disagree.")
+	}
+	if len(cmp.Variants) > 1 {
+		fmt.Println("The records below are those of variant 1, the majority answer.")
+	}
+	fmt.Println()
+}
+
+// doctorReport is the outcome of -doctor: common mistakes in publishing the
+// records, each with the change that fixes it.
+type doctorReport struct {
+	Server   string          `json:"server,omitempty"` // the resolver probed
+	Probes   int             `json:"probes"`
+	Failed   int             `json:"failed,omitempty"` // probes without an answer
+	Findings []doctorFinding `json:"findings"`
+	Error    string          `json:"error,omitempty"` // no resolver to probe
+}
+
+// doctorFinding is one mistake. Fix holds zone file lines, prefixed "- " to
+// delete and "+ " to add.
+type doctorFinding struct {
+	Severity string   `json:"severity"` // "error" or "warning"
+	Name     string   `json:"name"`     // where the mistake is
+	Problem  string   `json:"problem"`
+	Fix      []string `json:"fix,omitempty"`
+}
+
+var (
+	// doctorTypos are misspellings of the _for-sale label
+	doctorTypos = []string{"_forsale", "_for_sale", "for-sale", "forsale", "_for-sales", "_for-sale-"}
+	// doctorChildren are labels probed below _for-sale: the content tags
+	// used as names, and the label repeated
+	doctorChildren = []string{"fval", "ftxt", "furi", "fcod", "_for-sale", "www"}
+	// doctorTypes are the other types probed at _for-sale
+	doctorTypes = []uint16{dns.TypeSPF, dns.TypeURI, dns.TypeA, dns.TypeAAAA, dns.TypeMX}
+)
+
+// doctorProbeLabel is assumed not to exist: TXT records there come from a
+// wildcard.
+const doctorProbeLabel = "_fs-doctor-probe"
+
+// contentTagRe finds where a content tag starts, to split records that hold
+// several of them.
+var contentTagRe = regexp.MustCompile(`(?i)(?:^|[;\s]+)(fcod|ftxt|furi|fval)=`)
+
+// doctorRecord is a TXT or SPF record found by a probe, with its content
+// decoded.
+type doctorRecord struct {
+	rr      dns.RR
+	content string
+}
+
+// zoneLine is rr in zone file syntax, separated by spaces.
+func zoneLine(rr dns.RR) string {
+	return strings.ReplaceAll(rr.String(), "\t", " ")
+}
+
+// fixedContents returns the record contents that the draft expects for
+// content: the exact version tag, and one content tag per record. The
+// problem is empty if content needs no change.
+func fixedContents(content string) (fixed []string, problem string) {
+	c := strings.TrimSpace(content)
+	if len(c) < len("v=FORSALE1") || !strings.EqualFold(c[:len("v=FORSALE1")], "v=FORSALE1") {
+		return nil, ""
+	}
+	var problems, how []string
+	if !strings.HasPrefix(c, "v=FORSALE1") {
+		how = append(how, "case-sensitive")
+	}
+	rest := c[len("v=FORSALE1"):]
+	if !strings.HasPrefix(rest, ";") {
+		how = append(how, "with the semicolon")
+	}
+	if len(how) > 0 {
+		problems = append(problems, `the version tag must be exactly "v=FORSALE1;" (`+strings.Join(how, ", ")+")")
+	}
+	rest = strings.TrimLeft(rest, "; \t")
+
+	starts := contentTagRe.FindAllStringSubmatchIndex(rest, -1)
+	if len(starts) == 0 || starts[0][0] != 0 {
+		// no content tags, or text before the first: leave the content as is
+		fixed = []string{versionTag + rest}
+	} else {
+		upper := false
+		for i, m := range starts {
+			end := len(rest)
+			if i+1 < len(starts) {
+				end = starts[i+1][0]
+			}
+			tag := strings.ToLower(rest[m[2]:m[3]])
+			upper = upper || tag != rest[m[2]:m[3]]
+			value := strings.TrimSpace(rest[m[1]:end])
+			if tag != "ftxt" {
+				// a trailing semicolon, as in SPF; text may end with one
+				value = strings.TrimSpace(strings.TrimRight(value, ";"))
+			}
+			fixed = append(fixed, versionTag+tag+"="+value)
+		}
+		if len(starts) > 1 {
+			problems = append(problems, "each record holds one tag=value pair; publish one record per tag instead of combining them like SPF")
+		}
+		if upper {
+			problems = append(problems, "content tags are lowercase")
+		}
+	}
+	if len(problems) == 0 && len(fixed) == 1 && fixed[0] == content {
+		return fixed, ""
+	}
+	if len(problems) == 0 {
+		problems = append(problems, "stray white space or semicolons around the tags")
+	}
+	return fixed, strings.Join(problems, "; ")
+}
+
+// isForSaleContent reports whether content looks meant as a _for-sale
+// record, version tag misspelt or not.
+func isForSaleContent(content string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(content)), "v=forsale1")
+}
+
+// diagnose probes serverAddr for common mistakes in publishing the
+// _for-sale records of domain: a version tag at the apex, a misspelt
+// label, a CNAME, another type or SPF-style records at _for-sale, names
+// below it and wildcards. The probes are sent in parallel.
+func diagnose(domain, serverAddr string) *doctorReport {
+	apex := dns.Fqdn(domain)
+	fqdn := "_for-sale." + apex
+	type question struct {
+		name  string
+		qtype uint16
+	}
+	questions := []question{
+		{fqdn, dns.TypeTXT},
+		{apex, dns.TypeTXT},
+		{apex, dns.TypeSPF},
+		{doctorProbeLabel + "." + apex, dns.TypeTXT},
+		{doctorProbeLabel + "." + fqdn, dns.TypeTXT},
+		// a relative name in a zone file written with the domain but
+		// without the trailing dot gets the origin twice
+		{fqdn + apex, dns.TypeTXT},
+	}
+	for _, t := range doctorTypes {
+		questions = append(questions, question{fqdn, t})
+	}
+	for _, l := range doctorTypos {
+		questions = append(questions, question{l + "." + apex, dns.TypeTXT})
+	}
+	for _, l := range doctorChildren {
+		questions = append(questions, question{l + "." + fqdn, dns.TypeTXT})
+	}
+
+	rep := &doctorReport{Server: serverAddr, Probes: len(questions), Findings: []doctorFinding{}}
+	answers := make(map[question]*dns.Msg, len(questions))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, q := range questions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, err := probe(q.name, q.qtype, false, serverAddr)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				rep.Failed++
+				return
+			}
+			answers[q] = r
+		}()
+	}
+	wg.Wait()
+
+	// records returns the records of type qtype in the answer to the probe
+	// of name, and whether the name exists
+	records := func(name string, qtype uint16) ([]doctorRecord, bool) {
+		r := answers[question{name, qtype}]
+		if r == nil {
+			return nil, false
+		}
+		var out []doctorRecord
+		for _, rr := range r.Answer {
+			if rr.Header().Rrtype != qtype {
+				continue
+			}
+			var parts []string
+			switch rr := rr.(type) {
+			case *dns.TXT:
+				parts = rr.Txt
+			case *dns.SPF:
+				parts = rr.Txt
+			}
+			var b []byte
+			for _, p := range parts {
+				ub, _ := unescapePresentation(p)
+				b = append(b, ub...)
+			}
+			out = append(out, doctorRecord{rr, string(b)})
+		}
+		return out, r.Rcode == dns.RcodeSuccess
+	}
+	add := func(severity, name, problem string, fix ...string) {
+		rep.Findings = append(rep.Findings, doctorFinding{severity, name, problem, fix})
+	}
+	// moveTo returns the fix lines that publish the contents of recs as
+	// proper TXT records at fqdn
+	moveTo := func(recs []doctorRecord) []string {
+		var lines []string
+		for _, r := range recs {
+			fixed, _ := fixedContents(r.content)
+			for _, c := range fixed {
+				lines = append(lines, fmt.Sprintf(`+ %s %d IN TXT "%s"`, fqdn, r.rr.Header().Ttl, escapeTXT([]byte(c))))
+			}
+		}
+		return lines
+	}
+	deleteLines := func(recs []doctorRecord) []string {
+		var lines []string
+		for _, r := range recs {
+			lines = append(lines, "- "+zoneLine(r.rr))
+		}
+		return lines
+	}
+	forSale := func(recs []doctorRecord) []doctorRecord {
+		var out []doctorRecord
+		for _, r := range recs {
+			if isForSaleContent(r.content) {
+				out = append(out, r)
+			}
+		}
+		return out
+	}
+
+	// wildcards first: they make every other name seem to have records.
+	// The probes found the records at a name that does not exist, so they
+	// are shown with the wildcard owner.
+	wildcard := func(name, owner string) []doctorRecord {
+		recs, _ := records(name, dns.TypeTXT)
+		for i := range recs {
+			recs[i].rr = dns.Copy(recs[i].rr)
+			recs[i].rr.Header().Name = owner
+		}
+		return recs
+	}
+	apexWild := wildcard(doctorProbeLabel+"."+apex, "*."+apex)
+	if recs := forSale(apexWild); len(recs) > 0 {
+		add("warning", "*."+apex, fmt.Sprintf("a wildcard publishes _for-sale content at every name below %s, which looks like any subdomain is for sale; only %s is read", apex, fqdn),
+			append(deleteLines(recs), moveTo(recs)...)...)
+	}
+	// below a _for-sale that does not exist, the apex wildcard answers too
+	childWild := wildcard(doctorProbeLabel+"."+fqdn, "*."+fqdn)
+	if len(childWild) > 0 && !(len(apexWild) > 0 && sameContents(childWild, apexWild)) {
+		add("error", "*."+fqdn, fmt.Sprintf("a wildcard below %s makes it a non-leaf, which is non-conformant", fqdn), deleteLines(childWild)...)
+	}
+
+	txts, exists := records(fqdn, dns.TypeTXT)
+	var own []doctorRecord // TXT records published at _for-sale itself
+	alias := false
+	if r := answers[question{fqdn, dns.TypeTXT}]; r != nil && len(r.Answer) > 0 {
+		if cname, ok := r.Answer[0].(*dns.CNAME); ok && strings.EqualFold(cname.Hdr.Name, fqdn) {
+			alias = true
+			add("warning", fqdn, fmt.Sprintf("%s is an alias (CNAME) of %s; the records then depend on a name the domain holder may not control, and may list a third party's offer", fqdn, cname.Target),
+				append([]string{"- " + zoneLine(cname)}, moveTo(forSale(txts))...)...)
+		} else {
+			own = txts
+		}
+	}
+	if len(own) > 0 && len(apexWild) > 0 && sameContents(own, apexWild) {
+		// synthesised from the apex wildcard, reported above
+		own = nil
+	}
+	for _, r := range own {
+		switch {
+		case strings.HasPrefix(strings.ToLower(r.content), "v=spf1"):
+			add("warning", fqdn, "an SPF policy at _for-sale has no effect, and processors ignore it", "- "+zoneLine(r.rr))
+		case isForSaleContent(r.content):
+			if _, problem := fixedContents(r.content); problem != "" {
+				add("error", fqdn, problem, append([]string{"- " + zoneLine(r.rr)}, moveTo([]doctorRecord{r})...)...)
+			}
+		}
+	}
+
+	// the version tag at the apex, or in the SPF RR type
+	for _, qtype := range []uint16{dns.TypeTXT, dns.TypeSPF} {
+		recs, _ := records(apex, qtype)
+		if recs = forSale(recs); len(recs) > 0 {
+			add("error", apex, fmt.Sprintf("%s record with the version tag at the apex; processors only look at %s", dns.TypeToString[qtype], fqdn),
+				append(deleteLines(recs), moveTo(recs)...)...)
 		}
-		if r.Ignored {
-			fmt.Printf("  Verdict: IGNORED (no valid version tag found)\n")
-		} else if r.Valid {
-			fmt.Printf("  Verdict: VALID\n")
-		} else {
-			fmt.Printf("  Verdict: INVALID\n")
+	}
+	for _, t := range doctorTypes {
+		recs, _ := records(fqdn, t)
+		if len(recs) == 0 {
+			continue
 		}
-		if r.Tag != "" {
-			fmt.Printf("  Content tag: %s\n", r.Tag)
-			if r.TagValue != "" {
-				fmt.Printf("  Content value (len=%d): %s\n", len(r.TagValue), r.TagValue)
+		switch t {
+		case dns.TypeSPF:
+			add("error", fqdn, "SPF RR type (99) instead of TXT; processors only read TXT records",
+				append(deleteLines(recs), moveTo(forSale(recs))...)...)
+		case dns.TypeURI:
+			fix := deleteLines(recs)
+			for _, r := range recs {
+				fix = append(fix, fmt.Sprintf(`+ %s %d IN TXT "%s"`, fqdn, r.rr.Header().Ttl, escapeTXT([]byte(versionTag+"furi="+r.rr.(*dns.URI).Target))))
 			}
-		} else {
-			fmt.Printf("  No content tag present (empty content after version tag)\n")
+			add("error", fqdn, "URI record at _for-sale; processors only read TXT records, put the URI in a furi tag", fix...)
+		default:
+			add("warning", fqdn, fmt.Sprintf("%s records at _for-sale are not used; the name only needs TXT records", dns.TypeToString[t]), deleteLines(recs)...)
 		}
-		for _, m := range r.Messages {
-			fmt.Printf("  - %s\n", m)
+	}
+
+	// misspelt labels, unless a wildcard answers for them
+	if len(apexWild) == 0 {
+		names := []string{fqdn + apex}
+		for _, l := range doctorTypos {
+			names = append(names, l+"."+apex)
+		}
+		for _, name := range names {
+			recs, _ := records(name, dns.TypeTXT)
+			if len(recs) == 0 {
+				continue
+			}
+			problem := fmt.Sprintf("TXT records at a misspelt label; processors only look at %s", fqdn)
+			if name == fqdn+apex {
+				problem = fmt.Sprintf("the domain appears twice: a name in a zone file without its trailing dot gets the origin appended; processors only look at %s", fqdn)
+			}
+			add("error", name, problem, append(deleteLines(recs), moveTo(forSale(recs))...)...)
 		}
-		fmt.Println()
 	}
 
-	// RRset TTL checks
-	if len(ttls) > 1 {
-		fmt.Printf("Warning: TXT RRset contains records with differing TTLs (RRset TTLs must be the same per RFC2181 Section 5.2). TTLs seen:\n")
-		// Print TTLs in deterministic order
-		keys := make([]int, 0, len(ttls))
-		for k := range ttls {
-			keys = append(keys, int(k))
+	// names below _for-sale make it a non-leaf
+	if len(childWild) == 0 {
+		found := false
+		for _, l := range doctorChildren {
+			name := l + "." + fqdn
+			recs, childExists := records(name, dns.TypeTXT)
+			if !childExists {
+				continue
+			}
+			found = true
+			add("error", name, fmt.Sprintf("%s is not a leaf: %s exists below it, which is non-conformant", fqdn, name),
+				append(deleteLines(recs), moveTo(forSale(recs))...)...)
 		}
-		sort.Ints(keys)
-		for _, ttl := range keys {
-			fmt.Printf("  TTL %d: %d record(s)\n", ttl, ttls[uint32(ttl)])
+		otherTypes := false
+		for _, t := range doctorTypes {
+			if recs, _ := records(fqdn, t); len(recs) > 0 {
+				otherTypes = true
+			}
 		}
-	} else {
-		for ttl := range ttls {
-			if ttl > 3600 {
-				fmt.Printf("Warning: TTL=%d is greater than the recommended 3600s (1 hour). Long TTLs increase the risk of outdated sale information.\n", ttl)
+		if exists && !alias && len(txts) == 0 && !found && !otherTypes {
+			add("warning", fqdn, fmt.Sprintf("%s exists without records, so there are names below it (an empty non-terminal), which is non-conformant; none of the usual ones was found", fqdn))
+		}
+	}
+	return rep
+}
+
+// sameContents reports whether a and b hold the same record contents.
+func sameContents(a, b []doctorRecord) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	ca, cb := make([]string, len(a)), make([]string, len(b))
+	for i := range a {
+		ca[i], cb[i] = a[i].content, b[i].content
+	}
+	sort.Strings(ca)
+	sort.Strings(cb)
+	return slices.Equal(ca, cb)
+}
+
+// printDoctor prints the -doctor section of the human-readable output.
+func printDoctor(rep *doctorReport) {
+	fmt.Println()
+	if rep.Error != "" {
+		fmt.Printf("Doctor: %s\n", rep.Error)
+		return
+	}
+	fmt.Printf("Doctor: %d probes for common mistakes sent to %s", rep.Probes, rep.Server)
+	if rep.Failed > 0 {
+		fmt.Printf(", %d without answer", rep.Failed)
+	}
+	fmt.Println()
+	if len(rep.Findings) == 0 {
+		fmt.Println("  No common mistakes found.")
+		return
+	}
+	for _, f := range rep.Findings {
+		fmt.Printf("  %s at %s: %s\n", strings.ToUpper(f.Severity), f.Name, f.Problem)
+		for _, l := range f.Fix {
+			fmt.Printf("      %s\n", l)
+		}
+	}
+}
+
+// negativeAnswer explains why a lookup gave no _for-sale records.
+type negativeAnswer struct {
+	// Class is "nxdomain" (_for-sale does not exist, the domain does),
+	// "nxdomain-parent" (the domain itself does not exist), "nodata" (the
+	// name exists without TXT records), "servfail", "servfail-dnssec"
+	// (DNSSEC validation failed), "timeout" or "error" (another rcode)
+	Class       string   `json:"class"`
+	Rcode       string   `json:"rcode,omitempty"`        // absent on timeout
+	NegativeTTL uint32   `json:"negative_ttl,omitempty"` // seconds resolvers may cache the answer: min(SOA TTL, SOA MINIMUM) (RFC 2308)
+	Zone        string   `json:"zone,omitempty"`         // owner of the SOA record in the authority section; absent without one
+	EDE         []string `json:"ede,omitempty"`          // extended DNS errors (RFC 8914)
+	Explanation string   `json:"explanation"`
+}
+
+// negativeExitCodes are the exit codes for each class of negative answer.
+var negativeExitCodes = map[string]int{
+	"nxdomain":        4,
+	"nodata":          5,
+	"nxdomain-parent": 6,
+	"servfail":        7,
+	"servfail-dnssec": 8,
+	"timeout":         9,
+	"error":           3,
+}
+
+// exitCode is the exit code for the answer: with -explain the one of its
+// class, otherwise 2 for no records and 3 when the lookup failed, as before
+// the classes were told apart.
+func (neg *negativeAnswer) exitCode(explain bool) int {
+	switch {
+	case explain:
+		return negativeExitCodes[neg.Class]
+	case neg.failed():
+		return 3
+	}
+	return 2
+}
+
+// failed reports whether the answer leaves it unknown if there are records.
+func (neg *negativeAnswer) failed() bool {
+	switch neg.Class {
+	case "nxdomain", "nxdomain-parent", "nodata":
+		return false
+	}
+	return true
+}
+
+// dnssecEDE are the extended DNS error codes that report a DNSSEC
+// validation failure.
+var dnssecEDE = map[uint16]bool{
+	dns.ExtendedErrorCodeUnsupportedDNSKEYAlgorithm:  true,
+	dns.ExtendedErrorCodeUnsupportedDSDigestType:     true,
+	dns.ExtendedErrorCodeDNSSECIndeterminate:         true,
+	dns.ExtendedErrorCodeDNSBogus:                    true,
+	dns.ExtendedErrorCodeSignatureExpired:            true,
+	dns.ExtendedErrorCodeSignatureNotYetValid:        true,
+	dns.ExtendedErrorCodeDNSKEYMissing:               true,
+	dns.ExtendedErrorCodeRRSIGsMissing:               true,
+	dns.ExtendedErrorCodeNoZoneKeyBitSet:             true,
+	dns.ExtendedErrorCodeNSECMissing:                 true,
+	dns.ExtendedErrorCodeSignatureExpiredBeforeValid: true,
+}
+
+// classifyNegative explains a response to the _for-sale query of domain
+// without TXT records. It may send follow-up queries to serverAddr: whether
+// the domain itself exists after NXDOMAIN, and the query with checking
+// disabled (CD) after SERVFAIL.
+func classifyNegative(domain string, r *dns.Msg, serverAddr string) *negativeAnswer {
+	neg := &negativeAnswer{Rcode: dns.RcodeToString[r.Rcode]}
+	for _, rr := range r.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			neg.NegativeTTL = min(soa.Hdr.Ttl, soa.Minttl)
+			neg.Zone = soa.Hdr.Name
+			break
+		}
+	}
+	dnssecFailure := false
+	if opt := r.IsEdns0(); opt != nil {
+		for _, o := range opt.Option {
+			if ede, ok := o.(*dns.EDNS0_EDE); ok {
+				e := fmt.Sprintf("%d (%s)", ede.InfoCode, dns.ExtendedErrorCodeToString[ede.InfoCode])
+				if ede.ExtraText != "" {
+					e += ": " + ede.ExtraText
+				}
+				neg.EDE = append(neg.EDE, e)
+				dnssecFailure = dnssecFailure || dnssecEDE[ede.InfoCode]
 			}
 		}
 	}
 
-	// Summary & exit code
-	validCount := len(valids)
-	ignoredCount := len(ignored)
-	invalidCount := len(invalids)
+	switch r.Rcode {
+	case dns.RcodeNameError:
+		// nothing exists below a name that does not exist (RFC 8020), so
+		// the domain's own answer tells which of the two is missing
+		neg.Class = "nxdomain"
+		neg.Explanation = fmt.Sprintf("_for-sale.%s does not exist (NXDOMAIN), but %s does: no sale is offered in the DNS", domain, domain)
+		p, err := probe(dns.Fqdn(domain), dns.TypeSOA, false, serverAddr)
+		switch {
+		case err != nil:
+			neg.Explanation = fmt.Sprintf("_for-sale.%s does not exist (NXDOMAIN); whether %s exists could not be checked: %v", domain, domain, err)
+		case p.Rcode == dns.RcodeNameError:
+			neg.Class = "nxdomain-parent"
+			neg.Explanation = fmt.Sprintf("%s does not exist (NXDOMAIN): it is not registered or not delegated, and may be available for registration", domain)
+		}
+	case dns.RcodeSuccess:
+		neg.Class = "nodata"
+		neg.Explanation = fmt.Sprintf("_for-sale.%s exists but has no TXT records (NODATA): it has records of other types only, or only names below it (an empty non-terminal)", domain)
+	case dns.RcodeServerFailure:
+		// a validating resolver answers SERVFAIL to bogus data, but still
+		// returns it when checking is disabled
+		neg.Class = "servfail"
+		neg.Explanation = "the resolver could not get an answer (SERVFAIL), e.g. because the name servers of the domain are unreachable or broken"
+		if p, err := probe(dns.Fqdn("_for-sale."+domain), dns.TypeTXT, true, serverAddr); err == nil && (p.Rcode == dns.RcodeSuccess || p.Rcode == dns.RcodeNameError) {
+			dnssecFailure = true
+		}
+		if dnssecFailure {
+			neg.Class = "servfail-dnssec"
+			neg.Explanation = "DNSSEC validation failed (SERVFAIL): the resolver rejects the answer as bogus, e.g. because of expired signatures or a DS record that does not match"
+		}
+	default:
+		neg.Class = "error"
+		neg.Explanation = fmt.Sprintf("the resolver answered %s", neg.Rcode)
+	}
+	return neg
+}
 
-	fmt.Printf("\nSummary: %d record(s) total: %d valid, %d ignored (no version), %d invalid\n",
-		len(sorted), validCount, ignoredCount, invalidCount)
+// timeoutAnswer is the negative answer when no resolver answered in time.
+func timeoutAnswer(err error) *negativeAnswer {
+	return &negativeAnswer{Class: "timeout", Explanation: fmt.Sprintf("no answer within %s: %v", defaultTimeout, err)}
+}
 
-	if anyValid {
-		os.Exit(0)
+// isTimeout reports whether err is a query that timed out.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// probe sends a follow-up query with EDNS0, over TCP if the UDP response is
+// truncated. cd sets the Checking Disabled bit.
+func probe(qname string, qtype uint16, cd bool, serverAddr string) (*dns.Msg, error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(qname, qtype)
+	msg.SetEdns0(4096, false)
+	msg.CheckingDisabled = cd
+	r, _, _, err := exchange(msg, serverAddr, "udp", defaultTimeout)
+	if err == nil && r.Truncated {
+		r, _, _, err = exchange(msg, serverAddr, "tcp", defaultTimeout)
 	}
-	os.Exit(2)
+	return r, err
 }
 
 // queryTXTWithFallback performs a TXT query for qname to serverAddr.
-// It sets EDNS0 with a larger UDP buffer (4096) and, if the response is truncated,
-// retries the same query over TCP to obtain the full response.
-func queryTXTWithFallback(qname, serverAddr string, timeout time.Duration) (*dns.Msg, error) {
-	client := &dns.Client{Timeout: timeout, Net: "udp"}
+// It uses EDNS0 with a 4096-byte UDP payload, asks for the server's NSID and
+// retries over TCP if the UDP response is truncated. It returns the response
+// both unpacked and in wire format, with metadata about it.
+func queryTXTWithFallback(qname, serverAddr string, timeout time.Duration) (*dns.Msg, []byte, *responseInfo, error) {
 	msg := new(dns.Msg)
 	msg.SetQuestion(qname, dns.TypeTXT)
 	// request EDNS0 with larger UDP payload (4096)
 	msg.SetEdns0(4096, false)
+	opt := msg.IsEdns0()
+	opt.Option = append(opt.Option, &dns.EDNS0_NSID{Code: dns.EDNS0NSID})
 
-	r, _, err := client.Exchange(msg, serverAddr)
+	r, wire, rtt, err := exchange(msg, serverAddr, "udp", timeout)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
+	transport, udpTruncated := "udp", r.Truncated
 	if r.Truncated {
 		// Retry over TCP to obtain full answer
-		client.Net = "tcp"
-		r2, _, err2 := client.Exchange(msg, serverAddr)
+		r2, wire2, rtt2, err2 := exchange(msg, serverAddr, "tcp", timeout)
 		if err2 != nil {
 			// return the original truncated response if TCP failed, but signal error
-			return r, fmt.Errorf("UDP response truncated; TCP retry failed: %w", err2)
+			return r, wire, newResponseInfo(r, wire, serverAddr, transport, rtt, udpTruncated), fmt.Errorf("UDP response truncated; TCP retry failed: %w", err2)
+		}
+		r, wire, rtt, transport = r2, wire2, rtt2, "tcp"
+	}
+	return r, wire, newResponseInfo(r, wire, serverAddr, transport, rtt, udpTruncated), nil
+}
+
+// exchange sends msg to serverAddr over network ("udp" or "tcp") and returns
+// the response, its wire format and the round-trip time. dns.Client.Exchange
+// only returns the unpacked message.
+func exchange(msg *dns.Msg, serverAddr, network string, timeout time.Duration) (*dns.Msg, []byte, time.Duration, error) {
+	client := &dns.Client{Net: network, Timeout: timeout}
+	co, err := client.Dial(serverAddr)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer co.Close()
+	co.UDPSize = dns.DefaultMsgSize
+	co.SetDeadline(time.Now().Add(timeout))
+
+	start := time.Now()
+	if err := co.WriteMsg(msg); err != nil {
+		return nil, nil, 0, err
+	}
+	wire, err := co.ReadMsgHeader(nil)
+	rtt := time.Since(start)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	r := new(dns.Msg)
+	if err := r.Unpack(wire); err != nil {
+		return nil, nil, 0, err
+	}
+	if r.Id != msg.Id {
+		return nil, nil, 0, dns.ErrId
+	}
+	return r, wire, rtt, nil
+}
+
+// responseInfo describes the DNS response the records were taken from.
+type responseInfo struct {
+	Server       string  `json:"server"`    // address the query was sent to
+	Transport    string  `json:"transport"` // "udp" or "tcp"
+	Rcode        string  `json:"rcode"`
+	AA           bool    `json:"aa"`                      // authoritative answer: the server serves the zone itself
+	AD           bool    `json:"ad"`                      // authenticated data: the resolver validated the answer with DNSSEC
+	TC           bool    `json:"tc"`                      // the response is truncated
+	UDPTruncated bool    `json:"udp_truncated,omitempty"` // the UDP response was truncated and the query repeated over TCP
+	EDNSUDPSize  uint16  `json:"edns_udp_size,omitempty"` // UDP payload size the server advertised; absent without EDNS
+	NSID         string  `json:"nsid,omitempty"`          // hex name server identifier (RFC 5001), if the server sent one
+	Size         int     `json:"size"`                    // octets
+	RTTMillis    float64 `json:"rtt_ms"`
+}
+
+func newResponseInfo(r *dns.Msg, wire []byte, server, transport string, rtt time.Duration, udpTruncated bool) *responseInfo {
+	info := &responseInfo{
+		Server:       server,
+		Transport:    transport,
+		Rcode:        dns.RcodeToString[r.Rcode],
+		AA:           r.Authoritative,
+		AD:           r.AuthenticatedData,
+		TC:           r.Truncated,
+		UDPTruncated: udpTruncated,
+		Size:         len(wire),
+		RTTMillis:    float64(rtt.Microseconds()) / 1000,
+	}
+	if opt := r.IsEdns0(); opt != nil {
+		info.EDNSUDPSize = opt.UDPSize()
+		for _, o := range opt.Option {
+			if nsid, ok := o.(*dns.EDNS0_NSID); ok {
+				info.NSID = nsid.Nsid
+			}
+		}
+	}
+	return info
+}
+
+// String is the one-line summary of the human-readable output.
+func (info *responseInfo) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Response from %s over %s: %s, %d octets, RTT %.1f ms, flags", info.Server, strings.ToUpper(info.Transport), info.Rcode, info.Size, info.RTTMillis)
+	flags := 0
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{{"aa", info.AA}, {"ad", info.AD}, {"tc", info.TC}} {
+		if f.set {
+			sb.WriteString(" " + f.name)
+			flags++
+		}
+	}
+	if flags == 0 {
+		sb.WriteString(" none")
+	}
+	if info.UDPTruncated {
+		sb.WriteString(" (UDP response truncated, retried over TCP)")
+	}
+	if info.EDNSUDPSize > 0 {
+		fmt.Fprintf(&sb, ", EDNS UDP size %d", info.EDNSUDPSize)
+	} else {
+		sb.WriteString(", no EDNS")
+	}
+	if info.NSID != "" {
+		fmt.Fprintf(&sb, ", NSID %s", info.NSID)
+		if b, err := hex.DecodeString(info.NSID); err == nil && isPrintableASCII(b) {
+			fmt.Fprintf(&sb, " (%q)", b)
+		}
+	}
+	return sb.String()
+}
+
+func isPrintableASCII(b []byte) bool {
+	for _, c := range b {
+		if c < 0x20 || c > 0x7e {
+			return false
+		}
+	}
+	return len(b) > 0
+}
+
+// wireTXT is a TXT RR from the answer section as it was on the wire.
+type wireTXT struct {
+	Name    string
+	TTL     uint32
+	RDATA   []byte
+	Strings [][]byte // the character-strings in RDATA
+}
+
+// txt returns the RR as a dns.TXT, with the character-strings in
+// presentation form for display.
+func (w wireTXT) txt() *dns.TXT {
+	t := &dns.TXT{Hdr: dns.RR_Header{Name: w.Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: w.TTL, Rdlength: uint16(len(w.RDATA))}}
+	for _, s := range w.Strings {
+		t.Txt = append(t.Txt, escapeTXT(s))
+	}
+	return t
+}
+
+// unpackWireTXT returns the TXT RRs in the answer section of a wire-format
+// DNS message, with the character-strings unpacked from the RDATA octets.
+func unpackWireTXT(msg []byte) ([]wireTXT, error) {
+	if len(msg) < 12 {
+		return nil, errors.New("message shorter than the DNS header")
+	}
+	qdcount := int(binary.BigEndian.Uint16(msg[4:]))
+	ancount := int(binary.BigEndian.Uint16(msg[6:]))
+	off := 12
+	for range qdcount {
+		_, next, err := dns.UnpackDomainName(msg, off)
+		if err != nil {
+			return nil, fmt.Errorf("question: %w", err)
+		}
+		off = next + 4 // QTYPE, QCLASS
+	}
+
+	var txts []wireTXT
+	for i := range ancount {
+		name, next, err := dns.UnpackDomainName(msg, off)
+		if err != nil {
+			return nil, fmt.Errorf("answer %d: %w", i+1, err)
 		}
-		return r2, nil
+		if next+10 > len(msg) {
+			return nil, fmt.Errorf("answer %d: RR header runs past the message", i+1)
+		}
+		rrtype := binary.BigEndian.Uint16(msg[next:])
+		class := binary.BigEndian.Uint16(msg[next+2:])
+		ttl := binary.BigEndian.Uint32(msg[next+4:])
+		rdlength := int(binary.BigEndian.Uint16(msg[next+8:]))
+		off = next + 10
+		if off+rdlength > len(msg) {
+			return nil, fmt.Errorf("answer %d: RDATA runs past the message", i+1)
+		}
+		rdata := msg[off : off+rdlength]
+		off += rdlength
+		if rrtype != dns.TypeTXT || class != dns.ClassINET {
+			continue
+		}
+		strs, err := unpackCharacterStrings(rdata)
+		if err != nil {
+			return nil, fmt.Errorf("answer %d (%s TXT): %w", i+1, name, err)
+		}
+		txts = append(txts, wireTXT{Name: name, TTL: ttl, RDATA: rdata, Strings: strs})
+	}
+	return txts, nil
+}
+
+// unpackCharacterStrings splits TXT RDATA into its character-strings: each
+// is a length octet followed by that many octets (RFC 1035 section 3.3).
+func unpackCharacterStrings(rdata []byte) ([][]byte, error) {
+	var strs [][]byte
+	for i := 0; i < len(rdata); {
+		n := int(rdata[i])
+		if i+1+n > len(rdata) {
+			return nil, fmt.Errorf("character-string at offset %d claims %d octets, RDATA has %d left", i, n, len(rdata)-i-1)
+		}
+		strs = append(strs, rdata[i+1:i+1+n])
+		i += 1 + n
 	}
-	return r, nil
+	return strs, nil
 }
 
 // analyzeTXT validates a dns.TXT RR and returns a recordResult.
 // Improvements over previous logic:
-//  - Always concatenate unescaped character-strings to form the logical content.
-//  - Provide a heuristic `FitsSingleCharstring` that is true when concatenated content <=255
-//    allowing the tool to treat some multi-part TXT RRs as a single logical string for robustness.
-//  - Keep and report the raw count but do not automatically reject records simply because
-//    the server split a logical single string into multiple character-strings (common in practice).
-//  - Validate textual content for UTF-8 and forbidden control characters per the draft's recommendations.
-//  - Add a per-record TTL warning when the observed TTL exceeds the recommended 3600 seconds
-//    (noting that this may come from a resolver cache).
-//  - Add an explicit warning when TXT RRs are multi-part (raw_count>1) and report decoded per-part lengths.
+//   - Always concatenate unescaped character-strings to form the logical content.
+//   - Provide a heuristic `FitsSingleCharstring` that is true when concatenated content <=255
+//     allowing the tool to treat some multi-part TXT RRs as a single logical string for robustness.
+//   - Keep and report the raw count but do not automatically reject records simply because
+//     the server split a logical single string into multiple character-strings (common in practice).
+//   - Validate textual content for UTF-8 and forbidden control characters per the draft's recommendations.
+//   - Add a per-record TTL warning when the observed TTL exceeds the recommended 3600 seconds
+//     (noting that this may come from a resolver cache).
+//   - Add an explicit warning when TXT RRs are multi-part (raw_count>1) and report decoded per-part lengths.
 func analyzeTXT(t *dns.TXT) recordResult {
+	return analyzeCharacterStrings(t, nil)
+}
+
+// analyzeWireTXT validates a TXT RR taken from a DNS response, using the
+// character-strings as they were on the wire instead of decoding t's
+// presentation strings. t must hold the same character-strings.
+func analyzeWireTXT(t *dns.TXT, wire [][]byte) recordResult {
+	return analyzeCharacterStrings(t, wire)
+}
+
+// analyzeCharacterStrings does the work of analyzeTXT and analyzeWireTXT;
+// wire is nil when the octets have to be decoded from t's presentation form.
+func analyzeCharacterStrings(t *dns.TXT, wire [][]byte) recordResult {
 	res := recordResult{
-		TTL:     t.Hdr.Ttl,
-		RawTxts: append([]string(nil), t.Txt...),
+		TTL:      t.Hdr.Ttl,
+		RawTxts:  append([]string(nil), t.Txt...),
 		RawCount: len(t.Txt),
 	}
 
 	// Warn when observed TTL exceeds recommended value (note: may be a cached reply)
 	if res.TTL > 3600 {
-		res.Messages = append(res.Messages, fmt.Sprintf("Warning: observed TTL=%d exceeds the recommended 3600s (1 hour). Note: this value may come from a resolver cache and not the authoritative server.", res.TTL))
+		res.add("warning", "ttl", fmt.Sprintf("observed TTL=%d exceeds the recommended 3600s (1 hour). Note: this value may come from a resolver cache and not the authoritative server.", res.TTL))
 	}
 
 	// If zero character-strings, invalid
 	if res.RawCount == 0 {
-		res.Messages = append(res.Messages, "TXT RR contains zero character-strings (invalid).")
+		res.add("error", "rdata", "TXT RR contains zero character-strings (invalid).")
 		res.Valid = false
 		return res
 	}
 
-	// Decode each character-string from presentation escapes to raw bytes, collect decoded lengths, then concatenate
+	// Decode each character-string from presentation escapes to raw bytes (unless the wire
+	// octets are known), collect decoded lengths, then concatenate
 	var b []byte
 	decodedLens := make([]int, 0, len(t.Txt))
-	for _, part := range t.Txt {
+	for i, part := range t.Txt {
+		if wire != nil {
+			decodedLens = append(decodedLens, len(wire[i]))
+			b = append(b, wire[i]...)
+			continue
+		}
 		ub, err := unescapePresentation(part)
 		if err != nil {
 			// record the error but continue; ub may contain partial decoded bytes
-			res.Messages = append(res.Messages, fmt.Sprintf("Warning: error while unescaping presentation string: %v", err))
+			res.add("warning", "rdata", fmt.Sprintf("error while unescaping presentation string: %v", err))
 		}
 		decodedLens = append(decodedLens, len(ub))
 		b = append(b, ub...)
@@ -374,11 +3245,11 @@ func analyzeTXT(t *dns.TXT) recordResult {
 	// Warn if the server split into multiple raw character-strings
 	if res.RawCount > 1 {
 		// explicit multi-part warning requested by user
-		res.Messages = append(res.Messages, fmt.Sprintf("Warning: TXT RR contains %d raw character-strings (multi-part RR). The draft RECOMMENDS using a single character-string; consider converting to a single string to avoid ambiguity.", res.RawCount))
+		res.add("warning", "multi-part", fmt.Sprintf("TXT RR contains %d raw character-strings (multi-part RR). The draft RECOMMENDS using a single character-string; consider converting to a single string to avoid ambiguity.", res.RawCount))
 		// If any raw part decoded length >255 (octets), it's definitely non-conformant
 		for i, decLen := range decodedLens {
 			if decLen > maxTxtStr {
-				res.Messages = append(res.Messages, fmt.Sprintf("Raw character-string #%d decoded length %d octets exceeds 255 octets (maximum).", i, decLen))
+				res.add("error", "rdata", fmt.Sprintf("Raw character-string #%d decoded length %d octets exceeds 255 octets (maximum).", i, decLen))
 				// mark invalid, but continue diagnostics
 				res.Valid = false
 			}
@@ -388,7 +3259,7 @@ func analyzeTXT(t *dns.TXT) recordResult {
 	// If concatenation exceeds 255 bytes, that's non-conformant with the draft's requirement that
 	// each TXT record's RDATA MUST be a single character-string of at most 255 bytes.
 	if res.ConcatenatedLength > maxTxtStr {
-		res.Messages = append(res.Messages, fmt.Sprintf("Decoded concatenated content byte length %d exceeds 255 octets; this is non-conformant.", res.ConcatenatedLength))
+		res.add("error", "rdata", fmt.Sprintf("Decoded concatenated content byte length %d exceeds 255 octets; this is non-conformant.", res.ConcatenatedLength))
 		// keep going to give diagnostics, but mark invalid
 		res.Valid = false
 	}
@@ -398,14 +3269,14 @@ func analyzeTXT(t *dns.TXT) recordResult {
 	if !strings.HasPrefix(content, versionTag) {
 		// Robustness: accept versionTag followed by single space or tab (warn)
 		if strings.HasPrefix(content, versionTag+" ") || strings.HasPrefix(content, versionTag+"\t") {
-			res.Messages = append(res.Messages, "Record starts with version tag followed by whitespace - accepted under robustness, but spaces are not allowed by the ABNF (warning).")
+			res.add("warning", "version-tag", "Record starts with version tag followed by whitespace - accepted under robustness, but spaces are not allowed by the ABNF.")
 			rest := content[len(versionTag):]
 			if len(rest) > 0 && (rest[0] == ' ' || rest[0] == '\t') {
 				rest = rest[1:]
 			}
 			content = rest
 		} else {
-			res.Messages = append(res.Messages, "No valid version tag found at start of the TXT record. TXT records without the exact, case-sensitive version tag \"v=FORSALE1;\" MUST NOT be interpreted as valid _for-sale indicators (this record will be ignored).")
+			res.add("error", "version-tag", "No valid version tag found at start of the TXT record. TXT records without the exact, case-sensitive version tag \"v=FORSALE1;\" MUST NOT be interpreted as valid _for-sale indicators (this record will be ignored).")
 			res.Ignored = true
 			res.Valid = false
 			return res
@@ -417,7 +3288,7 @@ func analyzeTXT(t *dns.TXT) recordResult {
 	// If no content after version tag => valid indicator with no further info
 	if content == "" {
 		res.Valid = true
-		res.Messages = append(res.Messages, "Record contains only the version tag and no content: valid indicator that the domain is for sale.")
+		res.add("note", "content-tag", "Record contains only the version tag and no content: valid indicator that the domain is for sale.")
 		return res
 	}
 
@@ -431,10 +3302,10 @@ func analyzeTXT(t *dns.TXT) recordResult {
 		}
 	}
 	if foundTag == "" {
-		res.Messages = append(res.Messages, fmt.Sprintf("Content does not start with a recognised content tag (fcod=, ftxt=, furi=, fval=). Found content: %q", content))
+		res.add("error", "content-tag", fmt.Sprintf("Content does not start with a recognised content tag (fcod=, ftxt=, furi=, fval=). Found content: %q", content))
 		// Per draft: if version present but content invalid, processors SHOULD assume domain is for sale
 		res.Valid = true
-		res.Messages = append(res.Messages, "Per the draft, since a valid version tag is present but content is invalid, processors SHOULD still treat the domain as for sale. This tool marks the record as ACCEPTED (but with warnings).")
+		res.add("note", "content-tag", "Per the draft, since a valid version tag is present but content is invalid, processors SHOULD still treat the domain as for sale. This tool marks the record as ACCEPTED (but with warnings).")
 		return res
 	}
 
@@ -446,7 +3317,7 @@ func analyzeTXT(t *dns.TXT) recordResult {
 	for _, tg := range tags {
 		needle := ";" + tg
 		if strings.Contains(val, needle) {
-			res.Messages = append(res.Messages, fmt.Sprintf("The content value contains %q which looks like an additional tag-value pair. The draft REQUIRES exactly one tag-value pair per record; embedding additional tags in the value can be ambiguous.", needle))
+			res.add("warning", "content-tag", fmt.Sprintf("The content value contains %q which looks like an additional tag-value pair. The draft REQUIRES exactly one tag-value pair per record; embedding additional tags in the value can be ambiguous.", needle))
 		}
 	}
 
@@ -454,29 +3325,29 @@ func analyzeTXT(t *dns.TXT) recordResult {
 	switch foundTag {
 	case "fcod":
 		if len([]byte(val)) < 1 {
-			res.Messages = append(res.Messages, "fcod= has an empty value (must be at least 1 octet).")
+			res.add("error", "fcod", "fcod= has an empty value (must be at least 1 octet).")
 			res.Valid = false
 			return res
 		}
 		if len([]byte(val)) > 239 {
-			res.Messages = append(res.Messages, fmt.Sprintf("fcod value byte length %d exceeds the draft's maximum of 239 octets for fcod-value.", len([]byte(val))))
+			res.add("error", "fcod", fmt.Sprintf("fcod value byte length %d exceeds the draft's maximum of 239 octets for fcod-value.", len([]byte(val))))
 			res.Valid = false
 			return res
 		}
 		// fcod is opaque; do not apply UTF-8 checks
 		res.Valid = true
-		res.Messages = append(res.Messages, "fcod content tag is syntactically acceptable (semantic interpretation is proprietary).")
+		res.add("note", "fcod", "fcod content tag is syntactically acceptable (semantic interpretation is proprietary).")
 		return res
 
 	case "ftxt":
 		// ftxt-value = 1*239OCTET
 		if len([]byte(val)) < 1 {
-			res.Messages = append(res.Messages, "ftxt= has an empty value (must be at least 1 octet).")
+			res.add("error", "ftxt", "ftxt= has an empty value (must be at least 1 octet).")
 			res.Valid = false
 			return res
 		}
 		if len([]byte(val)) > 239 {
-			res.Messages = append(res.Messages, fmt.Sprintf("ftxt value byte length %d exceeds the draft's maximum of 239 octets for ftxt-value.", len([]byte(val))))
+			res.add("error", "ftxt", fmt.Sprintf("ftxt value byte length %d exceeds the draft's maximum of 239 octets for ftxt-value.", len([]byte(val))))
 			res.Valid = false
 			return res
 		}
@@ -484,23 +3355,26 @@ func analyzeTXT(t *dns.TXT) recordResult {
 		// New: enforce recommendations about UTF-8 / control characters:
 		warns, errs := checkUnicodeContent(val)
 		for _, w := range warns {
-			res.Messages = append(res.Messages, "Warning: "+w)
+			res.add("warning", "unicode", w)
+		}
+		for _, w := range checkUnicodeSecurity(val) {
+			res.add("warning", "security", w)
 		}
 		if len(errs) > 0 {
 			for _, e := range errs {
-				res.Messages = append(res.Messages, "Error: "+e)
+				res.add("error", "unicode", e)
 			}
 			res.Valid = false
 			return res
 		}
 
 		res.Valid = true
-		res.Messages = append(res.Messages, "ftxt content tag is syntactically acceptable. Note: avoid using URIs in ftxt; prefer furi=. Ensure non-ASCII text is UTF-8 encoded.")
+		res.add("note", "ftxt", "ftxt content tag is syntactically acceptable. Note: avoid using URIs in ftxt; prefer furi=. Ensure non-ASCII text is UTF-8 encoded.")
 		return res
 
 	case "furi":
 		if len(val) < 1 {
-			res.Messages = append(res.Messages, "furi= has an empty value (must contain exactly one URI or IRI).")
+			res.add("error", "furi", "furi= has an empty value (must contain exactly one URI or IRI).")
 			res.Valid = false
 			return res
 		}
@@ -513,9 +3387,9 @@ func analyzeTXT(t *dns.TXT) recordResult {
 			recommended := map[string]bool{"http": true, "https": true, "mailto": true, "tel": true}
 			if !recommended[scheme] {
 				// Moderate warning: syntactically allowed but not recommended
-				res.Messages = append(res.Messages, fmt.Sprintf("furi uses non-recommended scheme %q; the draft RECOMMENDS only http, https, mailto and tel. Non-recommended schemes may be unsafe; do NOT auto-follow without user confirmation.", scheme))
+				res.add("warning", "furi-scheme", fmt.Sprintf("furi uses non-recommended scheme %q; the draft RECOMMENDS only http, https, mailto and tel. Non-recommended schemes may be unsafe; do NOT auto-follow without user confirmation.", scheme))
 				if scheme == "javascript" || scheme == "data" {
-					res.Messages = append(res.Messages, "Note: this scheme can be dangerous (may execute code or embed data). Treat as potentially unsafe and require manual review before following.")
+					res.add("note", "furi-scheme", "Note: this scheme can be dangerous (may execute code or embed data). Treat as potentially unsafe and require manual review before following.")
 				}
 			}
 		}
@@ -524,11 +3398,19 @@ func analyzeTXT(t *dns.TXT) recordResult {
 		warns, errs := checkUnicodeContent(val)
 		for _, w := range warns {
 			// for URIs, control characters are usually invalid; we treat errors strictly
-			res.Messages = append(res.Messages, "Warning: "+w)
+			res.add("warning", "unicode", w)
+		}
+		for _, w := range checkUnicodeSecurity(val) {
+			res.add("warning", "security", w)
+		}
+		if host := uriHost(val); host != "" {
+			for _, w := range checkHostSecurity(host) {
+				res.add("warning", "security", w)
+			}
 		}
 		if len(errs) > 0 {
 			for _, e := range errs {
-				res.Messages = append(res.Messages, "Error: "+e)
+				res.add("error", "unicode", e)
 			}
 			// Let validateURI also run, but mark invalid because of disallowed characters
 			res.Valid = false
@@ -537,47 +3419,47 @@ func analyzeTXT(t *dns.TXT) recordResult {
 
 		// Now run existing validation (which provides additional syntax/semantic checks).
 		if err := validateURI(val); err != nil {
-			res.Messages = append(res.Messages, fmt.Sprintf("furi parsing error: %v", err))
+			res.add("error", "furi", fmt.Sprintf("furi parsing error: %v", err))
 			// Per spec: URIs MUST conform; but since version tag is present, processors MAY treat as for sale while warning.
 			res.Valid = true
-			res.Messages = append(res.Messages, "Because the version tag is present, processors SHOULD treat the domain as for sale even if the furi value is syntactically invalid. This tool marks the record as ACCEPTED with warnings.")
+			res.add("note", "furi", "Because the version tag is present, processors SHOULD treat the domain as for sale even if the furi value is syntactically invalid. This tool marks the record as ACCEPTED with warnings.")
 			return res
 		}
 
 		// If we reached here, the URI parsed and passed validateURI checks.
 		res.Valid = true
-		res.Messages = append(res.Messages, "furi content tag contains a syntactically valid URI/IRI. Do NOT auto-redirect users to this URI without prompting (security risk).")
+		res.add("note", "furi", "furi content tag contains a syntactically valid URI/IRI. Do NOT auto-redirect users to this URI without prompting (security risk).")
 		return res
 
 	case "fval":
 		if len(val) < 2 {
-			res.Messages = append(res.Messages, "fval value too short (must be at least 2 characters: currency+amount).")
+			res.add("error", "fval", "fval value too short (must be at least 2 characters: currency+amount).")
 			res.Valid = false
 			return res
 		}
 		if len([]byte(val)) > 239 {
-			res.Messages = append(res.Messages, fmt.Sprintf("fval value byte length %d exceeds the draft's maximum of 239 characters for fval-value.", len([]byte(val))))
+			res.add("error", "fval", fmt.Sprintf("fval value byte length %d exceeds the draft's maximum of 239 characters for fval-value.", len([]byte(val))))
 			res.Valid = false
 			return res
 		}
 		if !fvalRe.MatchString(val) {
-			res.Messages = append(res.Messages, "fval value does not conform to the required format: <CURRENCY><AMOUNT>, e.g. USD750 or BTC0.000010. Currency MUST be uppercase letters; amount MUST be digits with optional fractional part.")
+			res.add("error", "fval", "fval value does not conform to the required format: <CURRENCY><AMOUNT>, e.g. USD750 or BTC0.000010. Currency MUST be uppercase letters; amount MUST be digits with optional fractional part.")
 			res.Valid = false
 			return res
 		}
 		idx := firstDigitIndex(val)
 		if idx <= 0 {
-			res.Messages = append(res.Messages, "Unable to separate currency code and amount in fval value.")
+			res.add("error", "fval", "Unable to separate currency code and amount in fval value.")
 			res.Valid = false
 			return res
 		}
 		_ = val[:idx] // currency (not strictly enforcing ISO4217)
 		res.Valid = true
-		res.Messages = append(res.Messages, "fval content tag is syntactically acceptable. Note: prices are indicative only; verify with seller.")
+		res.add("note", "fval", "fval content tag is syntactically acceptable. Note: prices are indicative only; verify with seller.")
 		return res
 
 	default:
-		res.Messages = append(res.Messages, fmt.Sprintf("Unknown content tag: %q", foundTag))
+		res.add("error", "content-tag", fmt.Sprintf("Unknown content tag: %q", foundTag))
 		res.Valid = false
 		return res
 	}
@@ -622,6 +3504,262 @@ func checkUnicodeContent(s string) (warnings []string, errorsOut []string) {
 	return
 }
 
+// sanitizePolicy selects what problematic code points in ftxt are replaced
+// with, per the Robustness section of the draft.
+type sanitizePolicy int
+
+const (
+	sanitizeSpace       sanitizePolicy = iota // replace with SPACE (U+0020)
+	sanitizeReplacement                       // replace with REPLACEMENT CHARACTER (U+FFFD)
+)
+
+// parseSanitizePolicy maps the command-line names "space" and "fffd" to a policy.
+func parseSanitizePolicy(s string) (sanitizePolicy, error) {
+	switch s {
+	case "space":
+		return sanitizeSpace, nil
+	case "fffd":
+		return sanitizeReplacement, nil
+	}
+	return 0, fmt.Errorf("unknown sanitise policy %q (use space or fffd)", s)
+}
+
+// isAssignable reports whether r is in the "Unicode Assignables" subset of
+// RFC 9839 section 4.3. Unlike the RFC, TAB, LF and CR are excluded as well,
+// since the draft says they are best avoided.
+func isAssignable(r rune) bool {
+	switch {
+	case r <= 0x1F || r == 0x7F: // C0 controls and DEL
+		return false
+	case r >= 0x80 && r <= 0x9F: // C1 controls
+		return false
+	case r >= 0xD800 && r <= 0xDFFF: // surrogates
+		return false
+	case r >= 0xFDD0 && r <= 0xFDEF, r&0xFFFE == 0xFFFE: // noncharacters
+		return false
+	}
+	return r <= unicode.MaxRune
+}
+
+// sanitizeText converts s to Network Unicode (RFC 5198): invalid UTF-8 is
+// replaced by U+FFFD, the text is normalised to NFC, and code points outside
+// the RFC 9839 subset are replaced according to policy.
+func sanitizeText(s string, policy sanitizePolicy) string {
+	repl := ' '
+	if policy == sanitizeReplacement {
+		repl = utf8.RuneError
+	}
+	s = norm.NFC.String(strings.ToValidUTF8(s, "\uFFFD"))
+	return strings.Map(func(r rune) rune {
+		if !isAssignable(r) {
+			return repl
+		}
+		return r
+	}, s)
+}
+
+// displaySafe is sanitizeText plus replacement of bidirectional embedding,
+// override and isolate controls, which are valid text but can reorder the
+// surrounding page when shown in a browser or terminal.
+func displaySafe(s string, policy sanitizePolicy) string {
+	repl := ' '
+	if policy == sanitizeReplacement {
+		repl = utf8.RuneError
+	}
+	return strings.Map(func(r rune) rune {
+		if (r >= 0x202A && r <= 0x202E) || (r >= 0x2066 && r <= 0x2069) {
+			return repl
+		}
+		return r
+	}, sanitizeText(s, policy))
+}
+
+// confusables maps code points to their UTS #39 prototype. Only a few common
+// look-alikes of Latin letters are built in; load the full confusables.txt
+// from unicode.org with loadConfusables for complete coverage.
+var confusables = map[rune]string{
+	'а': "a", 'в': "B", 'е': "e", 'к': "k", 'м': "M", 'н': "H", 'о': "o", 'р': "p",
+	'с': "c", 'т': "T", 'у': "y", 'х': "x", 'ѕ': "s", 'і': "i", 'ј': "j", 'һ': "h",
+	'ԁ': "d", 'ɡ': "g", 'ӏ': "l", 'ο': "o", 'α': "a", 'ν': "v", 'ρ': "p", 'ι': "i", 'κ': "k",
+	'τ': "t", 'υ': "u", 'χ': "x", 'ε': "e", 'ı': "i", 'ℓ': "l", '0': "O", '1': "l",
+}
+
+// protectedBrands maps the skeleton of each protected name to the name itself.
+var protectedBrands = map[string]string{}
+
+// loadConfusables reads confusables.txt (UTS #39 format: "0430 ;\t0061 ;\tMA\t# ...")
+// and adds its mappings to the built-in table.
+func loadConfusables(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	for n, line := range strings.Split(string(data), "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Split(line, ";")
+		if len(fields) < 2 {
+			continue
+		}
+		src, err := parseCodePoints(fields[0])
+		if err != nil || len(src) != 1 {
+			return fmt.Errorf("%s:%d: bad source code point", path, n+1)
+		}
+		dst, err := parseCodePoints(fields[1])
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", path, n+1, err)
+		}
+		confusables[src[0]] = string(dst)
+	}
+	return nil
+}
+
+// parseCodePoints parses space-separated hexadecimal code points.
+func parseCodePoints(s string) ([]rune, error) {
+	var out []rune
+	for _, f := range strings.Fields(s) {
+		v, err := strconv.ParseUint(f, 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("bad code point %q", f)
+		}
+		out = append(out, rune(v))
+	}
+	return out, nil
+}
+
+// loadBrands reads one protected name per line; empty lines and lines
+// starting with '#' are skipped.
+func loadBrands(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		protectedBrands[skeleton(line)] = line
+	}
+	return nil
+}
+
+// skeleton computes a UTS #39 style skeleton: the string is case-folded and
+// each code point is replaced by its prototype. Unlike UTS #39 no NFD
+// normalisation is done, so precomposed and decomposed forms may differ.
+func skeleton(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if p, ok := confusables[r]; ok {
+			b.WriteString(strings.ToLower(p))
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// checkUnicodeSecurity flags invisible characters that can be used to make
+// text look different from what it is: bidirectional formatting characters
+// (Trojan Source style reordering) and zero-width characters.
+func checkUnicodeSecurity(s string) (warnings []string) {
+	for i, r := range s {
+		switch {
+		case r >= 0x202A && r <= 0x202E, r >= 0x2066 && r <= 0x2069:
+			warnings = append(warnings, fmt.Sprintf("contains bidirectional override/isolate U+%04X at byte index %d; it can reorder how the text is displayed", r, i))
+		case r == 0x200E || r == 0x200F || r == 0x061C:
+			warnings = append(warnings, fmt.Sprintf("contains bidirectional mark U+%04X at byte index %d", r, i))
+		case r == 0x200B || r == 0x200C || r == 0x200D || r == 0x2060 || r == 0xFEFF:
+			warnings = append(warnings, fmt.Sprintf("contains zero-width character U+%04X at byte index %d; it is invisible when displayed", r, i))
+		}
+	}
+	return
+}
+
+// checkHostSecurity looks for homograph attacks in a host name: labels that
+// mix scripts, and names whose skeleton matches a protected brand without
+// being that brand. A-labels (xn--) are decoded first.
+func checkHostSecurity(host string) (warnings []string) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	labels := strings.Split(host, ".")
+	ulabels := make([]string, len(labels))
+	for i, l := range labels {
+		ulabels[i] = l
+		if strings.HasPrefix(l, "xn--") {
+			u, err := idna.Punycode.ToUnicode(l)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("host label %q is not valid Punycode: %v", l, err))
+				continue
+			}
+			ulabels[i] = u
+		}
+		if scripts := labelScripts(ulabels[i]); !allowedScriptMix(scripts) {
+			warnings = append(warnings, fmt.Sprintf("host label %q mixes scripts (%s); this is a common homograph technique", ulabels[i], strings.Join(scripts, ", ")))
+		}
+	}
+	if len(protectedBrands) == 0 {
+		return
+	}
+	// compare the full host and every label against the protected names
+	candidates := append([]string{strings.Join(ulabels, ".")}, ulabels...)
+	for _, c := range candidates {
+		if brand, ok := protectedBrands[skeleton(c)]; ok && c != strings.ToLower(brand) {
+			warnings = append(warnings, fmt.Sprintf("host %q is confusable with protected name %q", strings.Join(ulabels, "."), brand))
+			break
+		}
+	}
+	return
+}
+
+// labelScripts returns the sorted names of the scripts used in s, ignoring
+// Common and Inherited characters such as digits and hyphens.
+func labelScripts(s string) []string {
+	seen := map[string]bool{}
+	for _, r := range s {
+		for name, table := range unicode.Scripts {
+			if name == "Common" || name == "Inherited" {
+				continue
+			}
+			if unicode.Is(table, r) {
+				seen[name] = true
+				break
+			}
+		}
+	}
+	out := make([]string, 0, len(seen))
+	for name := range seen {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// allowedScriptMix implements the "Highly Restrictive" profile of UTS #39:
+// a single script, or Latin combined with one of the usual CJK sets.
+func allowedScriptMix(scripts []string) bool {
+	if len(scripts) <= 1 {
+		return true
+	}
+	for _, set := range [][]string{
+		{"Latin", "Han", "Hiragana", "Katakana"},
+		{"Latin", "Han", "Bopomofo"},
+		{"Latin", "Han", "Hangul"},
+	} {
+		ok := true
+		for _, s := range scripts {
+			if !slices.Contains(set, s) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
 // unescapePresentation decodes presentation-format escapes found in DNS zone file strings.
 // It supports:
 //   - \DDD where D are 1..3 decimal digits representing an octet value (0..255)
@@ -672,6 +3810,28 @@ func unescapePresentation(s string) ([]byte, error) {
 	return out, nil
 }
 
+// uriHost returns the host of an http(s) URI or the domain of a mailto URI,
+// or "" if there is none.
+func uriHost(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return ""
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return u.Hostname()
+	case "mailto":
+		addr := u.Opaque
+		if addr == "" {
+			addr = u.Path
+		}
+		if i := strings.LastIndexByte(addr, '@'); i >= 0 {
+			return strings.SplitN(addr[i+1:], ",", 2)[0]
+		}
+	}
+	return ""
+}
+
 func firstDigitIndex(s string) int {
 	for i := 0; i < len(s); i++ {
 		if s[i] >= '0' && s[i] <= '9' {
@@ -0,0 +1,1232 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestCheckHostSecurity(t *testing.T) {
+	defer func(b map[string]string) { protectedBrands = b }(protectedBrands)
+	protectedBrands = map[string]string{skeleton("apple.com"): "apple.com", skeleton("paypal"): "paypal"}
+
+	tests := []struct {
+		host string
+		want []string // substrings of the expected warnings, in order
+	}{
+		{"apple.com", nil},
+		{"www.bücher.example", nil},
+		{"xn--bcher-kva.example", nil},
+		// whole-script confusable: all Cyrillic, skeleton "apple.com"
+		{"xn--80ak6aa92e.com", []string{`host "аррӏе.com" is confusable with protected name "apple.com"`}},
+		// Cyrillic а in an otherwise Latin label
+		{"xn--pple-43d.com", []string{`host label "аpple" mixes scripts (Cyrillic, Latin)`, `confusable with protected name "apple.com"`}},
+		{"login.xn--pypl-53dc.example", []string{`host label "pаypаl" mixes scripts (Cyrillic, Latin)`, `confusable with protected name "paypal"`}},
+		{"xn--zz.example", []string{`host label "xn--zz" is not valid Punycode`}},
+		{"XN--BCHER-KVA.example", nil},
+	}
+	for _, tt := range tests {
+		got := checkHostSecurity(tt.host)
+		if len(got) != len(tt.want) {
+			t.Errorf("checkHostSecurity(%q) = %q, want %d warnings", tt.host, got, len(tt.want))
+			continue
+		}
+		for i, w := range tt.want {
+			if !strings.Contains(got[i], w) {
+				t.Errorf("checkHostSecurity(%q)[%d] = %q, want it to contain %q", tt.host, i, got[i], w)
+			}
+		}
+	}
+}
+
+// The sample strings of RFC 3492 section 7.1 are single-script (or an
+// allowed mix with Han) and must decode without warnings.
+func TestCheckHostSecurityRFC3492Samples(t *testing.T) {
+	for _, label := range []string{
+		"egbpdaj6bu4bxfgehfvwxn",                       // (A) Arabic (Egyptian)
+		"ihqwcrb4cv8a8dqg056pqjye",                     // (B) Chinese (simplified)
+		"ihqwctvzc91f659drss3x8bo0yb",                  // (C) Chinese (traditional)
+		"Proprostnemluvesky-uyb24dma41a",               // (D) Czech
+		"4dbcagdahymbxekheh6e0a7fei0b",                 // (E) Hebrew
+		"i1baa7eci9glrd9b2ae1bj0hfcgg6iyaf8o0a1dig0cd", // (F) Hindi (Devanagari)
+		"n8jok5ay5dzabd5bym9f0cm5685rrjetr6pdxa",       // (G) Japanese (kanji and hiragana)
+		"b1abfaaepdrnnbgefbadotcwatmq2g4l",             // (I) Russian (Cyrillic)
+		"3B-ww4c5e180e575a65lsy2b",                     // (L) Japanese with Latin
+		"-with-SUPER-MONKEYS-pc58ag80a8qai00g7n9n",     // (M) Japanese with Latin
+	} {
+		if got := checkHostSecurity("xn--" + label + ".example"); len(got) != 0 {
+			t.Errorf("checkHostSecurity(xn--%s) = %q, want no warnings", label, got)
+		}
+	}
+}
+
+func TestCheckUnicodeSecurity(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []string
+	}{
+		{"For sale, call us", nil},
+		{"price ‮EUR 100", []string{"bidirectional override/isolate U+202E at byte index 6"}},
+		{"⁧x⁩", []string{"U+2067 at byte index 0", "U+2069 at byte index 4"}},
+		{"a‏b", []string{"bidirectional mark U+200F"}},
+		{"zero​width", []string{"zero-width character U+200B at byte index 4"}},
+	}
+	for _, tt := range tests {
+		got := checkUnicodeSecurity(tt.s)
+		if len(got) != len(tt.want) {
+			t.Errorf("checkUnicodeSecurity(%q) = %q, want %d warnings", tt.s, got, len(tt.want))
+			continue
+		}
+		for i, w := range tt.want {
+			if !strings.Contains(got[i], w) {
+				t.Errorf("checkUnicodeSecurity(%q)[%d] = %q, want it to contain %q", tt.s, i, got[i], w)
+			}
+		}
+	}
+}
+
+const testPSL = `// ===BEGIN ICANN DOMAINS===
+com
+jp
+ac.jp
+*.kawasaki.jp
+!city.kawasaki.jp
+*.ck
+!www.ck
+uk
+co.uk
+cn
+公司.cn   // trailing text after the rule is ignored
+`
+
+func TestClassifyPlacement(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "public_suffix_list.dat")
+	if err := os.WriteFile(path, []byte(testPSL), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	l, err := loadPublicSuffixList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		domain, class, suffix, registrable string
+	}{
+		{"com", "public_suffix", "com", ""},
+		{"example.com", "registrable", "com", "example.com"},
+		{"EXAMPLE.COM.", "registrable", "com", "example.com"},
+		{"a.b.example.com", "subdomain", "com", "example.com"},
+		{"example.co.uk", "registrable", "co.uk", "example.co.uk"},
+		{"co.uk", "public_suffix", "co.uk", ""},
+		{"test.ac.jp", "registrable", "ac.jp", "test.ac.jp"},
+		// wildcard rule and its exception
+		{"c.kawasaki.jp", "public_suffix", "c.kawasaki.jp", ""},
+		{"b.c.kawasaki.jp", "registrable", "c.kawasaki.jp", "b.c.kawasaki.jp"},
+		{"city.kawasaki.jp", "registrable", "kawasaki.jp", "city.kawasaki.jp"},
+		{"www.city.kawasaki.jp", "subdomain", "kawasaki.jp", "city.kawasaki.jp"},
+		{"www.ck", "registrable", "ck", "www.ck"},
+		{"x.y.ck", "registrable", "y.ck", "x.y.ck"},
+		// rules are in Unicode, names in A-labels
+		{"xn--55qx5d.cn", "public_suffix", "xn--55qx5d.cn", ""},
+		{"example.xn--55qx5d.cn", "registrable", "xn--55qx5d.cn", "example.xn--55qx5d.cn"},
+		// not listed: the implicit "*" rule
+		{"example.unlisted", "registrable", "unlisted", "example.unlisted"},
+	}
+	for _, tt := range tests {
+		p := l.classifyPlacement(tt.domain)
+		if p.Class != tt.class || p.PublicSuffix != tt.suffix || p.RegistrableDomain != tt.registrable {
+			t.Errorf("classifyPlacement(%q) = %s, %q, %q; want %s, %q, %q", tt.domain,
+				p.Class, p.PublicSuffix, p.RegistrableDomain, tt.class, tt.suffix, tt.registrable)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("// only comments\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadPublicSuffixList(path); err == nil {
+		t.Error("list without rules accepted")
+	}
+}
+
+func TestLookupSpecialUse(t *testing.T) {
+	defer func(m map[string]specialUse) { specialUseNames = m }(maps.Clone(specialUseNames))
+	path := filepath.Join(t.TempDir(), "special-use-domain.csv")
+	iana := "Name,Reference\n6tisch.arpa.,[RFC9031]\nhome.arpa.,\"[RFC8375]\"\nresolver.arpa.,[RFC9462]\nONION.,[RFC7686]\n"
+	if err := os.WriteFile(path, []byte(iana), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadSpecialUseNames(path); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		domain, name, ref string
+	}{
+		{"example.com", "", ""},
+		{"arpa", "arpa", "RFC 3172"},
+		// the shortest match wins
+		{"router.home.arpa.", "arpa", "RFC 3172"},
+		{"Foo.Onion", "onion", "RFC 7686"},
+		{"printer.local", "local", "RFC 6762"},
+		{"x.example", "example", "RFC 6761"},
+		{"example.net", "", ""},
+	}
+	for _, tt := range tests {
+		su, ok := lookupSpecialUse(tt.domain)
+		if ok != (tt.name != "") || su.Name != tt.name || su.Reference != tt.ref {
+			t.Errorf("lookupSpecialUse(%q) = %+v, %v; want %q (%s)", tt.domain, su, ok, tt.name, tt.ref)
+		}
+	}
+	if su := specialUseNames["home.arpa"]; su.Reference != "RFC 8375" || su.Reason == "" {
+		t.Errorf("registry entry home.arpa = %+v", su)
+	}
+	// built-in entries keep their reason
+	if su := specialUseNames["onion"]; !strings.Contains(su.Reason, "Tor") {
+		t.Errorf("built-in entry onion replaced by the registry: %+v", su)
+	}
+}
+
+func TestParseRecordArg(t *testing.T) {
+	const owner = "_for-sale.example.nl."
+	tests := []struct {
+		arg   string
+		name  string
+		ttl   uint32
+		txt   []string
+		isErr bool
+	}{
+		{"v=FORSALE1;fval=EUR5", owner, 3600, []string{"v=FORSALE1;fval=EUR5"}, false},
+		// raw RDATA that happens to contain "TXT"
+		{"v=FORSALE1;ftxt=Buy TXT records here", owner, 3600, []string{"v=FORSALE1;ftxt=Buy TXT records here"}, false},
+		{`v=FORSALE1;ftxt=say "hi"`, owner, 3600, []string{`v=FORSALE1;ftxt=say \"hi\"`}, false},
+		{`"v=FORSALE1;" "fval=EUR5"`, owner, 3600, []string{"v=FORSALE1;", "fval=EUR5"}, false},
+		{`_for-sale.example.nl. 300 IN TXT "v=FORSALE1;fcod=X"`, owner, 300, []string{"v=FORSALE1;fcod=X"}, false},
+		// relative owners are relative to the domain, as in -zone-snippet
+		{`_for-sale 3600 IN TXT "v=FORSALE1;fval=EUR5"`, owner, 3600, []string{"v=FORSALE1;fval=EUR5"}, false},
+		{`_FOR-SALE 1h TXT "v=FORSALE1;"`, "_FOR-SALE.example.nl.", 3600, []string{"v=FORSALE1;"}, false},
+		{`_for-sale IN 600 TXT "v=FORSALE1;" ; comment`, owner, 600, []string{"v=FORSALE1;"}, false},
+		// an RR at another name is rejected
+		{`_for-sale.example.org. 300 IN TXT "v=FORSALE1;fcod=X"`, "", 0, nil, true},
+		{`@ TXT "v=FORSALE1;"`, "", 0, nil, true},
+		{`_forsale 3600 IN TXT "v=FORSALE1;fval=EUR5"`, "", 0, nil, true},
+		{`www._for-sale IN TXT "v=FORSALE1;"`, "", 0, nil, true},
+		// not TXT: raw RDATA, which the validator then rejects
+		{`_for-sale.example.org. IN A 192.0.2.1`, owner, 3600, []string{"_for-sale.example.org. IN A 192.0.2.1"}, false},
+		{`_for-sale IN A 192.0.2.1`, owner, 3600, []string{"_for-sale IN A 192.0.2.1"}, false},
+		{"v=FORSALE1;ftxt=TXT TXT", owner, 3600, []string{"v=FORSALE1;ftxt=TXT TXT"}, false},
+		{`"unterminated`, "", 0, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseRecordArg(tt.arg, owner, 3600)
+		if tt.isErr {
+			if err == nil {
+				t.Errorf("parseRecordArg(%q) = %v, want an error", tt.arg, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseRecordArg(%q): %v", tt.arg, err)
+			continue
+		}
+		if got.Hdr.Name != tt.name || got.Hdr.Ttl != tt.ttl || !slices.Equal(got.Txt, tt.txt) {
+			t.Errorf("parseRecordArg(%q) = %s %d %q, want %s %d %q", tt.arg, got.Hdr.Name, got.Hdr.Ttl, got.Txt, tt.name, tt.ttl, tt.txt)
+		}
+	}
+
+	// without a domain, the owner of an RR decides
+	for arg, want := range map[string]string{
+		`_for-sale.example.org. 300 IN TXT "v=FORSALE1;"`: "_for-sale.example.org.",
+		`_for-sale TXT "v=FORSALE1;"`:                     "_for-sale.",
+		`@ TXT "v=FORSALE1;"`:                             ".",
+	} {
+		if got, err := parseRecordArg(arg, "_for-sale.", 3600); err != nil || got.Hdr.Name != want {
+			t.Errorf("parseRecordArg(%q) without a domain = %v, %v; want owner %s", arg, got, err, want)
+		}
+	}
+
+	// raw RDATA is split into character-strings of at most 255 octets
+	long := "v=FORSALE1;ftxt=" + strings.Repeat("x", 300)
+	got, err := parseRecordArg(long, owner, 3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Txt) != 2 || len(got.Txt[0]) != 255 || got.Txt[0]+got.Txt[1] != long {
+		t.Errorf("parseRecordArg(316 octets) = %d strings", len(got.Txt))
+	}
+}
+
+func TestParseZoneTXT(t *testing.T) {
+	snippet := `$TTL 600
+_for-sale  IN TXT "v=FORSALE1;fval=EUR5"
+_for-sale  3600 IN TXT "v=FORSALE1;" "fcod=AB-1"
+www        IN A   192.0.2.1
+_for-sale.other.nl. TXT "v=FORSALE1;"
+`
+	txts, err := parseZoneTXT(strings.NewReader(snippet), "example.nl", "snippet", 3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		name string
+		ttl  uint32
+		txt  []string
+	}{
+		{"_for-sale.example.nl.", 600, []string{"v=FORSALE1;fval=EUR5"}},
+		{"_for-sale.example.nl.", 3600, []string{"v=FORSALE1;", "fcod=AB-1"}},
+		{"_for-sale.other.nl.", 600, []string{"v=FORSALE1;"}},
+	}
+	if len(txts) != len(want) {
+		t.Fatalf("parseZoneTXT = %d records, want %d", len(txts), len(want))
+	}
+	for i, w := range want {
+		if txts[i].Hdr.Name != w.name || txts[i].Hdr.Ttl != w.ttl || !slices.Equal(txts[i].Txt, w.txt) {
+			t.Errorf("record %d = %s %d %q, want %s %d %q", i, txts[i].Hdr.Name, txts[i].Hdr.Ttl, txts[i].Txt, w.name, w.ttl, w.txt)
+		}
+	}
+	if _, err := parseZoneTXT(strings.NewReader("_for-sale IN TXT \"open\n"), "example.nl", "snippet", 3600); err == nil {
+		t.Error("parseZoneTXT accepted an unterminated string")
+	}
+}
+
+func TestUnpackCharacterStrings(t *testing.T) {
+	tests := []struct {
+		rdata []byte
+		want  []string
+		isErr bool
+	}{
+		{[]byte{}, nil, false},
+		{[]byte{0}, []string{""}, false},
+		{[]byte("\x0bv=FORSALE1;"), []string{"v=FORSALE1;"}, false},
+		{[]byte("\x03abc\x02de"), []string{"abc", "de"}, false},
+		{[]byte("\x05abc"), nil, true},
+		{[]byte("\x01a\x02b"), nil, true},
+	}
+	for _, tt := range tests {
+		got, err := unpackCharacterStrings(tt.rdata)
+		if (err != nil) != tt.isErr {
+			t.Errorf("unpackCharacterStrings(%q) error = %v, want error %v", tt.rdata, err, tt.isErr)
+			continue
+		}
+		var s []string
+		for _, b := range got {
+			s = append(s, string(b))
+		}
+		if !slices.Equal(s, tt.want) {
+			t.Errorf("unpackCharacterStrings(%q) = %q, want %q", tt.rdata, s, tt.want)
+		}
+	}
+}
+
+func TestUnpackWireTXT(t *testing.T) {
+	m := new(dns.Msg)
+	m.SetQuestion("_for-sale.example.nl.", dns.TypeTXT)
+	m.Response = true
+	m.Answer = []dns.RR{
+		&dns.CNAME{Hdr: dns.RR_Header{Name: "_for-sale.example.nl.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 60}, Target: "_for-sale.example.com."},
+		// octets that have no exact presentation form survive as they are
+		&dns.TXT{Hdr: dns.RR_Header{Name: "_for-sale.example.com.", Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 300}, Txt: []string{`v=FORSALE1;ftxt=caf\195\169 \"x\"`, `\255`}},
+	}
+	m.Compress = true
+	msg, err := m.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	txts, err := unpackWireTXT(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txts) != 1 {
+		t.Fatalf("unpackWireTXT = %d TXT RRs, want 1", len(txts))
+	}
+	w := txts[0]
+	if w.Name != "_for-sale.example.com." || w.TTL != 300 || len(w.Strings) != 2 ||
+		string(w.Strings[0]) != `v=FORSALE1;ftxt=café "x"` || string(w.Strings[1]) != "\xff" {
+		t.Errorf("unpackWireTXT = %s %d %q", w.Name, w.TTL, w.Strings)
+	}
+	if got := w.txt().Txt; got[0] != `v=FORSALE1;ftxt=caf\195\169 \"x\"` || got[1] != `\255` {
+		t.Errorf("txt() = %q", got)
+	}
+
+	res := analyzeWireTXT(w.txt(), w.Strings)
+	if res.Content != "v=FORSALE1;ftxt=café \"x\"\xff" || !slices.Equal(res.RawDecodedLens, []int{25, 1}) {
+		t.Errorf("analyzeWireTXT: content %q, lengths %v", res.Content, res.RawDecodedLens)
+	}
+
+	// truncated messages are errors, not panics
+	for _, n := range []int{5, 20, len(msg) - 3} {
+		if _, err := unpackWireTXT(msg[:n]); err == nil {
+			t.Errorf("unpackWireTXT of %d of %d octets: no error", n, len(msg))
+		}
+	}
+}
+
+func TestComparisonRank(t *testing.T) {
+	type answer struct {
+		variant        int // 1-based index into the variants below, 0 when failed
+		aa             bool
+		ttlMin, ttlMax uint32
+	}
+	records := [][]string{{"v=FORSALE1;fval=EUR5"}, {"v=FORSALE1;fval=EUR9"}, nil}
+	tests := []struct {
+		name       string
+		answers    []answer
+		status     []string
+		consistent bool
+		ttlsDiffer bool
+	}{
+		{"same answer, TTLs counting down", []answer{{1, false, 300, 300}, {1, false, 120, 120}}, []string{"consensus", "consensus"}, true, false},
+		{"older RRset", []answer{{1, false, 3000, 3000}, {1, false, 2000, 2000}, {2, false, 500, 500}}, []string{"consensus", "consensus", "stale"}, false, false},
+		{"newer RRset", []answer{{1, false, 3000, 3000}, {2, false, 3500, 3500}, {1, false, 2000, 2000}}, []string{"consensus", "differs", "consensus"}, false, false},
+		{"authoritative is not stale", []answer{{1, false, 3000, 3000}, {1, false, 2000, 2000}, {2, true, 60, 60}}, []string{"consensus", "consensus", "differs"}, false, false},
+		{"missing", []answer{{1, false, 300, 300}, {3, false, 0, 0}, {1, false, 300, 300}}, []string{"consensus", "missing", "consensus"}, false, false},
+		{"extra", []answer{{3, false, 0, 0}, {1, false, 300, 300}, {3, false, 0, 0}}, []string{"consensus", "extra", "consensus"}, false, false},
+		{"failed", []answer{{1, false, 300, 300}, {0, false, 0, 0}}, []string{"consensus", "failed"}, false, false},
+		{"mixed TTLs in one RRset", []answer{{1, false, 300, 600}, {1, false, 300, 300}}, []string{"consensus", "consensus"}, false, true},
+		{"authoritative TTLs differ", []answer{{1, true, 300, 300}, {1, true, 600, 600}}, []string{"consensus", "consensus"}, false, true},
+		{"cache above the authoritative TTL", []answer{{1, true, 300, 300}, {1, false, 86400, 86400}}, []string{"consensus", "consensus"}, false, true},
+	}
+	for _, tt := range tests {
+		cmp := &comparison{}
+		for i, a := range tt.answers {
+			ra := resolverAnswer{Name: "r", Server: fmt.Sprintf("192.0.2.%d:53", i+1), Variant: a.variant, TTLMin: a.ttlMin, TTLMax: a.ttlMax, Response: &responseInfo{AA: a.aa}}
+			if a.variant == 0 {
+				ra.Status = "failed"
+			} else {
+				for len(cmp.Variants) < a.variant {
+					cmp.Variants = append(cmp.Variants, answerVariant{Rcode: "NOERROR"})
+				}
+				v := &cmp.Variants[a.variant-1]
+				v.Records = records[a.variant-1]
+				v.Resolvers = append(v.Resolvers, ra.Name)
+				v.Servers = append(v.Servers, ra.Server)
+			}
+			cmp.Resolvers = append(cmp.Resolvers, ra)
+		}
+		first := cmp.rank()
+		var status []string
+		for _, ra := range cmp.Resolvers {
+			status = append(status, ra.Status)
+		}
+		if !slices.Equal(status, tt.status) || cmp.Consistent != tt.consistent || cmp.TTLsDiffer != tt.ttlsDiffer {
+			t.Errorf("%s: status %q, consistent %v, ttls differ %v; want %q, %v, %v", tt.name, status, cmp.Consistent, cmp.TTLsDiffer, tt.status, tt.consistent, tt.ttlsDiffer)
+		}
+		if cmp.Resolvers[first].Status != "consensus" || len(cmp.Variants[0].Servers) != len(cmp.Variants[0].Resolvers) {
+			t.Errorf("%s: first = %d, majority variant %+v", tt.name, first, cmp.Variants[0])
+		}
+	}
+}
+
+func TestSanitizeText(t *testing.T) {
+	tests := []struct {
+		name        string
+		in          string
+		space, fffd string
+	}{
+		{"plain", "Te koop!", "Te koop!", "Te koop!"},
+		{"NFC", "e\u0301te\u0301", "\u00e9t\u00e9", "\u00e9t\u00e9"},
+		{"NFC of a singleton", "\u212b", "\u00c5", "\u00c5"}, // ANGSTROM SIGN
+		{"invalid UTF-8", "a\xff\xfeb", "a\ufffdb", "a\ufffdb"},
+		{"C0 controls", "a\tb\nc\x00d", "a b c d", "a\ufffdb\ufffdc\ufffdd"},
+		{"DEL", "a\x7fb", "a b", "a\ufffdb"},
+		{"C1 controls", "a\u0085b\u009fc", "a b c", "a\ufffdb\ufffdc"},
+		{"noncharacters", "a\ufdd0b\ufffec\U0001ffffd", "a b c d", "a\ufffdb\ufffdc\ufffdd"},
+		{"bidi controls kept", "a\u202eb", "a\u202eb", "a\u202eb"},
+	}
+	for _, tt := range tests {
+		if got := sanitizeText(tt.in, sanitizeSpace); got != tt.space {
+			t.Errorf("%s: sanitizeText(%q, space) = %q, want %q", tt.name, tt.in, got, tt.space)
+		}
+		if got := sanitizeText(tt.in, sanitizeReplacement); got != tt.fffd {
+			t.Errorf("%s: sanitizeText(%q, fffd) = %q, want %q", tt.name, tt.in, got, tt.fffd)
+		}
+	}
+}
+
+func TestDisplaySafe(t *testing.T) {
+	tests := []struct {
+		in          string
+		space, fffd string
+	}{
+		{"abc\u202efed", "abc fed", "abc\ufffdfed"},                      // RIGHT-TO-LEFT OVERRIDE
+		{"\u2066x\u2069", " x ", "\ufffdx\ufffd"},                        // isolates
+		{"\u202a\u202b\u202c\u202d", "    ", "\ufffd\ufffd\ufffd\ufffd"}, // embeddings and overrides
+		{"a\u200fb", "a\u200fb", "a\u200fb"},                             // RIGHT-TO-LEFT MARK is text
+		{"\u00e9\x01", "\u00e9 ", "\u00e9\ufffd"},
+	}
+	for _, tt := range tests {
+		if got := displaySafe(tt.in, sanitizeSpace); got != tt.space {
+			t.Errorf("displaySafe(%q, space) = %q, want %q", tt.in, got, tt.space)
+		}
+		if got := displaySafe(tt.in, sanitizeReplacement); got != tt.fffd {
+			t.Errorf("displaySafe(%q, fffd) = %q, want %q", tt.in, got, tt.fffd)
+		}
+	}
+}
+
+func TestParseSanitizePolicy(t *testing.T) {
+	for s, want := range map[string]sanitizePolicy{"space": sanitizeSpace, "fffd": sanitizeReplacement} {
+		if got, err := parseSanitizePolicy(s); err != nil || got != want {
+			t.Errorf("parseSanitizePolicy(%q) = %v, %v; want %v", s, got, err, want)
+		}
+	}
+	if _, err := parseSanitizePolicy("drop"); err == nil {
+		t.Error(`parseSanitizePolicy("drop") accepted`)
+	}
+}
+
+const testRDAP = `{
+  "objectClassName": "domain",
+  "ldhName": "example.nl",
+  "status": ["active", "client transfer prohibited"],
+  "entities": [{
+    "objectClassName": "entity",
+    "roles": ["registrar"],
+    "vcardArray": ["vcard", [
+      ["version", {}, "text", "4.0"],
+      ["fn", {}, "text", "Example Registrar B.V."],
+      ["url", {}, "uri", "https://registrar.example/"],
+      ["tel", {"type": "voice"}, "uri", "tel:+31.701234567"],
+      ["tel", {"type": "fax"}, "uri", "tel:+31.707654321"]
+    ]],
+    "entities": [{
+      "roles": ["abuse"],
+      "vcardArray": ["vcard", [
+        ["version", {}, "text", "4.0"],
+        ["fn", {}, "text", ""],
+        ["email", {}, "text", "abuse@registrar.example"]
+      ]]
+    }]
+  }, {
+    "roles": ["technical"],
+    "vcardArray": ["vcard", [["version", {}, "text", "4.0"]]]
+  }, {
+    "roles": ["registrant"],
+    "vcardArray": ["not a vcard"]
+  }]
+}`
+
+// startRDAP starts an RDAP stand-in that knows example.nl, and points the
+// bootstrap for .nl at it. WHOIS is off and the settings are restored after
+// the test.
+func startRDAP(t *testing.T) *httptest.Server {
+	t.Helper()
+	defer func(s map[string][]string, f bool, w string) {
+		t.Cleanup(func() { rdapServices, whoisFallback, whoisServer = s, f, w })
+	}(rdapServices, whoisFallback, whoisServer)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "application/rdap+json" {
+			http.Error(w, "wrong Accept header", http.StatusNotAcceptable)
+			return
+		}
+		if r.URL.Path != "/rdap/domain/example.nl" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/rdap+json")
+		io.WriteString(w, testRDAP)
+	}))
+	t.Cleanup(srv.Close)
+
+	path := filepath.Join(t.TempDir(), "dns.json")
+	bootstrap := fmt.Sprintf(`{"version": "1.0", "services": [
+		[["nl", "frl"], ["%s/rdap"]],
+		[["com"], ["http://rdap.invalid/", "https://rdap.invalid/secure/"]]
+	]}`, srv.URL)
+	if err := os.WriteFile(path, []byte(bootstrap), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadRDAPBootstrap(path); err != nil {
+		t.Fatal(err)
+	}
+	whoisFallback, whoisServer = false, ""
+	return srv
+}
+
+// startWHOIS starts a port-43 stand-in that gives answer to every query.
+func startWHOIS(t *testing.T, answer string) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			bufio.NewReader(conn).ReadString('\n')
+			io.WriteString(conn, answer)
+			conn.Close()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestRDAPBaseURL(t *testing.T) {
+	srv := startRDAP(t)
+	tests := []struct{ domain, want string }{
+		{"example.nl", srv.URL + "/rdap/"},
+		{"Sub.Example.FRL.", srv.URL + "/rdap/"},
+		{"example.com", "https://rdap.invalid/secure/"},
+		{"example.org", ""},
+	}
+	for _, tt := range tests {
+		if got := rdapBaseURL(tt.domain); got != tt.want {
+			t.Errorf("rdapBaseURL(%q) = %q, want %q", tt.domain, got, tt.want)
+		}
+	}
+}
+
+func TestLookupRDAP(t *testing.T) {
+	srv := startRDAP(t)
+	info, err := lookupRegistration(context.Background(), "example.nl.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &registrationInfo{
+		Source: "rdap",
+		Server: strings.TrimPrefix(srv.URL, "http://"),
+		Contacts: []contact{
+			{Role: "registrar", Name: "Example Registrar B.V.", Phone: "+31.701234567", URL: "https://registrar.example/"},
+			{Role: "abuse", Email: "abuse@registrar.example"},
+		},
+		Status: []string{"active", "client transfer prohibited"},
+	}
+	if fmt.Sprint(info) != fmt.Sprint(want) {
+		t.Errorf("lookupRegistration = %+v\nwant %+v", info, want)
+	}
+
+	if _, err := lookupRegistration(context.Background(), "gone.nl"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("unknown domain without WHOIS fallback: error %v, want the RDAP status", err)
+	}
+	if _, err := lookupRegistration(context.Background(), "example.org"); err == nil {
+		t.Error("domain without an RDAP service: no error")
+	}
+}
+
+func TestLookupRegistrationWHOISFallback(t *testing.T) {
+	startRDAP(t)
+	whoisFallback = true
+	whoisServer = startWHOIS(t, "Domain name: gone.nl\r\nStatus: in quarantine\r\n\r\nRegistrar:\r\n   Example Registrar B.V.\r\n")
+
+	info, err := lookupRegistration(context.Background(), "gone.nl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Source != "whois" || info.Server != whoisServer ||
+		len(info.Contacts) != 1 || info.Contacts[0].Name != "Example Registrar B.V." ||
+		unreliableRegistryStatus(info.Status) != "redemption" {
+		t.Errorf("lookupRegistration after RDAP 404 = %+v, want the WHOIS answer", info)
+	}
+
+	// a successful RDAP answer is used as is
+	if info, err := lookupRegistration(context.Background(), "example.nl"); err != nil || info.Source != "rdap" {
+		t.Errorf("lookupRegistration(example.nl) = %+v, %v; want the RDAP answer", info, err)
+	}
+
+	whoisServer = "127.0.0.1:1"
+	if _, err := lookupRegistration(context.Background(), "gone.nl"); err == nil ||
+		!strings.Contains(err.Error(), "RDAP:") || !strings.Contains(err.Error(), "WHOIS:") {
+		t.Errorf("both failing: error %v, want both reasons", err)
+	}
+}
+
+func TestParseWHOIS(t *testing.T) {
+	tests := []struct {
+		name     string
+		answer   string
+		contacts []contact
+		status   []string
+	}{
+		{
+			"gTLD",
+			"Domain Name: EXAMPLE.COM\r\n" +
+				"Registrar URL: http://www.registrar.example\r\n" +
+				"Registrar: Example Registrar, Inc.\r\n" +
+				"Registrar Abuse Contact Email: abuse@registrar.example\r\n" +
+				"Registrar Abuse Contact Phone: +1.5555551234\r\n" +
+				"Domain Status: clientTransferProhibited https://icann.org/epp#clientTransferProhibited\r\n" +
+				"Domain Status: pendingDelete https://icann.org/epp#pendingDelete\r\n",
+			[]contact{
+				{Role: "registrar", Name: "Example Registrar, Inc.", URL: "http://www.registrar.example"},
+				{Role: "abuse", Email: "abuse@registrar.example", Phone: "+1.5555551234"},
+			},
+			[]string{"clientTransferProhibited https://icann.org/epp#clientTransferProhibited", "pendingDelete https://icann.org/epp#pendingDelete"},
+		},
+		{
+			"ccTLD blocks",
+			"Domain name: example.nl\nStatus: active\n\nRegistrar:\n   Example Registrar B.V.\n   Postbus 1\n\nAbuse Contact:\n   abuse@registrar.example\n",
+			[]contact{
+				{Role: "registrar", Name: "Example Registrar B.V."},
+				{Role: "abuse", Email: "abuse@registrar.example"},
+			},
+			[]string{"active"},
+		},
+		{
+			"first registrar wins",
+			"Sponsoring Registrar: First\nRegistrar Name: Second\n",
+			[]contact{{Role: "registrar", Name: "First"}},
+			nil,
+		},
+		{
+			"nothing known",
+			"% No match for \"example.invalid\"\nNOT FOUND\nRegistrar:\n\n>>> Last update: 2026-01-01 <<<\n",
+			nil,
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		contacts, status := parseWHOIS(tt.answer)
+		if !slices.Equal(contacts, tt.contacts) || !slices.Equal(status, tt.status) {
+			t.Errorf("%s: parseWHOIS = %+v, %q; want %+v, %q", tt.name, contacts, status, tt.contacts, tt.status)
+		}
+	}
+}
+
+func TestUnreliableRegistryStatus(t *testing.T) {
+	tests := []struct {
+		statuses []string
+		want     string
+	}{
+		{[]string{"pending delete"}, "pendingDelete"},
+		{[]string{"pendingDelete https://icann.org/epp#pendingDelete"}, "pendingDelete"},
+		{[]string{"redemptionPeriod"}, "redemption"},
+		{[]string{"redemption period"}, "redemption"},
+		{[]string{"inQuarantine"}, "redemption"},
+		{[]string{"in quarantine"}, "redemption"},
+		{[]string{"pending_restore"}, "pendingRestore"},
+		{[]string{"active"}, ""},
+		{[]string{"ok https://icann.org/epp#ok"}, ""},
+		{[]string{"client transfer prohibited", "pending delete"}, "pendingDelete"},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := unreliableRegistryStatus(tt.statuses); got != tt.want {
+			t.Errorf("unreliableRegistryStatus(%q) = %q, want %q", tt.statuses, got, tt.want)
+		}
+	}
+}
+
+// update rewrites the golden files: go test fs-check-new.go fs-check-new_test.go -update
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/fs-check-new")
+
+// collectReports runs check with the machine-readable output on, and
+// returns its reports and exit code.
+func collectReports(t *testing.T, check func(opts checkOptions) int) ([]jsonOutput, int) {
+	t.Helper()
+	defer func(saved []jsonOutput) { reports = saved }(reports)
+	reports = nil
+	code := check(checkOptions{format: "json"})
+	return reports, code
+}
+
+// testReports is a batch of offline records, with valid, invalid, ignored
+// and out-of-scope ones, and a failed check.
+func testReports(t *testing.T) ([]jsonOutput, int) {
+	return collectReports(t, func(opts checkOptions) int {
+		code := checkOffline("", []string{
+			`_for-sale.example.nl. 3600 IN TXT "v=FORSALE1;fval=EUR999"`,
+			`_for-sale.example.nl. 3600 IN TXT "v=FORSALE1;fval=eur10"`,
+			`_for-sale.example.nl. 600 IN TXT "for sale, call us"`,
+			`_for-sale.example.org. 3600 IN TXT "v=FORSALE1;ftxt=<b>call</b>" " us"`,
+			`_for-sale.example.test. 3600 IN TXT "v=FORSALE1;"`,
+		}, "", 3600, opts)
+		if checkFailed("_for-sale.example.com.", "DNS query failed: read udp: i/o timeout", opts) == 3 {
+			code = 3
+		}
+		return code
+	})
+}
+
+func TestReportWritersGolden(t *testing.T) {
+	out, code := testReports(t)
+	if code != 3 {
+		t.Fatalf("exit code %d, want 3", code)
+	}
+	for _, format := range slices.Sorted(maps.Keys(reportWriters)) {
+		var buf bytes.Buffer
+		if err := reportWriters[format](&buf, out, code); err != nil {
+			t.Errorf("%s: %v", format, err)
+			continue
+		}
+		path := filepath.Join("testdata", "fs-check-new", "report."+format)
+		if *update {
+			if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), want) {
+			t.Errorf("%s output differs from %s (run with -update to accept):\n%s", format, path, buf.String())
+		}
+	}
+}
+
+func TestTAPMatchesExitCode(t *testing.T) {
+	tests := []struct {
+		name    string
+		records []string
+	}{
+		{"valid", []string{`_for-sale.example.nl. IN TXT "v=FORSALE1;fval=EUR999"`}},
+		{"valid and ignored", []string{`_for-sale.example.nl. IN TXT "v=FORSALE1;fval=EUR999"`, `_for-sale.example.nl. IN TXT "call us"`}},
+		{"valid in batch", []string{`_for-sale.example.nl. IN TXT "v=FORSALE1;fval=EUR999"`, `_for-sale.example.org. IN TXT "v=FORSALE1;fval=eur10"`, `_for-sale.example.test. IN TXT "v=FORSALE1;"`}},
+		{"invalid", []string{`_for-sale.example.nl. IN TXT "v=FORSALE1;fval=eur10"`}},
+		{"ignored", []string{`_for-sale.example.nl. IN TXT "call us"`}},
+		{"out of scope", []string{`_for-sale.example.test. IN TXT "v=FORSALE1;"`}},
+		{"below _for-sale", []string{`www._for-sale.example.nl. IN TXT "v=FORSALE1;"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, code := collectReports(t, func(opts checkOptions) int {
+				return checkOffline("", tt.records, "", 3600, opts)
+			})
+			var buf bytes.Buffer
+			if err := writeTAP(&buf, out, code); err != nil {
+				t.Fatal(err)
+			}
+			if failed := strings.Contains("\n"+buf.String(), "\nnot ok "); failed != (code != 0) {
+				t.Errorf("exit code %d, but TAP has failures: %v\n%s", code, failed, buf.String())
+			}
+		})
+	}
+}
+
+// validateSchema checks v, decoded from JSON, against the schema s, and
+// returns the violations. It knows the keywords the schema uses and, unlike
+// JSON Schema, treats properties the schema does not list as violations, so
+// no field is added without documenting it.
+func validateSchema(root, s map[string]any, v any, path string) []string {
+	var errs []string
+	fail := func(format string, args ...any) {
+		errs = append(errs, path+": "+fmt.Sprintf(format, args...))
+	}
+	for k := range s {
+		switch k {
+		case "$schema", "$id", "$defs", "$ref", "title", "description", "type", "required", "properties",
+			"additionalProperties", "propertyNames", "items", "enum", "pattern", "minimum", "maximum":
+		default:
+			fail("unknown schema keyword %q", k)
+		}
+	}
+	if ref, ok := s["$ref"].(string); ok {
+		def, ok := root["$defs"].(map[string]any)[strings.TrimPrefix(ref, "#/$defs/")].(map[string]any)
+		if !ok {
+			fail("unresolved $ref %q", ref)
+			return errs
+		}
+		return append(errs, validateSchema(root, def, v, path)...)
+	}
+	if enum, ok := s["enum"].([]any); ok && !slices.Contains(enum, v) {
+		fail("%v is not one of %v", v, enum)
+	}
+	switch s["type"] {
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			fail("%v is not an object", v)
+			break
+		}
+		required, _ := s["required"].([]any)
+		for _, k := range required {
+			if _, ok := obj[k.(string)]; !ok {
+				fail("required property %q is missing", k)
+			}
+		}
+		props, _ := s["properties"].(map[string]any)
+		for _, k := range slices.Sorted(maps.Keys(obj)) {
+			if names, ok := s["propertyNames"].(map[string]any); ok {
+				errs = append(errs, validateSchema(root, names, k, path+"/"+k)...)
+			}
+			switch extra, _ := s["additionalProperties"].(map[string]any); {
+			case props[k] != nil:
+				errs = append(errs, validateSchema(root, props[k].(map[string]any), obj[k], path+"/"+k)...)
+			case extra != nil:
+				errs = append(errs, validateSchema(root, extra, obj[k], path+"/"+k)...)
+			default:
+				fail("property %q is not in the schema", k)
+			}
+		}
+	case "array":
+		arr, ok := v.([]any)
+		if !ok {
+			fail("%v is not an array", v)
+			break
+		}
+		for i, e := range arr {
+			errs = append(errs, validateSchema(root, s["items"].(map[string]any), e, fmt.Sprintf("%s/%d", path, i))...)
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			fail("%v is not a string", v)
+			break
+		}
+		if p, ok := s["pattern"].(string); ok && !regexp.MustCompile(p).MatchString(str) {
+			fail("%q does not match %s", str, p)
+		}
+	case "integer", "number":
+		n, ok := v.(float64)
+		if !ok || s["type"] == "integer" && n != math.Trunc(n) {
+			fail("%v is not an %s", v, s["type"])
+			break
+		}
+		if min, ok := s["minimum"].(float64); ok && n < min {
+			fail("%v is below %v", n, min)
+		}
+		if max, ok := s["maximum"].(float64); ok && n > max {
+			fail("%v is above %v", n, max)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			fail("%v is not a boolean", v)
+		}
+	case nil:
+	default:
+		fail("unknown type %v", s["type"])
+	}
+	return errs
+}
+
+// checkSchema writes out as JSON and validates every document against
+// schema/fs-check-new.schema.json.
+func checkSchema(t *testing.T, out []jsonOutput) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("schema", "fs-check-new.schema.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, out, 0); err != nil {
+		t.Fatal(err)
+	}
+	dec := json.NewDecoder(&buf)
+	for i := 0; dec.More(); i++ {
+		var doc any
+		if err := dec.Decode(&doc); err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range validateSchema(schema, schema, doc, fmt.Sprintf("document %d", i+1)) {
+			t.Error(e)
+		}
+	}
+}
+
+func TestJSONOutputMatchesSchema(t *testing.T) {
+	t.Run("offline", func(t *testing.T) {
+		out, _ := testReports(t)
+		checkSchema(t, out)
+	})
+
+	// every field set, so none is missing from the schema
+	t.Run("all fields", func(t *testing.T) {
+		resp := &responseInfo{Server: "192.0.2.53:53", Transport: "tcp", Rcode: "NOERROR", AA: true, AD: true, TC: true,
+			UDPTruncated: true, EDNSUDPSize: 1232, NSID: "6e7331", Size: 120, RTTMillis: 1.5}
+		out, _ := collectReports(t, func(checkOptions) int {
+			emitReport(jsonOutput{
+				Query: "_for-sale.example.nl.",
+				Records: []recordResult{{
+					Content: "v=FORSALE1;fcod=NLFS-1", RawTxts: []string{"v=FORSALE1;fcod=NLFS-1"}, RawDecodedLens: []int{22},
+					TTL: 3600, RawCount: 1, FitsSingleCharstring: true, Valid: true, Tag: "fcod", TagValue: "NLFS-1",
+					SanitizedValue: "NLFS-1", Messages: []string{"note"}, ConcatenatedLength: 22, WireRDATA: "16763d",
+					FcodAction: &FcodAction{Handler: "NLFS", Description: "registered sales landing page", LandingPage: "https://example.nl/"},
+				}},
+				TTLCounts:         map[uint32]int{3600: 1},
+				Summary:           "1 valid",
+				ValidCount:        1,
+				Registration:      &registrationInfo{Source: "rdap", Server: "https://rdap.example/", Contacts: []contact{{"registrar", "Registrar", "r@example.nl", "+31.701234567", "https://registrar.example/"}}, Status: []string{"active"}},
+				RegistrationError: "timeout",
+				RegistryWarning:   "pending delete",
+				Skipped:           true,
+				Placement:         &placement{Class: "registrable", PublicSuffix: "nl", RegistrableDomain: "example.nl", Note: "note"},
+				OutOfScope:        "reserved",
+				Response:          resp,
+				Comparison: &comparison{Consistent: false, TTLsDiffer: true,
+					Resolvers: []resolverAnswer{{Name: "a", Server: "192.0.2.53:53", Status: "consensus", Variant: 1, Rcode: "NOERROR", TTLMin: 60, TTLMax: 3600, Error: "none", Response: resp}},
+					Variants:  []answerVariant{{Rcode: "NOERROR", Records: []string{"v=FORSALE1;"}, Resolvers: []string{"a"}, Servers: []string{"192.0.2.53:53"}}}},
+				Negative: &negativeAnswer{Class: "nxdomain", Rcode: "NXDOMAIN", NegativeTTL: 300, Zone: "example.nl.", EDE: []string{"6 (DNSSEC Bogus)"}, Explanation: "no such name"},
+				Doctor: &doctorReport{Server: "192.0.2.53:53", Probes: 22, Failed: 1, Error: "none",
+					Findings: []doctorFinding{{"error", "example.nl.", "problem", []string{"- a", "+ b"}}}},
+				Error: "failed",
+			})
+			return 0
+		})
+		checkSchema(t, out)
+	})
+
+	// DNS answers, compared across two resolvers of which one has no
+	// records, with the -doctor report, and a negative answer
+	t.Run("dns", func(t *testing.T) {
+		withRecords := startZone(t, `_for-sale.example.nl. 3600 IN TXT "v=FORSALE1;fval=EUR999"`, `example.nl. 3600 IN TXT "v=FORSALE1;"`)
+		without := startZone(t)
+		out, _ := collectReports(t, func(opts checkOptions) int {
+			opts.compare = []resolver{{"with", withRecords}, {"without", without}}
+			opts.doctor = true
+			checkDomain("example.nl", opts)
+			opts.compare = []resolver{{"without", without}}
+			return checkDomain("example.nl", opts)
+		})
+		if len(out) != 2 || out[0].Comparison == nil || out[0].Doctor == nil || out[1].Negative == nil {
+			t.Fatalf("reports lack the DNS parts: %+v", out)
+		}
+		checkSchema(t, out)
+	})
+}
+
+// startZone serves the example.nl zone with records on 127.0.0.1 and returns
+// its address. Names that do not exist, and have no names below them, get
+// NXDOMAIN; a CNAME answers for every type, followed by the records of its
+// target.
+func startZone(t *testing.T, records ...string) string {
+	t.Helper()
+	soa, _ := dns.NewRR("example.nl. 3600 IN SOA ns.example.nl. hostmaster.example.nl. 1 7200 3600 1209600 300")
+	rrs := []dns.RR{soa}
+	for _, s := range records {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatalf("%q: %v", s, err)
+		}
+		rrs = append(rrs, rr)
+	}
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		m.Authoritative = true
+		q := req.Question[0]
+		exists := false
+		for _, rr := range rrs {
+			h := rr.Header()
+			exists = exists || dns.IsSubDomain(q.Name, h.Name)
+			if strings.EqualFold(h.Name, q.Name) && (h.Rrtype == q.Qtype || h.Rrtype == dns.TypeCNAME) {
+				m.Answer = append(m.Answer, rr)
+			}
+		}
+		if len(m.Answer) == 1 && q.Qtype != dns.TypeCNAME {
+			if cname, ok := m.Answer[0].(*dns.CNAME); ok {
+				for _, rr := range rrs {
+					if strings.EqualFold(rr.Header().Name, cname.Target) && rr.Header().Rrtype == q.Qtype {
+						m.Answer = append(m.Answer, rr)
+					}
+				}
+			}
+		}
+		if len(m.Answer) == 0 {
+			m.Ns = []dns.RR{soa}
+			if !exists {
+				m.Rcode = dns.RcodeNameError
+			}
+		}
+		w.WriteMsg(m)
+	})
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	started := make(chan struct{})
+	srv := &dns.Server{PacketConn: pc, Handler: handler, NotifyStartedFunc: func() { close(started) }}
+	go srv.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { srv.Shutdown() })
+	return pc.LocalAddr().String()
+}
+
+func TestNegativeExitCode(t *testing.T) {
+	for class, code := range negativeExitCodes {
+		neg := &negativeAnswer{Class: class}
+		want := 2
+		if neg.failed() {
+			want = 3
+		}
+		if got := neg.exitCode(false); got != want {
+			t.Errorf("%s: exit code %d without -explain, want %d", class, got, want)
+		}
+		if got := neg.exitCode(true); got != code {
+			t.Errorf("%s: exit code %d with -explain, want %d", class, got, code)
+		}
+	}
+
+	server := startZone(t, "_for-sale.nodata.example.nl. 3600 IN A 192.0.2.1")
+	tests := []struct {
+		domain  string
+		explain bool
+		want    int
+	}{
+		{"example.nl", false, 2},
+		{"example.nl", true, 4},
+		{"nodata.example.nl", false, 2},
+		{"nodata.example.nl", true, 5},
+		{"gone.example.nl", false, 2},
+		{"gone.example.nl", true, 6},
+	}
+	for _, tt := range tests {
+		_, code := collectReports(t, func(opts checkOptions) int {
+			opts.compare = []resolver{{"zone", server}}
+			opts.explain = tt.explain
+			return checkDomain(tt.domain, opts)
+		})
+		if code != tt.want {
+			t.Errorf("checkDomain(%q), explain %v: exit code %d, want %d", tt.domain, tt.explain, code, tt.want)
+		}
+	}
+}
+
+func TestFixedContents(t *testing.T) {
+	tests := []struct {
+		content string
+		fixed   []string
+		problem string
+	}{
+		{"v=FORSALE1;fval=EUR999", []string{"v=FORSALE1;fval=EUR999"}, ""},
+		{"v=FORSALE1;call us", []string{"v=FORSALE1;call us"}, ""},
+		{"for sale, call us", nil, ""},
+		{"v=forsale1;fval=EUR999", []string{"v=FORSALE1;fval=EUR999"}, `the version tag must be exactly "v=FORSALE1;" (case-sensitive)`},
+		{"v=FORSALE1 fval=EUR999", []string{"v=FORSALE1;fval=EUR999"}, `the version tag must be exactly "v=FORSALE1;" (with the semicolon)`},
+		{"V=ForSale1", []string{"v=FORSALE1;"}, `the version tag must be exactly "v=FORSALE1;" (case-sensitive, with the semicolon)`},
+		{"v=FORSALE1;FVAL=EUR999", []string{"v=FORSALE1;fval=EUR999"}, "content tags are lowercase"},
+		{"v=FORSALE1; fval=EUR999; ", []string{"v=FORSALE1;fval=EUR999"}, "stray white space or semicolons around the tags"},
+		// SPF style: several tags in one record; ftxt keeps its semicolon
+		{"v=FORSALE1;fval=EUR999;furi=https://example.nl/;ftxt=call us;", []string{
+			"v=FORSALE1;fval=EUR999",
+			"v=FORSALE1;furi=https://example.nl/",
+			"v=FORSALE1;ftxt=call us;",
+		}, "each record holds one tag=value pair; publish one record per tag instead of combining them like SPF"},
+		{"v=forsale1;fval=EUR999 FTXT=call us", []string{"v=FORSALE1;fval=EUR999", "v=FORSALE1;ftxt=call us"},
+			`the version tag must be exactly "v=FORSALE1;" (case-sensitive); each record holds one tag=value pair; publish one record per tag instead of combining them like SPF; content tags are lowercase`},
+	}
+	for _, tt := range tests {
+		fixed, problem := fixedContents(tt.content)
+		if !slices.Equal(fixed, tt.fixed) || problem != tt.problem {
+			t.Errorf("fixedContents(%q) = %q, %q; want %q, %q", tt.content, fixed, problem, tt.fixed, tt.problem)
+		}
+	}
+}
+
+func TestDiagnose(t *testing.T) {
+	const atSale = "processors only look at _for-sale.example.nl."
+	tests := []struct {
+		name    string
+		records []string
+		want    []doctorFinding
+	}{
+		{"published correctly", []string{
+			`_for-sale.example.nl. 3600 IN TXT "v=FORSALE1;fval=EUR999"`,
+		}, nil},
+		{"TXT at the apex", []string{
+			`example.nl. 3600 IN TXT "v=FORSALE1;fval=EUR999"`,
+			`example.nl. 3600 IN TXT "v=spf1 -all"`,
+		}, []doctorFinding{{"error", "example.nl.", "TXT record with the version tag at the apex; " + atSale, []string{
+			`- example.nl. 3600 IN TXT "v=FORSALE1;fval=EUR999"`,
+			`+ _for-sale.example.nl. 3600 IN TXT "v=FORSALE1;fval=EUR999"`,
+		}}}},
+		{"SPF type at the apex", []string{
+			`example.nl. 3600 IN SPF "v=FORSALE1;fval=EUR999"`,
+		}, []doctorFinding{{"error", "example.nl.", "SPF record with the version tag at the apex; " + atSale, []string{
+			`- example.nl. 3600 IN SPF "v=FORSALE1;fval=EUR999"`,
+			`+ _for-sale.example.nl. 3600 IN TXT "v=FORSALE1;fval=EUR999"`,
+		}}}},
+		{"_forsale", []string{
+			`_forsale.example.nl. 300 IN TXT "v=FORSALE1;fval=EUR999"`,
+		}, []doctorFinding{{"error", "_forsale.example.nl.", "TXT records at a misspelt label; " + atSale, []string{
+			`- _forsale.example.nl. 300 IN TXT "v=FORSALE1;fval=EUR999"`,
+			`+ _for-sale.example.nl. 300 IN TXT "v=FORSALE1;fval=EUR999"`,
+		}}}},
+		{"_for_sale", []string{
+			`_for_sale.example.nl. 300 IN TXT "v=FORSALE1;furi=https://example.nl/"`,
+		}, []doctorFinding{{"error", "_for_sale.example.nl.", "TXT records at a misspelt label; " + atSale, []string{
+			`- _for_sale.example.nl. 300 IN TXT "v=FORSALE1;furi=https://example.nl/"`,
+			`+ _for-sale.example.nl. 300 IN TXT "v=FORSALE1;furi=https://example.nl/"`,
+		}}}},
+		{"origin twice", []string{
+			`_for-sale.example.nl.example.nl. 3600 IN TXT "v=FORSALE1;fval=EUR999"`,
+		}, []doctorFinding{{"error", "_for-sale.example.nl.example.nl.", "the domain appears twice: a name in a zone file without its trailing dot gets the origin appended; " + atSale, []string{
+			`- _for-sale.example.nl.example.nl. 3600 IN TXT "v=FORSALE1;fval=EUR999"`,
+			`+ _for-sale.example.nl. 3600 IN TXT "v=FORSALE1;fval=EUR999"`,
+		}}}},
+		{"CNAME at the label", []string{
+			`_for-sale.example.nl. 3600 IN CNAME offers.broker.example.nl.`,
+			`offers.broker.example.nl. 600 IN TXT "v=FORSALE1;fcod=BRKR-1"`,
+		}, []doctorFinding{{"warning", "_for-sale.example.nl.", "_for-sale.example.nl. is an alias (CNAME) of offers.broker.example.nl.; the records then depend on a name the domain holder may not control, and may list a third party's offer", []string{
+			`- _for-sale.example.nl. 3600 IN CNAME offers.broker.example.nl.`,
+			`+ _for-sale.example.nl. 600 IN TXT "v=FORSALE1;fcod=BRKR-1"`,
+		}}}},
+		{"SPF-style contents", []string{
+			`_for-sale.example.nl. 3600 IN TXT "v=FORSALE1;fval=EUR999;ftxt=call us;"`,
+		}, []doctorFinding{{"error", "_for-sale.example.nl.", "each record holds one tag=value pair; publish one record per tag instead of combining them like SPF", []string{
+			`- _for-sale.example.nl. 3600 IN TXT "v=FORSALE1;fval=EUR999;ftxt=call us;"`,
+			`+ _for-sale.example.nl. 3600 IN TXT "v=FORSALE1;fval=EUR999"`,
+			`+ _for-sale.example.nl. 3600 IN TXT "v=FORSALE1;ftxt=call us;"`,
+		}}}},
+		{"SPF policy at the label", []string{
+			`_for-sale.example.nl. 3600 IN TXT "v=FORSALE1;fval=EUR999"`,
+			`_for-sale.example.nl. 3600 IN TXT "v=spf1 -all"`,
+		}, []doctorFinding{{"warning", "_for-sale.example.nl.", "an SPF policy at _for-sale has no effect, and processors ignore it", []string{
+			`- _for-sale.example.nl. 3600 IN TXT "v=spf1 -all"`,
+		}}}},
+		{"names below _for-sale", []string{
+			`fval._for-sale.example.nl. 3600 IN TXT "EUR999"`,
+			`www._for-sale.example.nl. 3600 IN TXT "v=FORSALE1;ftxt=call us"`,
+		}, []doctorFinding{
+			{"error", "fval._for-sale.example.nl.", "_for-sale.example.nl. is not a leaf: fval._for-sale.example.nl. exists below it, which is non-conformant", []string{
+				`- fval._for-sale.example.nl. 3600 IN TXT "EUR999"`,
+			}},
+			{"error", "www._for-sale.example.nl.", "_for-sale.example.nl. is not a leaf: www._for-sale.example.nl. exists below it, which is non-conformant", []string{
+				`- www._for-sale.example.nl. 3600 IN TXT "v=FORSALE1;ftxt=call us"`,
+				`+ _for-sale.example.nl. 3600 IN TXT "v=FORSALE1;ftxt=call us"`,
+			}},
+		}},
+		{"empty non-terminal", []string{
+			`sale._for-sale.example.nl. 3600 IN TXT "v=FORSALE1;fval=EUR999"`,
+		}, []doctorFinding{{"warning", "_for-sale.example.nl.", "_for-sale.example.nl. exists without records, so there are names below it (an empty non-terminal), which is non-conformant; none of the usual ones was found", nil}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rep := diagnose("example.nl", startZone(t, tt.records...))
+			if rep.Failed > 0 {
+				t.Fatalf("%d of %d probes failed", rep.Failed, rep.Probes)
+			}
+			if tt.want == nil {
+				tt.want = []doctorFinding{}
+			}
+			if !reflect.DeepEqual(rep.Findings, tt.want) {
+				t.Errorf("findings:\n%s\nwant:\n%s", findingsText(rep.Findings), findingsText(tt.want))
+			}
+		})
+	}
+}
+
+// findingsText lists findings one field per line, for the test output.
+func findingsText(findings []doctorFinding) string {
+	var sb strings.Builder
+	for _, f := range findings {
+		fmt.Fprintf(&sb, "  %s at %s: %s\n", f.Severity, f.Name, f.Problem)
+		for _, l := range f.Fix {
+			fmt.Fprintf(&sb, "      %s\n", l)
+		}
+	}
+	return sb.String()
+}
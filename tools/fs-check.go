@@ -1,6 +1,9 @@
 package main
 
 import (
+    _ "embed"
+    "errors"
+    "flag"
     "fmt"
     "net"
     "net/url"
@@ -8,6 +11,9 @@ import (
     "regexp"
     "sort"
     "strings"
+    "time"
+
+    "github.com/miekg/dns"
 )
 
 type ValidationResult struct {
@@ -27,6 +33,8 @@ type Summary struct {
     InvalidRecords  int
     DuplicatesFound bool
     Results         []ValidationResult
+    Negative        *NegativeAnswer // why there are no records
+    Err             error           // no resolver could be asked
 }
 
 var (
@@ -188,17 +196,266 @@ func validateURI(u string, r *ValidationResult) bool {
     return true
 }
 
+// specialUse is a special-use domain name (RFC 6761). The draft puts these
+// out of scope, and records under .arpa MUST be ignored.
+type specialUse struct {
+    Name      string // without trailing dot, e.g. "onion"
+    Reference string // e.g. "RFC 7686"
+    Reason    string
+}
+
+// exitOutOfScope is the exit code for special-use domain names, the same
+// in fs-check, fs-check-new and fs-generate.
+const exitOutOfScope = 10
+
+// specialUseNames holds the special-use domain names by name: the built-in
+// list in special-use.csv, extended by the IANA registry loaded from disk.
+var specialUseNames = map[string]specialUse{}
+
+//go:embed special-use.csv
+var builtinSpecialUse string
+
+func init() {
+    addSpecialUseNames(builtinSpecialUse)
+}
+
+// loadSpecialUseNames adds the names from the IANA "Special-Use Domain
+// Names" registry, saved as CSV (special-use-domain.csv: Name,Reference) or
+// as plain text with one name per line.
+func loadSpecialUseNames(path string) error {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return err
+    }
+    addSpecialUseNames(string(data))
+    return nil
+}
+
+// addSpecialUseNames adds the names in data, one per line as
+// Name[,Reference[,Reason]]. Names already known keep their entry.
+func addSpecialUseNames(data string) {
+    for _, line := range strings.Split(data, "\n") {
+        fields := strings.SplitN(strings.TrimSpace(line), ",", 3)
+        name := strings.ToLower(strings.TrimSuffix(strings.Trim(fields[0], `"`), "."))
+        if name == "" || name == "name" || strings.HasPrefix(name, "#") {
+            continue
+        }
+        if _, ok := specialUseNames[name]; ok {
+            continue
+        }
+        su := specialUse{Name: name, Reason: "listed in the IANA Special-Use Domain Names registry"}
+        if len(fields) > 1 {
+            ref := strings.NewReplacer("[", "", "]", "", `"`, "").Replace(strings.TrimSpace(fields[1]))
+            if !strings.Contains(ref, "RFC ") {
+                ref = strings.Replace(ref, "RFC", "RFC ", 1)
+            }
+            su.Reference = ref
+        }
+        if len(fields) > 2 {
+            su.Reason = strings.TrimSpace(fields[2])
+        }
+        specialUseNames[name] = su
+    }
+}
+
+// lookupSpecialUse reports whether domain is, or is under, a special-use
+// domain name. The shortest match wins, so anything under .arpa is .arpa.
+func lookupSpecialUse(domain string) (specialUse, bool) {
+    labels := strings.Split(strings.ToLower(strings.TrimSuffix(domain, ".")), ".")
+    for i := len(labels) - 1; i >= 0; i-- {
+        if su, ok := specialUseNames[strings.Join(labels[i:], ".")]; ok {
+            return su, true
+        }
+    }
+    return specialUse{}, false
+}
+
+// String describes the name for the user.
+func (su specialUse) String() string {
+    if su.Name == "arpa" {
+        return "." + su.Name + ": " + su.Reason
+    }
+    ref := ""
+    if su.Reference != "" {
+        ref = " (" + su.Reference + ")"
+    }
+    return "." + su.Name + ref + ": " + su.Reason + "; the draft does not apply to special-use domain names"
+}
+
+// NegativeAnswer explains why a lookup gave no _for-sale records.
+type NegativeAnswer struct {
+    // Class is "nxdomain" (_for-sale does not exist, the domain does),
+    // "nxdomain-parent" (the domain itself does not exist), "nodata" (the
+    // name exists without TXT records), "servfail", "servfail-dnssec"
+    // (DNSSEC validation failed), "timeout" or "error"
+    Class       string
+    Rcode       string
+    NegativeTTL uint32 // min(SOA TTL, SOA MINIMUM) (RFC 2308)
+    Zone        string // owner of the SOA record; empty without one
+    EDE         []string
+    Explanation string
+}
+
+// negativeExitCodes are the exit codes for each class of negative answer,
+// the same as fs-check-new's.
+var negativeExitCodes = map[string]int{
+    "nxdomain":        4,
+    "nodata":          5,
+    "nxdomain-parent": 6,
+    "servfail":        7,
+    "servfail-dnssec": 8,
+    "timeout":         9,
+    "error":           3,
+}
+
+// dnssecEDE are the extended DNS error codes (RFC 8914) that report a
+// DNSSEC validation failure.
+var dnssecEDE = map[uint16]bool{
+    dns.ExtendedErrorCodeUnsupportedDNSKEYAlgorithm:  true,
+    dns.ExtendedErrorCodeUnsupportedDSDigestType:     true,
+    dns.ExtendedErrorCodeDNSSECIndeterminate:         true,
+    dns.ExtendedErrorCodeDNSBogus:                    true,
+    dns.ExtendedErrorCodeSignatureExpired:            true,
+    dns.ExtendedErrorCodeSignatureNotYetValid:        true,
+    dns.ExtendedErrorCodeDNSKEYMissing:               true,
+    dns.ExtendedErrorCodeRRSIGsMissing:               true,
+    dns.ExtendedErrorCodeNoZoneKeyBitSet:             true,
+    dns.ExtendedErrorCodeNSECMissing:                 true,
+    dns.ExtendedErrorCodeSignatureExpiredBeforeValid: true,
+}
+
+const queryTimeout = 5 * time.Second
+
+// query sends a query with EDNS0 to server, over TCP if the UDP response is
+// truncated. cd sets the Checking Disabled bit.
+func query(name string, qtype uint16, cd bool, server string) (*dns.Msg, error) {
+    msg := new(dns.Msg)
+    msg.SetQuestion(dns.Fqdn(name), qtype)
+    msg.SetEdns0(4096, false)
+    msg.CheckingDisabled = cd
+    client := &dns.Client{Net: "udp", Timeout: queryTimeout}
+    r, _, err := client.Exchange(msg, server)
+    if err == nil && r.Truncated {
+        client.Net = "tcp"
+        r, _, err = client.Exchange(msg, server)
+    }
+    return r, err
+}
+
 func lookupTXT(name string) ([]string, error) {
     return net.LookupTXT(name)
 }
 
-func validateDomain(domain string) Summary {
+// resolvers returns the servers in /etc/resolv.conf, or the local host's
+// when it cannot be read.
+func resolvers() []string {
+    conf, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+    if err != nil || len(conf.Servers) == 0 {
+        fmt.Fprintln(os.Stderr, "Warning: no resolvers in /etc/resolv.conf, asking 127.0.0.1 and ::1")
+        return []string{"127.0.0.1:53", "[::1]:53"}
+    }
+    var servers []string
+    for _, s := range conf.Servers {
+        servers = append(servers, net.JoinHostPort(s, conf.Port))
+    }
+    return servers
+}
+
+// explainNegative asks servers in turn why the lookup of _for-sale.<domain>
+// gave no records; lookupErr is the error of that lookup. The error is only
+// set if no server could be asked.
+func explainNegative(domain string, lookupErr error, servers []string) (*NegativeAnswer, error) {
+    lastErr := lookupErr
+    for _, server := range servers {
+        r, err := query("_for-sale."+domain, dns.TypeTXT, false, server)
+        if err != nil {
+            lastErr = err
+            continue
+        }
+        if r.Rcode == dns.RcodeSuccess && len(r.Answer) > 0 {
+            return &NegativeAnswer{Class: "error", Rcode: dns.RcodeToString[r.Rcode],
+                Explanation: fmt.Sprintf("the system resolver gave no records (%v), but %s has them", lookupErr, server)}, nil
+        }
+        return classifyNegative(domain, r, server), nil
+    }
+    var netErr net.Error
+    if errors.As(lastErr, &netErr) && netErr.Timeout() {
+        return &NegativeAnswer{Class: "timeout", Explanation: fmt.Sprintf("no answer within %s: %v", queryTimeout, lastErr)}, nil
+    }
+    return nil, lastErr
+}
+
+// classifyNegative explains a response without TXT records. After NXDOMAIN
+// it asks whether the domain itself exists (nothing exists below a name that
+// does not, RFC 8020); after SERVFAIL it repeats the query with checking
+// disabled, which a validating resolver answers if only DNSSEC failed.
+func classifyNegative(domain string, r *dns.Msg, server string) *NegativeAnswer {
+    neg := &NegativeAnswer{Rcode: dns.RcodeToString[r.Rcode]}
+    for _, rr := range r.Ns {
+        if soa, ok := rr.(*dns.SOA); ok {
+            neg.NegativeTTL = min(soa.Hdr.Ttl, soa.Minttl)
+            neg.Zone = soa.Hdr.Name
+            break
+        }
+    }
+    dnssecFailure := false
+    if opt := r.IsEdns0(); opt != nil {
+        for _, o := range opt.Option {
+            if ede, ok := o.(*dns.EDNS0_EDE); ok {
+                e := fmt.Sprintf("%d (%s)", ede.InfoCode, dns.ExtendedErrorCodeToString[ede.InfoCode])
+                if ede.ExtraText != "" {
+                    e += ": " + ede.ExtraText
+                }
+                neg.EDE = append(neg.EDE, e)
+                dnssecFailure = dnssecFailure || dnssecEDE[ede.InfoCode]
+            }
+        }
+    }
+
+    switch r.Rcode {
+    case dns.RcodeNameError:
+        neg.Class = "nxdomain"
+        neg.Explanation = fmt.Sprintf("_for-sale.%s does not exist (NXDOMAIN), but %s does", domain, domain)
+        p, err := query(domain, dns.TypeSOA, false, server)
+        switch {
+        case err != nil:
+            neg.Explanation = fmt.Sprintf("_for-sale.%s does not exist (NXDOMAIN); whether %s exists could not be checked: %v", domain, domain, err)
+        case p.Rcode == dns.RcodeNameError:
+            neg.Class = "nxdomain-parent"
+            neg.Explanation = fmt.Sprintf("%s does not exist (NXDOMAIN): it is not registered or not delegated", domain)
+        }
+    case dns.RcodeSuccess:
+        neg.Class = "nodata"
+        neg.Explanation = fmt.Sprintf("_for-sale.%s exists but has no TXT records (NODATA): it has records of other types only, or only names below it", domain)
+    case dns.RcodeServerFailure:
+        neg.Class = "servfail"
+        neg.Explanation = "the resolver could not get an answer (SERVFAIL)"
+        if p, err := query("_for-sale."+domain, dns.TypeTXT, true, server); err == nil && (p.Rcode == dns.RcodeSuccess || p.Rcode == dns.RcodeNameError) {
+            dnssecFailure = true
+        }
+        if dnssecFailure {
+            neg.Class = "servfail-dnssec"
+            neg.Explanation = "DNSSEC validation failed (SERVFAIL): the resolver rejects the answer as bogus"
+        }
+    default:
+        neg.Class = "error"
+        neg.Explanation = "the resolver answered " + neg.Rcode
+    }
+    return neg
+}
+
+// validateDomain looks up and checks the records of domain. With explain,
+// a lookup without records is followed by queries that tell why.
+func validateDomain(domain string, explain bool) Summary {
     target := "_for-sale." + domain
     txts, err := lookupTXT(target)
     summary := Summary{Domain: domain}
 
-    if err != nil {
+    if err != nil || len(txts) == 0 {
         // No records => not for sale (no version found)
+        if explain {
+            summary.Negative, summary.Err = explainNegative(domain, err, resolvers())
+        }
         return summary
     }
 
@@ -237,6 +494,20 @@ func validateDomain(domain string) Summary {
 
 func printSummary(s Summary) {
     fmt.Printf("Domain: %s\n", s.Domain)
+    if s.Err != nil {
+        fmt.Printf("DNS lookup failed: %v\n", s.Err)
+        return
+    }
+    if neg := s.Negative; neg != nil {
+        fmt.Printf("No _for-sale TXT records: %s\n", neg.Explanation)
+        if neg.Zone != "" {
+            fmt.Printf("Negative TTL: %d s (SOA of %s)\n", neg.NegativeTTL, neg.Zone)
+        }
+        for _, e := range neg.EDE {
+            fmt.Printf("Extended DNS error: %s\n", e)
+        }
+        return
+    }
     fmt.Printf("For sale: %v\n", s.ForSale)
     fmt.Printf("Valid records: %d, Invalid records: %d\n", s.ValidRecords, s.InvalidRecords)
     fmt.Printf("Duplicate tag-value pairs in RRset: %v\n", s.DuplicatesFound)
@@ -279,21 +550,48 @@ func printSummary(s Summary) {
     }
 }
 
+// Exit codes: 0 for sale, 1 not for sale, 2 usage error, 10 out of scope
+// (special-use domain name). With -explain, a lookup without records exits
+// with 3 DNS error, 4 NXDOMAIN of _for-sale only, 5 NODATA, 6 NXDOMAIN of the
+// domain itself, 7 SERVFAIL, 8 SERVFAIL due to DNSSEC or 9 timeout instead of 1.
 func main() {
-    if len(os.Args) != 2 {
-        fmt.Fprintf(os.Stderr, "Usage: %s <domain>\n", os.Args[0])
+    flag.Usage = func() {
+        fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] <domain>\n", os.Args[0])
+        flag.PrintDefaults()
+    }
+    specialUseFile := flag.String("special-use", "", "IANA special-use domain names registry (CSV or one name per line) extending the built-in list")
+    explain := flag.Bool("explain", false, "without records, tell why (NXDOMAIN, NODATA, SERVFAIL, DNSSEC, timeout) and exit with 3 to 9 instead of 1")
+    flag.Parse()
+    if flag.NArg() != 1 {
+        flag.Usage()
         os.Exit(2)
     }
-    domain := strings.TrimSpace(os.Args[1])
+    domain := strings.TrimSpace(flag.Arg(0))
     if domain == "" {
         fmt.Fprintln(os.Stderr, "Domain must not be empty")
         os.Exit(2)
     }
-    s := validateDomain(domain)
+    if *specialUseFile != "" {
+        if err := loadSpecialUseNames(*specialUseFile); err != nil {
+            fmt.Fprintln(os.Stderr, "Cannot load special-use domain names:", err)
+            os.Exit(2)
+        }
+    }
+    // special-use names are out of scope; no query is sent for them
+    if su, ok := lookupSpecialUse(domain); ok {
+        fmt.Printf("Domain: %s\nOut of scope, not queried - %s\n", domain, su)
+        os.Exit(exitOutOfScope)
+    }
+    s := validateDomain(domain, *explain)
     printSummary(s)
-    if s.ForSale {
+    switch {
+    case s.Err != nil:
+        os.Exit(3)
+    case s.Negative != nil:
+        os.Exit(negativeExitCodes[s.Negative.Class])
+    case s.ForSale:
         os.Exit(0)
-    } else {
+    default:
         // Non-zero exit could be used to signal "not for sale" in scripts; adjust as desired.
         os.Exit(1)
     }
@@ -0,0 +1,126 @@
+package main
+
+import (
+    "net"
+    "strings"
+    "testing"
+
+    "github.com/miekg/dns"
+)
+
+func TestParseRecord(t *testing.T) {
+    tests := []struct {
+        raw        string
+        hasVersion bool
+        tag        string
+        valid      bool
+        warning    string
+    }{
+        {"v=FORSALE1;", true, "", true, ""},
+        {"v=FORSALE1;   fval=EUR999", true, "fval", true, ""},
+        {"v=FORSALE1;fval=BTC0.5", true, "fval", true, ""},
+        {"v=FORSALE1;fval=EURO10", true, "fval", true, "not 3 letters"},
+        {"v=FORSALE1;fval=eur10", true, "fval", false, ""},
+        {"v=FORSALE1;fcod=NLFS-1", true, "fcod", true, ""},
+        {"v=FORSALE1;ftxt=call;fval=EUR1", true, "ftxt", true, "ambiguous"},
+        {"v=FORSALE1;ftxt=<script>", true, "ftxt", true, "XSS"},
+        {"v=FORSALE1;furi=https://example.com/", true, "furi", true, ""},
+        {"v=FORSALE1;furi=ftp://example.com/", true, "furi", true, "non-recommended"},
+        {"v=FORSALE1;furi=mailto:sales@example.com", true, "furi", true, ""},
+        {"v=FORSALE1;furi=tel:+31 70 1234567", true, "furi", false, ""},
+        {"v=FORSALE1;furi=example.com", true, "furi", false, ""},
+        {"v=FORSALE1;fprice=1", true, "", false, ""},
+        {"v=FORSALE2;", false, "", false, ""},
+    }
+    for _, tt := range tests {
+        r := parseRecord(tt.raw)
+        if r.HasVersion != tt.hasVersion || r.Tag != tt.tag || r.ValidSyntax != tt.valid {
+            t.Errorf("parseRecord(%q) = version %v, tag %q, valid %v; want %v, %q, %v (errors %q)",
+                tt.raw, r.HasVersion, r.Tag, r.ValidSyntax, tt.hasVersion, tt.tag, tt.valid, r.Errors)
+        }
+        if tt.warning != "" && !strings.Contains(strings.Join(r.Warnings, "\n"), tt.warning) {
+            t.Errorf("parseRecord(%q) warnings = %q, want one containing %q", tt.raw, r.Warnings, tt.warning)
+        }
+    }
+}
+
+// startServer serves fixed answers on 127.0.0.1 and returns its address.
+// Names without an answer get NXDOMAIN; a SERVFAIL for bogus. is answered
+// when checking is disabled, as a validating resolver does.
+func startServer(t *testing.T) string {
+    soa, _ := dns.NewRR("example. 3600 IN SOA ns.example. hostmaster.example. 1 7200 3600 1209600 300")
+    mux := dns.NewServeMux()
+    mux.HandleFunc(".", func(w dns.ResponseWriter, req *dns.Msg) {
+        m := new(dns.Msg)
+        m.SetReply(req)
+        switch req.Question[0].Name {
+        case "nodata.example.", "_for-sale.nodata.example.":
+            m.Ns = []dns.RR{soa}
+        case "gone.example.", "_for-sale.gone.example.":
+            m.Rcode = dns.RcodeNameError
+            m.Ns = []dns.RR{soa}
+        case "_for-sale.fail.example.":
+            m.Rcode = dns.RcodeServerFailure
+        case "_for-sale.bogus.example.":
+            if !req.CheckingDisabled {
+                m.Rcode = dns.RcodeServerFailure
+            }
+        case "_for-sale.ede.example.":
+            m.Rcode = dns.RcodeServerFailure
+            m.SetEdns0(4096, false)
+            opt := m.IsEdns0()
+            opt.Option = append(opt.Option, &dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeSignatureExpired})
+        case "_for-sale.refused.example.":
+            m.Rcode = dns.RcodeRefused
+        case "example.", "absent.example.":
+        default:
+            m.Rcode = dns.RcodeNameError
+            m.Ns = []dns.RR{soa}
+        }
+        w.WriteMsg(m)
+    })
+    pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+    if err != nil {
+        t.Skipf("cannot listen: %v", err)
+    }
+    started := make(chan struct{})
+    srv := &dns.Server{PacketConn: pc, Handler: mux, NotifyStartedFunc: func() { close(started) }}
+    go srv.ActivateAndServe()
+    <-started
+    t.Cleanup(func() { srv.Shutdown() })
+    return pc.LocalAddr().String()
+}
+
+func TestExplainNegative(t *testing.T) {
+    server := startServer(t)
+    tests := []struct {
+        domain string
+        class  string
+        ttl    uint32
+        ede    string
+    }{
+        {"absent.example", "nxdomain", 300, ""},
+        {"gone.example", "nxdomain-parent", 300, ""},
+        {"nodata.example", "nodata", 300, ""},
+        {"fail.example", "servfail", 0, ""},
+        {"bogus.example", "servfail-dnssec", 0, ""},
+        {"ede.example", "servfail-dnssec", 0, "Signature Expired"},
+        {"refused.example", "error", 0, ""},
+    }
+    for _, tt := range tests {
+        neg, err := explainNegative(tt.domain, nil, []string{server})
+        if err != nil {
+            t.Errorf("explainNegative(%q): %v", tt.domain, err)
+            continue
+        }
+        if neg.Class != tt.class || neg.NegativeTTL != tt.ttl {
+            t.Errorf("explainNegative(%q) = %q TTL %d, want %q TTL %d", tt.domain, neg.Class, neg.NegativeTTL, tt.class, tt.ttl)
+        }
+        if _, ok := negativeExitCodes[neg.Class]; !ok {
+            t.Errorf("explainNegative(%q): class %q has no exit code", tt.domain, neg.Class)
+        }
+        if tt.ede != "" && !strings.Contains(strings.Join(neg.EDE, "\n"), tt.ede) {
+            t.Errorf("explainNegative(%q) EDE = %q, want %q", tt.domain, neg.EDE, tt.ede)
+        }
+    }
+}
@@ -2,28 +2,508 @@ package main
 
 import (
     "bufio"
+    "bytes"
+    "crypto/rand"
+    "encoding/base64"
+    _ "embed"
+    "encoding/json"
+    "errors"
+    "flag"
     "fmt"
     "net/url"
     "os"
+    "os/signal"
+    "path/filepath"
     "regexp"
     "strings"
+    "syscall"
+    "time"
+    "unicode"
+    "unicode/utf8"
+
+    "github.com/miekg/dns"
+    "golang.org/x/term"
+)
+
+const (
+    versionTag  = "v=FORSALE1;"
+    maxTxtStr   = 255 // octets in one character-string
+    maxValueLen = 239 // octets in a content value (255 - len(versionTag) - len("ftxt="))
 )
 
 var (
+    stdin = bufio.NewReader(os.Stdin)
+
     reFval   = regexp.MustCompile(`^[A-Z]+[0-9]+(\.[0-9]+)?$`)
     reMailto = regexp.MustCompile(`^mailto:[^ \t]+$`)
     reTel    = regexp.MustCompile(`^tel:\+?[0-9][0-9\\-\\.\\(\\) ]*$`)
+    // fcod party prefix, e.g. EXCO or XYZ1 (the "-" separator is added when minting)
+    reFcodPrefix = regexp.MustCompile(`^[A-Z0-9]{2,16}$`)
 )
 
+// fcodEntry maps one minted fcod value to the landing page it stands for.
+// The store file is a JSON array of these and is shared with webserver.go,
+// which resolves codes back to their landing page.
+type fcodEntry struct {
+    Code    string    `json:"code"`             // full fcod value, including prefix
+    Prefix  string    `json:"prefix"`           // party prefix without "-"
+    URL     string    `json:"url"`              // sales landing page
+    Domain  string    `json:"domain,omitempty"` // domain the code was first minted for
+    Created time.Time `json:"created"`
+}
+
+// loadFcodStore reads the code store; a missing file is an empty store.
+func loadFcodStore(path string) ([]fcodEntry, error) {
+    data, err := os.ReadFile(path)
+    if errors.Is(err, os.ErrNotExist) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    var entries []fcodEntry
+    if err := json.Unmarshal(data, &entries); err != nil {
+        return nil, fmt.Errorf("%s: %w", path, err)
+    }
+    return entries, nil
+}
+
+// saveFcodStore writes the store via a temporary file and rename, so a
+// concurrent reader never sees a partially written file.
+func saveFcodStore(path string, entries []fcodEntry) error {
+    data, err := json.MarshalIndent(entries, "", "  ")
+    if err != nil {
+        return err
+    }
+    tmp, err := os.CreateTemp(filepath.Dir(path), ".fcod-store-*")
+    if err != nil {
+        return err
+    }
+    defer os.Remove(tmp.Name())
+    if _, err := tmp.Write(append(data, '\n')); err != nil {
+        tmp.Close()
+        return err
+    }
+    if err := tmp.Close(); err != nil {
+        return err
+    }
+    return os.Rename(tmp.Name(), path)
+}
+
+// mintFcod returns the fcod value for landing under prefix, creating and
+// storing a new entry if needed. With encoding "base64" the code is the
+// standard Base64 (with padding, as in the draft's examples) of the landing
+// URL, so the same URL always yields the same code; with "opaque" it is a
+// random identifier that reveals nothing about the URL. Either way the code
+// is unique within the store.
+func mintFcod(storePath, prefix, landing, encoding, domain string) (string, error) {
+    if !reFcodPrefix.MatchString(prefix) {
+        return "", fmt.Errorf("prefix %q must be 2-16 uppercase letters or digits, e.g. EXCO", prefix)
+    }
+    u, err := url.Parse(landing)
+    if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+        return "", fmt.Errorf("landing page must be an absolute http or https URL")
+    }
+    entries, err := loadFcodStore(storePath)
+    if err != nil {
+        return "", err
+    }
+
+    var code string
+    switch encoding {
+    case "base64":
+        code = prefix + "-" + base64.StdEncoding.EncodeToString([]byte(landing))
+        for _, e := range entries {
+            if e.Code == code {
+                return code, nil
+            }
+        }
+    case "opaque":
+        for _, e := range entries {
+            if e.Prefix == prefix && e.URL == landing {
+                return e.Code, nil
+            }
+        }
+        for {
+            id := make([]byte, 9)
+            if _, err := rand.Read(id); err != nil {
+                return "", err
+            }
+            code = prefix + "-" + base64.RawURLEncoding.EncodeToString(id)
+            taken := false
+            for _, e := range entries {
+                if e.Code == code {
+                    taken = true
+                    break
+                }
+            }
+            if !taken {
+                break
+            }
+        }
+    default:
+        return "", fmt.Errorf("unknown fcod encoding %q (use base64 or opaque)", encoding)
+    }
+
+    if len(code) > maxValueLen {
+        return "", fmt.Errorf("code is %d octets, exceeds the %d-octet limit; use -fcod-encoding opaque for long URLs", len(code), maxValueLen)
+    }
+    entries = append(entries, fcodEntry{
+        Code:    code,
+        Prefix:  prefix,
+        URL:     landing,
+        Domain:  domain,
+        Created: time.Now().UTC(),
+    })
+    if err := saveFcodStore(storePath, entries); err != nil {
+        return "", err
+    }
+    return code, nil
+}
+
+// specialUse is a special-use domain name (RFC 6761). The draft puts these
+// out of scope, and records under .arpa MUST be ignored.
+type specialUse struct {
+    Name      string // without trailing dot, e.g. "onion"
+    Reference string // e.g. "RFC 7686"
+    Reason    string
+}
+
+// exitOutOfScope is the exit code for special-use domain names, the same
+// in fs-check, fs-check-new and fs-generate.
+const exitOutOfScope = 10
+
+// specialUseNames holds the special-use domain names by name: the built-in
+// list in special-use.csv, extended by the IANA registry loaded from disk.
+var specialUseNames = map[string]specialUse{}
+
+//go:embed special-use.csv
+var builtinSpecialUse string
+
+func init() {
+    addSpecialUseNames(builtinSpecialUse)
+}
+
+// loadSpecialUseNames adds the names from the IANA "Special-Use Domain
+// Names" registry, saved as CSV (special-use-domain.csv: Name,Reference) or
+// as plain text with one name per line.
+func loadSpecialUseNames(path string) error {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return err
+    }
+    addSpecialUseNames(string(data))
+    return nil
+}
+
+// addSpecialUseNames adds the names in data, one per line as
+// Name[,Reference[,Reason]]. Names already known keep their entry.
+func addSpecialUseNames(data string) {
+    for _, line := range strings.Split(data, "\n") {
+        fields := strings.SplitN(strings.TrimSpace(line), ",", 3)
+        name := strings.ToLower(strings.TrimSuffix(strings.Trim(fields[0], `"`), "."))
+        if name == "" || name == "name" || strings.HasPrefix(name, "#") {
+            continue
+        }
+        if _, ok := specialUseNames[name]; ok {
+            continue
+        }
+        su := specialUse{Name: name, Reason: "listed in the IANA Special-Use Domain Names registry"}
+        if len(fields) > 1 {
+            ref := strings.NewReplacer("[", "", "]", "", `"`, "").Replace(strings.TrimSpace(fields[1]))
+            if !strings.Contains(ref, "RFC ") {
+                ref = strings.Replace(ref, "RFC", "RFC ", 1)
+            }
+            su.Reference = ref
+        }
+        if len(fields) > 2 {
+            su.Reason = strings.TrimSpace(fields[2])
+        }
+        specialUseNames[name] = su
+    }
+}
+
+// lookupSpecialUse reports whether domain is, or is under, a special-use
+// domain name. The shortest match wins, so anything under .arpa is .arpa.
+func lookupSpecialUse(domain string) (specialUse, bool) {
+    labels := strings.Split(strings.ToLower(strings.TrimSuffix(domain, ".")), ".")
+    for i := len(labels) - 1; i >= 0; i-- {
+        if su, ok := specialUseNames[strings.Join(labels[i:], ".")]; ok {
+            return su, true
+        }
+    }
+    return specialUse{}, false
+}
+
+// String describes the name for the user.
+func (su specialUse) String() string {
+    if su.Name == "arpa" {
+        return "." + su.Name + ": " + su.Reason
+    }
+    ref := ""
+    if su.Reference != "" {
+        ref = " (" + su.Reference + ")"
+    }
+    return "." + su.Name + ref + ": " + su.Reason + "; the draft does not apply to special-use domain names"
+}
+
 func ask(prompt string) string {
     fmt.Print(prompt)
-    reader := bufio.NewReader(os.Stdin)
-    text, _ := reader.ReadString('\n')
+    text, _ := stdin.ReadString('\n')
     return strings.TrimSpace(text)
 }
 
-func escapeQuotes(s string) string {
-    return strings.ReplaceAll(s, `"`, `\"`)
+// escapePresentation renders s as the inside of an RFC 1035 section 5.1
+// quoted character-string: '"' and '\\' are backslash-escaped and every
+// octet outside printable ASCII becomes \DDD. When rawUTF8 is set, valid
+// multi-byte UTF-8 sequences are emitted as-is instead (most modern zone
+// parsers accept this, but not all).
+func escapePresentation(s string, rawUTF8 bool) string {
+    var b strings.Builder
+    for i := 0; i < len(s); {
+        c := s[i]
+        switch {
+        case c == '"' || c == '\\':
+            b.WriteByte('\\')
+            b.WriteByte(c)
+            i++
+        case c >= 0x20 && c < 0x7F:
+            b.WriteByte(c)
+            i++
+        case rawUTF8 && c >= 0x80:
+            r, size := utf8.DecodeRuneInString(s[i:])
+            if r == utf8.RuneError && size <= 1 {
+                fmt.Fprintf(&b, "\\%03d", c)
+                i++
+                continue
+            }
+            // C1 controls are valid UTF-8 but unprintable; keep them escaped
+            if r >= 0x80 && r <= 0x9F {
+                for j := 0; j < size; j++ {
+                    fmt.Fprintf(&b, "\\%03d", s[i+j])
+                }
+            } else {
+                b.WriteString(s[i : i+size])
+            }
+            i += size
+        default:
+            fmt.Fprintf(&b, "\\%03d", c)
+            i++
+        }
+    }
+    return b.String()
+}
+
+// verifyRoundTrip checks that record, a TXT RR in presentation format, is
+// read by a zone parser as a single character-string of exactly the intended
+// RDATA octets.
+func verifyRoundTrip(record, want string) error {
+    rr, err := dns.NewRR(record)
+    if err != nil {
+        return err
+    }
+    if _, ok := rr.(*dns.TXT); !ok {
+        return fmt.Errorf("parsed as %s, not TXT", dns.TypeToString[rr.Header().Rrtype])
+    }
+    msg := make([]byte, dns.Len(rr))
+    off, err := dns.PackRR(rr, msg, 0, nil, false)
+    if err != nil {
+        return err
+    }
+    rdata := msg[off-int(rr.Header().Rdlength) : off]
+    if len(rdata) == 0 || int(rdata[0]) != len(rdata)-1 {
+        return fmt.Errorf("record is not a single character-string")
+    }
+    if got := rdata[1:]; !bytes.Equal(got, []byte(want)) {
+        return fmt.Errorf("record reads as %q, want %q", got, want)
+    }
+    return nil
+}
+
+// valuePrompt builds an input prompt that shows the octet budget left for
+// a value of which n octets have been typed.
+func valuePrompt(what string, n int) string {
+    budget := fmt.Sprintf("%d octets left", maxValueLen-n)
+    if n > maxValueLen {
+        budget = fmt.Sprintf("%d octets over", n-maxValueLen)
+    }
+    return fmt.Sprintf("Enter %s [%s] (or type 'cancel' to return): ", what, budget)
+}
+
+// askValue reads a content value. On a terminal the remaining octet budget
+// is shown before the first keystroke and updated on every keystroke;
+// otherwise the prompt shows the full budget and a whole line is read.
+func askValue(what string) string {
+    fd := int(os.Stdin.Fd())
+    if !term.IsTerminal(fd) {
+        return ask(valuePrompt(what, 0))
+    }
+    saved, err := term.MakeRaw(fd)
+    if err != nil {
+        return ask(valuePrompt(what, 0))
+    }
+    defer term.Restore(fd, saved)
+
+    // restore the terminal when the process is told to stop
+    sigs := make(chan os.Signal, 1)
+    done := make(chan struct{})
+    signal.Notify(sigs, syscall.SIGHUP, syscall.SIGTERM)
+    defer signal.Stop(sigs)
+    defer close(done)
+    go func() {
+        select {
+        case <-sigs:
+            term.Restore(fd, saved)
+            fmt.Print("\r\n")
+            os.Exit(1)
+        case <-done:
+        }
+    }()
+
+    cols := 80
+    if w, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && w > 0 {
+        cols = w
+    }
+    var buf []byte
+    shown := 0 // terminal rows used by the previous rendering, minus one
+    render := func() {
+        if shown > 0 {
+            fmt.Printf("\x1b[%dA", shown)
+        }
+        line := valuePrompt(what, len(buf)) + string(buf)
+        fmt.Print("\r\x1b[J" + line)
+        shown = (utf8.RuneCountInString(line) - 1) / cols
+    }
+    render()
+    for {
+        c, err := stdin.ReadByte()
+        if err != nil {
+            break
+        }
+        switch {
+        case c == '\r' || c == '\n' || c == 0x04: // Enter, Ctrl-D
+            fmt.Print("\r\n")
+            return strings.TrimSpace(string(buf))
+        case c == 0x03: // Ctrl-C
+            term.Restore(fd, saved)
+            fmt.Println()
+            os.Exit(130)
+        case c == 0x7F || c == 0x08: // Backspace
+            if len(buf) > 0 {
+                _, size := utf8.DecodeLastRune(buf)
+                buf = buf[:len(buf)-size]
+            }
+        case c == 0x15: // Ctrl-U
+            buf = buf[:0]
+        case c == 0x1B: // escape sequence, e.g. an arrow key: ignored
+            // a sequence arrives in one read; a lone Esc has nothing after it
+            if stdin.Buffered() == 0 {
+                break
+            }
+            if next, _ := stdin.Peek(1); next[0] == '[' || next[0] == 'O' {
+                stdin.ReadByte()
+                for stdin.Buffered() > 0 {
+                    if b, _ := stdin.ReadByte(); b >= 0x40 && b <= 0x7E {
+                        break
+                    }
+                }
+            }
+        case c < 0x20:
+            // other control characters are not part of a value
+        default:
+            buf = append(buf, c)
+            // render complete characters only
+            start := len(buf) - 1
+            for start > 0 && len(buf)-start < utf8.UTFMax && !utf8.RuneStart(buf[start]) {
+                start--
+            }
+            if !utf8.FullRune(buf[start:]) {
+                continue
+            }
+        }
+        render()
+    }
+    fmt.Print("\r\n")
+    return strings.TrimSpace(string(buf))
+}
+
+// checkLength reports whether v fits the 239-octet value limit. It prints the
+// UTF-8 octet count and, for values that are too long and allowTruncate is
+// set, offers to cut the value at a grapheme boundary. The returned value is
+// the one to use; ok is false if the user has to enter a new value.
+func checkLength(v string, allowTruncate bool) (string, bool) {
+    n := len(v)
+    if n <= maxValueLen {
+        fmt.Printf("Value is %d octets (%d remaining).\n", n, maxValueLen-n)
+        return v, true
+    }
+    fmt.Printf("Invalid: value is %d octets, %d over the %d-octet limit\n", n, n-maxValueLen, maxValueLen)
+    if !allowTruncate {
+        return "", false
+    }
+    t := truncateGraphemes(v, maxValueLen)
+    fmt.Printf("Truncated to %d octets: %s\n", len(t), t)
+    if strings.ToLower(ask("Use truncated value? (y/N): ")) != "y" {
+        return "", false
+    }
+    return t, true
+}
+
+// truncateGraphemes returns the longest prefix of s that is at most max
+// octets and does not end inside a user-perceived character. Invalid UTF-8
+// is cut at a byte boundary. Cluster detection is a simplification of
+// UAX #29: combining marks, variation selectors, emoji modifiers, tag
+// characters, ZWJ sequences and regional-indicator pairs are kept together.
+func truncateGraphemes(s string, max int) string {
+    if len(s) <= max {
+        return s
+    }
+    cut := 0 // end of the last complete cluster that fits
+    prev := rune(-1)
+    riCount := 0
+    for i, r := range s {
+        if i > max {
+            break
+        }
+        if i > 0 && !extendsCluster(prev, r, riCount) {
+            cut = i
+        }
+        if isRegionalIndicator(r) {
+            riCount++
+        } else {
+            riCount = 0
+        }
+        prev = r
+    }
+    return s[:cut]
+}
+
+// extendsCluster reports whether r continues the grapheme cluster ending in
+// prev. riCount is the number of consecutive regional indicators before r.
+func extendsCluster(prev, r rune, riCount int) bool {
+    switch {
+    case unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc):
+        return true
+    case r == 0x200D: // ZERO WIDTH JOINER
+        return true
+    case prev == 0x200D:
+        return true
+    case r >= 0xFE00 && r <= 0xFE0F, r >= 0xE0100 && r <= 0xE01EF: // variation selectors
+        return true
+    case r >= 0x1F3FB && r <= 0x1F3FF: // emoji skin-tone modifiers
+        return true
+    case r >= 0xE0020 && r <= 0xE007F: // tag characters (subdivision flags)
+        return true
+    case isRegionalIndicator(r) && riCount%2 == 1:
+        return true
+    case prev == '\r' && r == '\n':
+        return true
+    }
+    return false
+}
+
+func isRegionalIndicator(r rune) bool {
+    return r >= 0x1F1E6 && r <= 0x1F1FF
 }
 
 func validateFval(v string) error {
@@ -60,19 +540,54 @@ func validateFuri(u string) error {
 }
 
 func main() {
-    if len(os.Args) != 2 {
-        fmt.Fprintf(os.Stderr, "Usage: %s <domain>\n", os.Args[0])
+    flag.Usage = func() {
+        fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] <domain>\n", os.Args[0])
+        flag.PrintDefaults()
+    }
+    rawUTF8 := flag.Bool("utf8", false, "emit non-ASCII UTF-8 as-is instead of \\DDD escapes")
+    fcodStore := flag.String("fcod-store", "fcod-store.json", "JSON file mapping minted fcod codes to landing pages")
+    fcodPrefix := flag.String("fcod-prefix", "", "party prefix for minted fcod codes, e.g. EXCO")
+    fcodEncoding := flag.String("fcod-encoding", "base64", "how minted fcod codes are formed: base64 (of the landing URL) or opaque")
+    fcodURL := flag.String("fcod-url", "", "mint an fcod code for this landing page, print its TXT record and exit")
+    specialUseFile := flag.String("special-use", "", "IANA special-use domain names registry (CSV or one name per line) extending the built-in list")
+    flag.Parse()
+
+    if flag.NArg() != 1 {
+        flag.Usage()
         os.Exit(2)
     }
-    domain := strings.TrimSpace(os.Args[1])
+    domain := strings.TrimSpace(flag.Arg(0))
     if domain == "" {
         fmt.Fprintln(os.Stderr, "Domain must not be empty")
         os.Exit(2)
     }
+    if *specialUseFile != "" {
+        if err := loadSpecialUseNames(*specialUseFile); err != nil {
+            fmt.Fprintln(os.Stderr, "Cannot load special-use domain names:", err)
+            os.Exit(2)
+        }
+    }
+    // records for special-use names would be out of scope or ignored
+    if su, ok := lookupSpecialUse(domain); ok {
+        fmt.Fprintf(os.Stderr, "Not generating a record for %s - %s\n", domain, su)
+        os.Exit(exitOutOfScope)
+    }
+
+    if *fcodURL != "" {
+        code, err := mintFcod(*fcodStore, *fcodPrefix, *fcodURL, *fcodEncoding, domain)
+        if err != nil {
+            fmt.Fprintln(os.Stderr, "Cannot mint fcod code:", err)
+            os.Exit(1)
+        }
+        rdata := versionTag + "fcod=" + code
+        fmt.Printf("_for-sale.%s. IN TXT \"%s\"\n", domain, escapePresentation(rdata, *rawUTF8))
+        return
+    }
 
     fmt.Println("Generating _for-sale TXT records for domain:", domain)
 
     records := []string{}
+    recordLens := []int{} // RDATA octets per record, for the view listing
     seenPairs := make(map[string]struct{})
 
     for {
@@ -93,8 +608,8 @@ func main() {
             if len(records) == 0 {
                 fmt.Println("  (none yet)")
             } else {
-                for _, r := range records {
-                    fmt.Println("  " + r)
+                for i, r := range records {
+                    fmt.Printf("  %s  ; %d/%d octets\n", r, recordLens[i], maxTxtStr)
                 }
             }
             continue
@@ -105,7 +620,7 @@ func main() {
         case "1":
             tag = "fval"
             for {
-                v := ask("Enter asking price (or type 'cancel' to return): ")
+                v := askValue("asking price")
                 if strings.ToLower(v) == "cancel" {
                     fmt.Println("Cancelled, returning to main menu.")
                     tag, value = "", ""
@@ -115,13 +630,17 @@ func main() {
                     fmt.Println("Invalid:", err)
                     continue
                 }
+                v, ok := checkLength(v, false)
+                if !ok {
+                    continue
+                }
                 value = v
                 break
             }
         case "2":
             tag = "furi"
             for {
-                v := ask("Enter contact URI (or type 'cancel' to return): ")
+                v := askValue("contact URI")
                 if strings.ToLower(v) == "cancel" {
                     fmt.Println("Cancelled, returning to main menu.")
                     tag, value = "", ""
@@ -131,13 +650,17 @@ func main() {
                     fmt.Println("Invalid:", err)
                     continue
                 }
+                v, ok := checkLength(v, false)
+                if !ok {
+                    continue
+                }
                 value = v
                 break
             }
         case "3":
             tag = "ftxt"
             for {
-                v := ask("Enter free text (or type 'cancel' to return): ")
+                v := askValue("free text")
                 if strings.ToLower(v) == "cancel" {
                     fmt.Println("Cancelled, returning to main menu.")
                     tag, value = "", ""
@@ -147,22 +670,44 @@ func main() {
                     fmt.Println("Invalid: must not be empty")
                     continue
                 }
+                v, ok := checkLength(v, true)
+                if !ok {
+                    continue
+                }
                 value = v
                 break
             }
         case "4":
             tag = "fcod"
             for {
-                v := ask("Enter code value (or type 'cancel' to return): ")
+                v := askValue("code value, or 'mint' to generate one from a landing page")
                 if strings.ToLower(v) == "cancel" {
                     fmt.Println("Cancelled, returning to main menu.")
                     tag, value = "", ""
                     break
                 }
+                if strings.ToLower(v) == "mint" {
+                    prefix := *fcodPrefix
+                    if prefix == "" {
+                        prefix = strings.ToUpper(ask("Enter party prefix (e.g. EXCO): "))
+                    }
+                    landing := ask("Enter sales landing page URL: ")
+                    code, err := mintFcod(*fcodStore, prefix, landing, *fcodEncoding, domain)
+                    if err != nil {
+                        fmt.Println("Invalid:", err)
+                        continue
+                    }
+                    fmt.Printf("Minted %s (stored in %s)\n", code, *fcodStore)
+                    v = code
+                }
                 if len(v) < 1 {
                     fmt.Println("Invalid: must not be empty")
                     continue
                 }
+                v, ok := checkLength(v, false)
+                if !ok {
+                    continue
+                }
                 value = v
                 break
             }
@@ -176,17 +721,28 @@ func main() {
             continue
         }
 
-        valueEsc := escapeQuotes(value)
-        key := tag + "=" + valueEsc
+        key := tag + "=" + value
         if _, exists := seenPairs[key]; exists {
             fmt.Println("Duplicate record detected — not allowed by the draft. Skipping.")
             continue
         }
+
+        rdata := versionTag + key
+        if len(rdata) > maxTxtStr {
+            // cannot happen with a value <= maxValueLen, but never emit an oversized string
+            fmt.Printf("Invalid: record is %d octets, exceeds the %d-octet character-string limit. Skipping.\n", len(rdata), maxTxtStr)
+            continue
+        }
+        record := fmt.Sprintf(`_for-sale.%s. IN TXT "%s"`, domain, escapePresentation(rdata, *rawUTF8))
+        if err := verifyRoundTrip(record, rdata); err != nil {
+            fmt.Println("Internal error: record does not round-trip:", err)
+            continue
+        }
         seenPairs[key] = struct{}{}
 
-        record := fmt.Sprintf(`_for-sale.%s. IN TXT "v=FORSALE1;%s=%s"`, domain, tag, valueEsc)
         records = append(records, record)
-        fmt.Println("Record added.")
+        recordLens = append(recordLens, len(rdata))
+        fmt.Printf("Record added (%d/%d octets).\n", len(rdata), maxTxtStr)
     }
 
     fmt.Println("\nFinal DNS zone file snippet:")
@@ -0,0 +1,88 @@
+package main
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestValuePrompt(t *testing.T) {
+    tests := []struct {
+        n    int
+        want string
+    }{
+        {0, "[239 octets left]"},
+        {39, "[200 octets left]"},
+        {239, "[0 octets left]"},
+        {250, "[11 octets over]"},
+    }
+    for _, tt := range tests {
+        if got := valuePrompt("free text", tt.n); !strings.Contains(got, tt.want) {
+            t.Errorf("valuePrompt(%d) = %q, want it to contain %q", tt.n, got, tt.want)
+        }
+    }
+}
+
+func TestTruncateGraphemes(t *testing.T) {
+    tests := []struct {
+        name string
+        s    string
+        max  int
+        want string
+    }{
+        {"fits", "hello", 10, "hello"},
+        {"ascii", "hello", 3, "hel"},
+        {"not inside a code point", "héllo", 2, "h"},
+        {"combining mark kept with its base", "aéb", 3, "a"},
+        {"regional indicator pair", "🇳🇱🇧🇪", 9, "🇳🇱"},
+        {"ZWJ sequence", "x👩‍💻", 8, "x"},
+        {"skin tone modifier", "👍🏽!", 5, ""},
+        {"CRLF", "a\r\nb", 2, "a"},
+    }
+    for _, tt := range tests {
+        if got := truncateGraphemes(tt.s, tt.max); got != tt.want {
+            t.Errorf("%s: truncateGraphemes(%q, %d) = %q, want %q", tt.name, tt.s, tt.max, got, tt.want)
+        }
+    }
+}
+
+func TestEscapePresentationRoundTrip(t *testing.T) {
+    tests := []struct {
+        s       string
+        rawUTF8 bool
+        want    string
+    }{
+        {`v=FORSALE1;ftxt=say "hi"`, false, `v=FORSALE1;ftxt=say \"hi\"`},
+        {`back\slash`, false, `back\\slash`},
+        {"é", false, `\195\169`},
+        {"é", true, "é"},
+        {"tab\there", true, `tab\009here`},
+        {"\u0085", true, `\194\133`},
+        {"\xff", true, `\255`},
+    }
+    for _, tt := range tests {
+        got := escapePresentation(tt.s, tt.rawUTF8)
+        if got != tt.want {
+            t.Errorf("escapePresentation(%q, %v) = %q, want %q", tt.s, tt.rawUTF8, got, tt.want)
+        }
+        if err := verifyRoundTrip(`_for-sale.example.nl. IN TXT "`+got+`"`, tt.s); err != nil {
+            t.Errorf("escapePresentation(%q, %v): %v", tt.s, tt.rawUTF8, err)
+        }
+    }
+}
+
+func TestVerifyRoundTripRejects(t *testing.T) {
+    tests := []struct {
+        record string
+        want   string
+    }{
+        {`_for-sale.example.nl. IN TXT "v=FORSALE1;" "ftxt=x"`, "v=FORSALE1;ftxt=x"},
+        {`_for-sale.example.nl. IN TXT "v=FORSALE1;ftxt=\195"`, "v=FORSALE1;ftxt=é"},
+        {`_for-sale.example.nl. IN TXT "v=FORSALE1;ftxt=a\"`, `v=FORSALE1;ftxt=a\`},
+        {`_for-sale.example.nl. IN A 192.0.2.1`, "v=FORSALE1;"},
+    }
+    for _, tt := range tests {
+        if err := verifyRoundTrip(tt.record, tt.want); err == nil {
+            t.Errorf("verifyRoundTrip(%q, %q) succeeded, want an error", tt.record, tt.want)
+        }
+    }
+}
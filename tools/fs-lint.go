@@ -0,0 +1,1828 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/miekg/dns"
+	"golang.org/x/net/idna"
+	"gopkg.in/yaml.v3"
+)
+
+// fs-lint: checks the _for-sale TXT records in a DNS-as-code repository
+//
+// Usage: fs-lint [flags] [path ...]
+//
+// Finds the _for-sale TXT records in BIND zone files, octoDNS YAML and
+// dnscontrol configurations below the given paths (default: the current
+// directory) and validates them with the rules of fs-check-new.go, so that
+// a pre-commit hook or CI job can stop non-conformant records before they
+// are published.
+//
+// Flags:
+//   -format f          report format: text (default), github (workflow annotations),
+//                      sarif, junit or checkstyle
+//   -o file            write the report to file instead of stdout
+//   -strict            fail on warnings too
+//   -brands file       protected names (one per line) that furi hosts must not be confusable with
+//   -confusables file  UTS #39 confusables.txt to extend the built-in look-alike table
+//   -special-use file  IANA special-use domain names registry extending the built-in list
+//
+// Files (directories named .git, node_modules and vendor are skipped):
+//   BIND        *.zone, *.db, db.*, and other files with a $ORIGIN or $TTL directive;
+//               the origin is taken from $ORIGIN, otherwise from the file name
+//               (example.nl.zone, db.example.nl)
+//   octoDNS     *.yaml, *.yml; the zone is the file name (example.nl.yaml), ';' must be escaped as '\;'
+//   dnscontrol  *.js; the zone is the enclosing D("example.nl", ...) or D_EXTEND(...)
+//   Files given explicitly that are not YAML or JavaScript are read as BIND zone files.
+//
+// Exit codes:
+//   0 : no errors (with -strict: no warnings either)
+//   1 : errors found
+//   3 : usage error or unreadable file
+
+// finding is one problem, reported at a file position.
+type finding struct {
+	File     string
+	Line     int
+	Severity string // "error", "warning" or "note"
+	Rule     string // one of lintRules
+	Message  string
+}
+
+// result holds the findings for one record, or for one statement that could
+// not be parsed (Name is empty then).
+type result struct {
+	File     string
+	Line     int
+	Name     string
+	Findings []finding
+}
+
+// lintRules are the rule identifiers used in findings, with a description
+// for SARIF and checkstyle consumers.
+var lintRules = []struct{ ID, Description string }{
+	{"rdata", "TXT RDATA is not a single character-string of at most 255 octets"},
+	{"multi-part", "TXT record has more than one character-string; the draft recommends a single one"},
+	{"ttl", "TTL exceeds the recommended 3600 seconds"},
+	{"version-tag", "record does not start with the exact version tag v=FORSALE1;"},
+	{"content-tag", "content is not exactly one fcod, ftxt, furi or fval tag-value pair"},
+	{"fcod", "fcod value is empty or too long"},
+	{"ftxt", "ftxt value is empty or too long"},
+	{"furi", "furi value is not a valid URI or IRI"},
+	{"furi-scheme", "furi uses a scheme other than http, https, mailto or tel"},
+	{"fval", "fval value is not a currency followed by an amount"},
+	{"unicode", "content is not valid UTF-8 or contains control characters or non-characters"},
+	{"security", "content has bidirectional controls or zero-width characters, or a host confusable with a protected name"},
+	{"rrset-ttl", "records of one RRset have different TTLs (RFC 2181 section 5.2)"},
+	{"placement", "_for-sale is not the leftmost label of the owner name"},
+	{"special-use", "record under a special-use domain name, to which the draft does not apply"},
+	{"syntax", "record could not be parsed"},
+}
+
+// foundRecord is a _for-sale TXT record found in a file.
+type foundRecord struct {
+	File string
+	Line int
+	TXT  *dns.TXT
+}
+
+// skipDirs are never descended into.
+var skipDirs = map[string]bool{".git": true, "node_modules": true, "vendor": true}
+
+var zoneDirectiveRe = regexp.MustCompile(`(?m)^\$(ORIGIN|TTL)\s`)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [path ...]\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "Example: %s -format github zones/\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	format := flag.String("format", "text", "report format: text, github, sarif, junit or checkstyle")
+	outFile := flag.String("o", "", "write the report to this file instead of stdout")
+	strict := flag.Bool("strict", false, "fail on warnings too")
+	brandsFile := flag.String("brands", "", "file with protected names (one per line) that furi hosts must not be confusable with")
+	confusablesFile := flag.String("confusables", "", "UTS #39 confusables.txt extending the built-in look-alike table")
+	specialUseFile := flag.String("special-use", "", "IANA special-use domain names registry (CSV or one name per line) extending the built-in list")
+	flag.Parse()
+
+	writeReport, ok := reportFormats[*format]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q (want text, github, sarif, junit or checkstyle)\n", *format)
+		os.Exit(3)
+	}
+	if *confusablesFile != "" {
+		if err := loadConfusables(*confusablesFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load confusables: %v\n", err)
+			os.Exit(3)
+		}
+	}
+	if *brandsFile != "" {
+		if err := loadBrands(*brandsFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load brands: %v\n", err)
+			os.Exit(3)
+		}
+	}
+	if *specialUseFile != "" {
+		if err := loadSpecialUseNames(*specialUseFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load special-use domain names: %v\n", err)
+			os.Exit(3)
+		}
+	}
+
+	paths := flag.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	var results []result
+	files := 0
+	for _, p := range paths {
+		r, n, err := lintPath(p)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(3)
+		}
+		results = append(results, r...)
+		files += n
+	}
+
+	w := io.WriteCloser(os.Stdout)
+	if *outFile != "" {
+		f, err := os.Create(*outFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(3)
+		}
+		w = f
+	}
+	err := writeReport(w, results, *strict)
+	if *outFile != "" {
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+		os.Exit(3)
+	}
+
+	errs, warns, records := 0, 0, 0
+	for _, r := range results {
+		if r.Name != "" {
+			records++
+		}
+		for _, f := range r.Findings {
+			switch f.Severity {
+			case "error":
+				errs++
+			case "warning":
+				warns++
+			}
+		}
+	}
+	fmt.Fprintf(os.Stderr, "fs-lint: %d files, %d _for-sale records: %d errors, %d warnings\n", files, records, errs, warns)
+	if errs > 0 || (*strict && warns > 0) {
+		os.Exit(1)
+	}
+}
+
+// lintPath checks a file, or every candidate file below a directory. It
+// returns the results and the number of files that contained _for-sale.
+func lintPath(root string) ([]result, int, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !info.IsDir() {
+		return lintFile(root, true)
+	}
+	var results []result
+	files := 0
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && skipDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		r, n, err := lintFile(path, false)
+		results = append(results, r...)
+		files += n
+		return err
+	})
+	return results, files, err
+}
+
+// lintFile checks the _for-sale records in one file. Files that do not
+// mention _for-sale, or are not in a supported format, are skipped.
+func lintFile(path string, explicit bool) ([]result, int, error) {
+	base := strings.ToLower(filepath.Base(path))
+	ext := filepath.Ext(base)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !strings.Contains(strings.ToLower(string(data)), "_for-sale") {
+		return nil, 0, nil
+	}
+
+	var records []foundRecord
+	var syntax []finding
+	switch {
+	case ext == ".yaml" || ext == ".yml":
+		records, syntax = parseOctoDNS(path, data)
+	case ext == ".js":
+		records, syntax = parseDNSControl(path, data)
+	case explicit || ext == ".zone" || ext == ".db" || strings.HasPrefix(base, "db.") || zoneDirectiveRe.Match(data):
+		records, syntax = parseBIND(path, data)
+	default:
+		return nil, 0, nil
+	}
+
+	var results []result
+	for _, f := range syntax {
+		results = append(results, result{File: f.File, Line: f.Line, Findings: []finding{f}})
+	}
+	results = append(results, lintRecords(records)...)
+	slices.SortStableFunc(results, func(a, b result) int { return a.Line - b.Line })
+	return results, 1, nil
+}
+
+// lintRecords validates the records of one file with the rules of
+// fs-check-new.go and checks each RRset for consistent TTLs.
+func lintRecords(records []foundRecord) []result {
+	var results []result
+	rrsets := map[string][]int{} // owner -> indexes into results
+	for _, rec := range records {
+		name := strings.ToLower(rec.TXT.Hdr.Name)
+		r := result{File: rec.File, Line: rec.Line, Name: rec.TXT.Hdr.Name}
+		add := func(severity, rule, msg string) {
+			r.Findings = append(r.Findings, finding{rec.File, rec.Line, severity, rule, msg})
+		}
+		domain := strings.TrimSuffix(strings.TrimPrefix(name, "_for-sale."), ".")
+		su, special := lookupSpecialUse(domain)
+		switch {
+		case !strings.HasPrefix(name, "_for-sale."):
+			add("error", "placement", fmt.Sprintf("%s is below _for-sale; the _for-sale label must be the leaf (non-conformant placement), record would be ignored", rec.TXT.Hdr.Name))
+		case special && domain != "":
+			add("warning", "special-use", fmt.Sprintf("Domain %q is out of scope - %s", domain, su))
+		default:
+			// notes explain the verdict and are left out
+			for _, f := range analyzeTXT(rec.TXT).Findings {
+				switch {
+				case f.Severity == "note":
+				case f.Rule == "ttl":
+					// the TTL is the one in the file, not from a resolver cache
+					add(f.Severity, f.Rule, fmt.Sprintf("TTL=%d exceeds the recommended 3600s (1 hour).", rec.TXT.Hdr.Ttl))
+				default:
+					add(f.Severity, f.Rule, f.Message)
+				}
+			}
+			rrsets[name] = append(rrsets[name], len(results))
+		}
+		results = append(results, r)
+	}
+
+	for _, idx := range rrsets {
+		ttls := map[uint32]bool{}
+		var seen []string
+		for _, i := range idx {
+			ttl := records[i].TXT.Hdr.Ttl
+			if !ttls[ttl] {
+				ttls[ttl] = true
+				seen = append(seen, strconv.FormatUint(uint64(ttl), 10))
+			}
+		}
+		if len(ttls) > 1 {
+			first := &results[idx[0]]
+			first.Findings = append(first.Findings, finding{first.File, first.Line, "warning", "rrset-ttl",
+				fmt.Sprintf("TXT RRset %s contains records with differing TTLs (%s); RRset TTLs must be the same per RFC2181 Section 5.2", first.Name, strings.Join(seen, ", "))})
+		}
+	}
+	return results
+}
+
+// parseBIND finds the _for-sale TXT records in a BIND zone file. Only the
+// statements whose owner has a _for-sale label are parsed (by miekg/dns), so
+// that each record keeps the line it starts on; $ORIGIN, $TTL and owner
+// inheritance are followed. $INCLUDE and $GENERATE are not.
+func parseBIND(path string, data []byte) ([]foundRecord, []finding) {
+	var records []foundRecord
+	var findings []finding
+	origin := zoneFromFileName(path)
+	ttlDirective := ""
+	owner := origin
+	lines := strings.Split(string(data), "\n")
+	for i := 0; i < len(lines); i++ {
+		start := i + 1
+		stmt := stripZoneComment(lines[i])
+		for parenDepth(stmt) > 0 && i+1 < len(lines) {
+			i++
+			stmt += " " + stripZoneComment(lines[i])
+		}
+		fields := strings.Fields(stmt)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "$ORIGIN":
+			if len(fields) > 1 {
+				origin = absoluteName(fields[1], origin)
+			}
+			continue
+		case "$TTL":
+			ttlDirective = strings.TrimSpace(stmt)
+			continue
+		case "$INCLUDE", "$GENERATE":
+			continue
+		}
+		rest := stmt
+		if r, _ := utf8.DecodeRuneInString(stmt); !unicode.IsSpace(r) {
+			owner = absoluteName(fields[0], origin)
+			rest = strings.TrimSpace(stmt)[len(fields[0]):]
+		}
+		if !hasForSaleLabel(owner) {
+			continue
+		}
+
+		zp := dns.NewZoneParser(strings.NewReader(ttlDirective+"\n"+owner+" "+rest+"\n"), origin, "")
+		zp.SetDefaultTTL(3600)
+		rr, _ := zp.Next()
+		if err := zp.Err(); err != nil {
+			findings = append(findings, finding{path, start, "error", "syntax", zoneParseMessage(err)})
+			continue
+		}
+		if t, ok := rr.(*dns.TXT); ok {
+			records = append(records, foundRecord{path, start, t})
+		}
+	}
+	return records, findings
+}
+
+var parseErrorLineRe = regexp.MustCompile(` at line: \d+:\d+$`)
+
+// zoneParseMessage drops the position from a miekg/dns parse error; it
+// refers to the single statement given to the parser, not to the file.
+func zoneParseMessage(err error) string {
+	return parseErrorLineRe.ReplaceAllString(strings.TrimPrefix(err.Error(), "dns: "), "")
+}
+
+// stripZoneComment removes a ';' comment, ignoring ';' in quoted strings and
+// escaped ones.
+func stripZoneComment(line string) string {
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		case ';':
+			if !quoted {
+				return line[:i]
+			}
+		}
+	}
+	return line
+}
+
+// parenDepth returns the number of unclosed parentheses outside quoted strings.
+func parenDepth(s string) int {
+	depth := 0
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		case '(':
+			if !quoted {
+				depth++
+			}
+		case ')':
+			if !quoted {
+				depth--
+			}
+		}
+	}
+	return depth
+}
+
+// zoneFromFileName derives the zone from names such as example.nl.zone,
+// example.nl.yaml or db.example.nl; it is the root if nothing is left.
+func zoneFromFileName(path string) string {
+	base := filepath.Base(path)
+	base = strings.TrimPrefix(base, "db.")
+	for _, ext := range []string{".zone", ".db", ".hosts", ".txt", ".yaml", ".yml"} {
+		base = strings.TrimSuffix(base, ext)
+	}
+	if _, ok := dns.IsDomainName(base); !ok || base == "" {
+		return "."
+	}
+	return dns.Fqdn(base)
+}
+
+// absoluteName makes a zone file name absolute; "@" is the origin.
+func absoluteName(name, origin string) string {
+	switch {
+	case name == "@":
+		return origin
+	case dns.IsFqdn(name):
+		return name
+	case origin == ".":
+		return name + "."
+	}
+	return name + "." + origin
+}
+
+// hasForSaleLabel reports whether one of the labels of name is _for-sale.
+func hasForSaleLabel(name string) bool {
+	for _, label := range dns.SplitDomainName(name) {
+		if strings.EqualFold(label, "_for-sale") {
+			return true
+		}
+	}
+	return false
+}
+
+// chunkTXT splits raw content into character-strings of at most 255 octets
+// in presentation form, as octoDNS and dnscontrol do for long values.
+func chunkTXT(raw []byte) []string {
+	var parts []string
+	for len(raw) > maxTxtStr {
+		parts = append(parts, escapeTXT(raw[:maxTxtStr]))
+		raw = raw[maxTxtStr:]
+	}
+	return append(parts, escapeTXT(raw))
+}
+
+// parseOctoDNS finds the _for-sale TXT records in an octoDNS zone file:
+// a mapping from names relative to the zone to one record or a list of them,
+// e.g.
+//
+//	_for-sale:
+//	  type: TXT
+//	  value: v=FORSALE1\;fval=EUR999
+//
+// octoDNS requires ';' in TXT values to be escaped, and splits long values.
+func parseOctoDNS(path string, data []byte) ([]foundRecord, []finding) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		line := 1
+		if m := yamlLineRe.FindStringSubmatch(err.Error()); m != nil {
+			line, _ = strconv.Atoi(m[1])
+		}
+		return nil, []finding{{path, line, "error", "syntax", err.Error()}}
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	zone := zoneFromFileName(path)
+
+	var records []foundRecord
+	var findings []finding
+	root := doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, val := root.Content[i], root.Content[i+1]
+		if !hasForSaleLabel(key.Value) {
+			continue
+		}
+		owner := absoluteName(key.Value, zone)
+		entries := []*yaml.Node{val}
+		if val.Kind == yaml.SequenceNode {
+			entries = val.Content
+		}
+		for _, e := range entries {
+			fields := yamlMap(e)
+			if t := fields["type"]; t == nil || t.Value != "TXT" {
+				continue
+			}
+			ttl := uint32(3600) // octoDNS default
+			if n := fields["ttl"]; n != nil {
+				v, err := strconv.ParseUint(n.Value, 10, 32)
+				if err != nil {
+					findings = append(findings, finding{path, n.Line, "error", "syntax", fmt.Sprintf("invalid ttl %q", n.Value)})
+					continue
+				}
+				ttl = uint32(v)
+			}
+			var values []*yaml.Node
+			if v := fields["value"]; v != nil {
+				values = append(values, v)
+			}
+			if v := fields["values"]; v != nil {
+				if v.Kind == yaml.SequenceNode {
+					values = append(values, v.Content...)
+				} else {
+					values = append(values, v)
+				}
+			}
+			for _, v := range values {
+				if v.Kind != yaml.ScalarNode {
+					findings = append(findings, finding{path, v.Line, "error", "syntax", "TXT value is not a string"})
+					continue
+				}
+				raw, escaped := unescapeOctoDNS(v.Value)
+				if !escaped {
+					findings = append(findings, finding{path, v.Line, "error", "syntax", `unescaped ';' in TXT value; octoDNS requires it to be written as '\;'`})
+				}
+				t := &dns.TXT{Hdr: dns.RR_Header{Name: owner, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: ttl}, Txt: chunkTXT([]byte(raw))}
+				records = append(records, foundRecord{path, v.Line, t})
+			}
+		}
+	}
+	return records, findings
+}
+
+var yamlLineRe = regexp.MustCompile(`line (\d+)`)
+
+// yamlMap returns the scalar keys of a mapping node with their values.
+func yamlMap(n *yaml.Node) map[string]*yaml.Node {
+	m := map[string]*yaml.Node{}
+	if n.Kind != yaml.MappingNode {
+		return m
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		m[n.Content[i].Value] = n.Content[i+1]
+	}
+	return m
+}
+
+// unescapeOctoDNS turns "\;" into ";". escaped is false if the value has a
+// ';' without a backslash, which octoDNS rejects.
+func unescapeOctoDNS(s string) (raw string, escaped bool) {
+	escaped = true
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == ';':
+			sb.WriteByte(';')
+			i++
+		case s[i] == ';':
+			escaped = false
+			sb.WriteByte(';')
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String(), escaped
+}
+
+var (
+	dnscontrolCallRe = regexp.MustCompile(`\b(D|D_EXTEND|DefaultTTL|TXT)\(\s*`)
+	dnscontrolTTLRe  = regexp.MustCompile(`\bTTL\(\s*(\d+)\s*\)`)
+)
+
+// parseDNSControl finds the _for-sale TXT records in a dnscontrol
+// configuration, e.g.
+//
+//	D("example.nl", REG_NONE, DnsProvider(DNS),
+//		TXT("_for-sale", "v=FORSALE1;fval=EUR999", TTL(3600)),
+//	);
+//
+// A string value is split into character-strings of 255 octets as dnscontrol
+// does; an array of strings gives the character-strings explicitly. Values
+// that are not string literals (variables, expressions) cannot be checked.
+func parseDNSControl(path string, data []byte) ([]foundRecord, []finding) {
+	src := blankJSComments(string(data))
+	lineAt := func(off int) int { return strings.Count(src[:off], "\n") + 1 }
+
+	var records []foundRecord
+	var findings []finding
+	zone := "."
+	defaultTTL := uint32(300) // dnscontrol default
+	for _, m := range dnscontrolCallRe.FindAllStringSubmatchIndex(src, -1) {
+		call, pos := src[m[2]:m[3]], m[1]
+		switch call {
+		case "D", "D_EXTEND":
+			if name, _, ok := parseJSString(src, pos); ok {
+				zone = dns.Fqdn(name)
+				defaultTTL = 300
+			}
+			continue
+		case "DefaultTTL":
+			if v, err := strconv.ParseUint(strings.TrimSpace(src[pos:pos+strings.IndexByte(src[pos:], ')')]), 10, 32); err == nil {
+				defaultTTL = uint32(v)
+			}
+			continue
+		}
+
+		label, end, ok := parseJSString(src, pos)
+		if !ok || !hasForSaleLabel(label) {
+			continue
+		}
+		line := lineAt(m[0])
+		pos = skipJSSpace(src, end)
+		if pos >= len(src) || src[pos] != ',' {
+			findings = append(findings, finding{path, line, "error", "syntax", "TXT() without a value"})
+			continue
+		}
+		pos = skipJSSpace(src, pos+1)
+
+		var parts []string
+		switch {
+		case pos < len(src) && src[pos] == '[':
+			pos = skipJSSpace(src, pos+1)
+			for pos < len(src) && src[pos] != ']' {
+				s, e, ok := parseJSString(src, pos)
+				if !ok {
+					break
+				}
+				parts = append(parts, escapeTXT([]byte(s)))
+				pos = skipJSSpace(src, e)
+				if pos < len(src) && src[pos] == ',' {
+					pos = skipJSSpace(src, pos+1)
+				}
+			}
+			if pos >= len(src) || src[pos] != ']' {
+				parts = nil
+			}
+		default:
+			if s, e, ok := parseJSString(src, pos); ok {
+				parts = chunkTXT([]byte(s))
+				pos = e
+			}
+		}
+		if parts == nil {
+			findings = append(findings, finding{path, line, "note", "syntax", "TXT value is not a string literal or array of string literals; not checked"})
+			continue
+		}
+
+		ttl := defaultTTL
+		if args := src[pos:callEnd(src, pos)]; dnscontrolTTLRe.MatchString(args) {
+			v, _ := strconv.ParseUint(dnscontrolTTLRe.FindStringSubmatch(args)[1], 10, 32)
+			ttl = uint32(v)
+		}
+		owner := label
+		if !dns.IsFqdn(label) {
+			owner = absoluteName(label, zone)
+		}
+		t := &dns.TXT{Hdr: dns.RR_Header{Name: owner, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: ttl}, Txt: parts}
+		records = append(records, foundRecord{path, line, t})
+	}
+	return records, findings
+}
+
+// parseJSString parses the JavaScript string literal at src[i:] and returns
+// its value and the offset just after it. Template literals with
+// substitutions are not string literals.
+func parseJSString(src string, i int) (string, int, bool) {
+	if i >= len(src) {
+		return "", i, false
+	}
+	q := src[i]
+	if q != '"' && q != '\'' && q != '`' {
+		return "", i, false
+	}
+	var sb strings.Builder
+	for i++; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == q:
+			return sb.String(), i + 1, true
+		case c == '$' && q == '`' && i+1 < len(src) && src[i+1] == '{':
+			return "", i, false
+		case c == '\n' && q != '`':
+			return "", i, false
+		case c == '\\' && i+1 < len(src):
+			i++
+			switch e := src[i]; e {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case 'r':
+				sb.WriteByte('\r')
+			case 'b':
+				sb.WriteByte('\b')
+			case 'f':
+				sb.WriteByte('\f')
+			case 'v':
+				sb.WriteByte('\v')
+			case '0':
+				sb.WriteByte(0)
+			case '\n':
+				// line continuation
+			case 'x', 'u':
+				n, width := 2, 0
+				digits := ""
+				if e == 'u' {
+					n = 4
+					if i+1 < len(src) && src[i+1] == '{' {
+						if j := strings.IndexByte(src[i:], '}'); j > 0 {
+							digits, width = src[i+2:i+j], j
+						}
+					}
+				}
+				if digits == "" && i+n < len(src) {
+					digits, width = src[i+1:i+1+n], n
+				}
+				v, err := strconv.ParseUint(digits, 16, 32)
+				if err != nil {
+					return "", i, false
+				}
+				sb.WriteRune(rune(v))
+				i += width
+			default:
+				sb.WriteByte(e)
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", i, false
+}
+
+func skipJSSpace(src string, i int) int {
+	for i < len(src) && strings.IndexByte(" \t\r\n", src[i]) >= 0 {
+		i++
+	}
+	return i
+}
+
+// callEnd returns the offset of the ')' that closes the call src[i:] is in.
+func callEnd(src string, i int) int {
+	depth := 0
+	for ; i < len(src); i++ {
+		switch src[i] {
+		case '"', '\'', '`':
+			if _, e, ok := parseJSString(src, i); ok {
+				i = e - 1
+			}
+		case '(', '[':
+			depth++
+		case ')', ']':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return len(src)
+}
+
+// blankJSComments replaces // and /* */ comments by spaces, keeping
+// newlines so that offsets and line numbers do not change.
+func blankJSComments(src string) string {
+	b := []byte(src)
+	for i := 0; i < len(b); i++ {
+		switch {
+		case b[i] == '"' || b[i] == '\'' || b[i] == '`':
+			if _, e, ok := parseJSString(src, i); ok {
+				i = e - 1
+			}
+		case b[i] == '/' && i+1 < len(b) && b[i+1] == '/':
+			for ; i < len(b) && b[i] != '\n'; i++ {
+				b[i] = ' '
+			}
+		case b[i] == '/' && i+1 < len(b) && b[i+1] == '*':
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				end = len(b)
+			} else {
+				end += i + 4
+			}
+			for ; i < end; i++ {
+				if b[i] != '\n' {
+					b[i] = ' '
+				}
+			}
+			i--
+		}
+	}
+	return string(b)
+}
+
+// reportFormats writes the results in each supported format.
+var reportFormats = map[string]func(w io.Writer, results []result, strict bool) error{
+	"text":       writeText,
+	"github":     writeGitHub,
+	"sarif":      writeSARIF,
+	"junit":      writeJUnit,
+	"checkstyle": writeCheckstyle,
+}
+
+func allFindings(results []result) []finding {
+	var out []finding
+	for _, r := range results {
+		out = append(out, r.Findings...)
+	}
+	return out
+}
+
+func writeText(w io.Writer, results []result, strict bool) error {
+	for _, f := range allFindings(results) {
+		if _, err := fmt.Fprintf(w, "%s:%d: %s: %s [%s]\n", f.File, f.Line, f.Severity, f.Message, f.Rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeGitHub writes GitHub Actions workflow commands, which show up as
+// annotations on the lines of the pull request.
+func writeGitHub(w io.Writer, results []result, strict bool) error {
+	escapeData := strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	escapeProp := strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+	for _, f := range allFindings(results) {
+		level := f.Severity
+		if level == "note" {
+			level = "notice"
+		}
+		if _, err := fmt.Fprintf(w, "::%s file=%s,line=%d,title=%s::%s\n", level,
+			escapeProp.Replace(filepath.ToSlash(f.File)), f.Line, escapeProp.Replace("fs-lint "+f.Rule), escapeData.Replace(f.Message)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSARIF writes a SARIF 2.1.0 log, e.g. for GitHub code scanning.
+func writeSARIF(w io.Writer, results []result, strict bool) error {
+	type message struct {
+		Text string `json:"text"`
+	}
+	type rule struct {
+		ID               string  `json:"id"`
+		ShortDescription message `json:"shortDescription"`
+	}
+	type location struct {
+		PhysicalLocation struct {
+			ArtifactLocation struct {
+				URI string `json:"uri"`
+			} `json:"artifactLocation"`
+			Region struct {
+				StartLine int `json:"startLine"`
+			} `json:"region"`
+		} `json:"physicalLocation"`
+	}
+	type sarifResult struct {
+		RuleID    string     `json:"ruleId"`
+		Level     string     `json:"level"`
+		Message   message    `json:"message"`
+		Locations []location `json:"locations"`
+	}
+
+	var rules []rule
+	for _, r := range lintRules {
+		rules = append(rules, rule{r.ID, message{r.Description}})
+	}
+	out := []sarifResult{}
+	for _, f := range allFindings(results) {
+		var loc location
+		loc.PhysicalLocation.ArtifactLocation.URI = filepath.ToSlash(f.File)
+		loc.PhysicalLocation.Region.StartLine = f.Line
+		out = append(out, sarifResult{f.Rule, f.Severity, message{f.Message}, []location{loc}})
+	}
+	log := map[string]any{
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"version": "2.1.0",
+		"runs": []any{map[string]any{
+			"tool": map[string]any{"driver": map[string]any{
+				"name":           "fs-lint",
+				"informationUri": "https://github.com/mdavids/rfc",
+				"rules":          rules,
+			}},
+			"results": out,
+		}},
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(log)
+}
+
+// writeJUnit writes one test suite per file and one test case per record
+// (or statement that could not be parsed). A test case fails on errors, and
+// with -strict on warnings; other findings go to its system-out.
+func writeJUnit(w io.Writer, results []result, strict bool) error {
+	type failure struct {
+		Message string `xml:"message,attr"`
+		Type    string `xml:"type,attr"`
+		Text    string `xml:",chardata"`
+	}
+	type testcase struct {
+		Name      string   `xml:"name,attr"`
+		Classname string   `xml:"classname,attr"`
+		File      string   `xml:"file,attr"`
+		Line      int      `xml:"line,attr"`
+		Failure   *failure `xml:"failure,omitempty"`
+		SystemOut string   `xml:"system-out,omitempty"`
+	}
+	type testsuite struct {
+		Name      string     `xml:"name,attr"`
+		Tests     int        `xml:"tests,attr"`
+		Failures  int        `xml:"failures,attr"`
+		Testcases []testcase `xml:"testcase"`
+	}
+	type testsuites struct {
+		XMLName  xml.Name    `xml:"testsuites"`
+		Name     string      `xml:"name,attr"`
+		Tests    int         `xml:"tests,attr"`
+		Failures int         `xml:"failures,attr"`
+		Suites   []testsuite `xml:"testsuite"`
+	}
+
+	all := testsuites{Name: "fs-lint"}
+	for _, r := range results {
+		if len(all.Suites) == 0 || all.Suites[len(all.Suites)-1].Name != r.File {
+			all.Suites = append(all.Suites, testsuite{Name: r.File})
+		}
+		suite := &all.Suites[len(all.Suites)-1]
+		name := r.Name
+		if name == "" {
+			name = "syntax"
+		}
+		tc := testcase{Name: fmt.Sprintf("%s (line %d)", name, r.Line), Classname: r.File, File: r.File, Line: r.Line}
+		var lines []string
+		for _, f := range r.Findings {
+			lines = append(lines, fmt.Sprintf("%s: %s [%s]", f.Severity, f.Message, f.Rule))
+			if tc.Failure == nil && (f.Severity == "error" || (strict && f.Severity == "warning")) {
+				tc.Failure = &failure{Message: f.Message, Type: f.Rule}
+			}
+		}
+		if tc.Failure != nil {
+			tc.Failure.Text = strings.Join(lines, "\n")
+			suite.Failures++
+			all.Failures++
+		} else {
+			tc.SystemOut = strings.Join(lines, "\n")
+		}
+		suite.Testcases = append(suite.Testcases, tc)
+		suite.Tests++
+		all.Tests++
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(all); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// writeCheckstyle writes checkstyle XML, which most CI systems can show.
+func writeCheckstyle(w io.Writer, results []result, strict bool) error {
+	type cserror struct {
+		Line     int    `xml:"line,attr"`
+		Severity string `xml:"severity,attr"`
+		Message  string `xml:"message,attr"`
+		Source   string `xml:"source,attr"`
+	}
+	type csfile struct {
+		Name   string    `xml:"name,attr"`
+		Errors []cserror `xml:"error"`
+	}
+	type checkstyle struct {
+		XMLName xml.Name `xml:"checkstyle"`
+		Version string   `xml:"version,attr"`
+		Files   []csfile `xml:"file"`
+	}
+
+	cs := checkstyle{Version: "4.3"}
+	for _, r := range results {
+		if len(cs.Files) == 0 || cs.Files[len(cs.Files)-1].Name != r.File {
+			cs.Files = append(cs.Files, csfile{Name: r.File})
+		}
+		file := &cs.Files[len(cs.Files)-1]
+		for _, f := range r.Findings {
+			severity := f.Severity
+			if severity == "note" {
+				severity = "info"
+			}
+			file.Errors = append(file.Errors, cserror{f.Line, severity, f.Message, "fs-lint." + f.Rule})
+		}
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(cs); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+const (
+	versionTag = "v=FORSALE1;"
+	maxTxtStr  = 255
+)
+
+var (
+	// fval: currency (one or more uppercase letters) followed by amount (digits, optional .fraction)
+	fvalRe = regexp.MustCompile(`^[A-Z]+[0-9]+(?:\.[0-9]+)?$`)
+)
+
+// recordResult holds diagnostics for one TXT RR. `Rr` is omitted from JSON.
+type recordResult struct {
+	Rr                   dns.RR          `json:"-"`
+	Content              string          `json:"content"`                    // decoded concatenated character-strings (full)
+	RawTxts              []string        `json:"raw_txts"`                   // raw presentation strings from the RR
+	RawDecodedLens       []int           `json:"raw_decoded_lens,omitempty"` // decoded octet length per raw part
+	TTL                  uint32          `json:"ttl"`
+	RawCount             int             `json:"raw_count"`              // number of character-strings as seen in the RR
+	FitsSingleCharstring bool            `json:"fits_single_charstring"` // true if concatenation fits in single char-string <=255
+	Valid                bool            `json:"valid"`
+	Ignored              bool            `json:"ignored"`
+	Tag                  string          `json:"tag,omitempty"`
+	TagValue             string          `json:"tag_value,omitempty"`
+	SanitizedValue       string          `json:"sanitized_value,omitempty"` // display-safe TagValue (with -sanitize, ftxt/furi only)
+	Messages             []string        `json:"messages,omitempty"`
+	Findings             []recordFinding `json:"-"`                    // Messages with their severity and rule
+	ConcatenatedLength   int             `json:"concatenated_length"`  // bytes
+	WireRDATA            string          `json:"wire_rdata,omitempty"` // hex RDATA as received; the octets analysed for DNS answers
+}
+
+// recordFinding is one message of the validator with its severity ("error",
+// "warning" or "note") and the rule it comes from, such as "ttl",
+// "version-tag", "furi" or "security", so that callers need not parse the
+// message text. fs-lint reports them as they are.
+type recordFinding struct {
+	Severity string
+	Rule     string
+	Message  string
+}
+
+// add records a finding and its message for display.
+func (res *recordResult) add(severity, rule, msg string) {
+	res.Findings = append(res.Findings, recordFinding{severity, rule, msg})
+	switch {
+	case rule == "security":
+		msg = "Warning (security): " + msg
+	case severity == "warning":
+		msg = "Warning: " + msg
+	}
+	res.Messages = append(res.Messages, msg)
+}
+
+// escapeTXT renders raw octets in the presentation form miekg/dns keeps in
+// TXT.Txt: '"' and '\' escaped, other non-printable octets as \DDD.
+func escapeTXT(b []byte) string {
+	var sb strings.Builder
+	for _, c := range b {
+		switch {
+		case c == '"' || c == '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case c < 0x20 || c > 0x7e:
+			fmt.Fprintf(&sb, "\\%03d", c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+// specialUse is a special-use domain name (RFC 6761). The draft puts these
+// out of scope, and records under .arpa MUST be ignored.
+type specialUse struct {
+	Name      string // without trailing dot, e.g. "onion"
+	Reference string // e.g. "RFC 7686"
+	Reason    string
+}
+
+// specialUseNames holds the special-use domain names by name: the built-in
+// list in special-use.csv, extended by the IANA registry loaded from disk.
+var specialUseNames = map[string]specialUse{}
+
+//go:embed special-use.csv
+var builtinSpecialUse string
+
+func init() {
+	addSpecialUseNames(builtinSpecialUse)
+}
+
+// loadSpecialUseNames adds the names from the IANA "Special-Use Domain
+// Names" registry, saved as CSV (special-use-domain.csv: Name,Reference) or
+// as plain text with one name per line.
+func loadSpecialUseNames(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	addSpecialUseNames(string(data))
+	return nil
+}
+
+// addSpecialUseNames adds the names in data, one per line as
+// Name[,Reference[,Reason]]. Names already known keep their entry.
+func addSpecialUseNames(data string) {
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), ",", 3)
+		name := strings.ToLower(strings.TrimSuffix(strings.Trim(fields[0], `"`), "."))
+		if name == "" || name == "name" || strings.HasPrefix(name, "#") {
+			continue
+		}
+		if _, ok := specialUseNames[name]; ok {
+			continue
+		}
+		su := specialUse{Name: name, Reason: "listed in the IANA Special-Use Domain Names registry"}
+		if len(fields) > 1 {
+			ref := strings.NewReplacer("[", "", "]", "", `"`, "").Replace(strings.TrimSpace(fields[1]))
+			if !strings.Contains(ref, "RFC ") {
+				ref = strings.Replace(ref, "RFC", "RFC ", 1)
+			}
+			su.Reference = ref
+		}
+		if len(fields) > 2 {
+			su.Reason = strings.TrimSpace(fields[2])
+		}
+		specialUseNames[name] = su
+	}
+}
+
+// lookupSpecialUse reports whether domain is, or is under, a special-use
+// domain name. The shortest match wins, so anything under .arpa is .arpa.
+func lookupSpecialUse(domain string) (specialUse, bool) {
+	labels := strings.Split(strings.ToLower(strings.TrimSuffix(domain, ".")), ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		if su, ok := specialUseNames[strings.Join(labels[i:], ".")]; ok {
+			return su, true
+		}
+	}
+	return specialUse{}, false
+}
+
+// String describes the name for the user.
+func (su specialUse) String() string {
+	if su.Name == "arpa" {
+		return "." + su.Name + ": " + su.Reason
+	}
+	ref := ""
+	if su.Reference != "" {
+		ref = " (" + su.Reference + ")"
+	}
+	return "." + su.Name + ref + ": " + su.Reason + "; the draft does not apply to special-use domain names"
+}
+
+// analyzeTXT validates a dns.TXT RR and returns a recordResult.
+// Improvements over previous logic:
+//   - Always concatenate unescaped character-strings to form the logical content.
+//   - Provide a heuristic `FitsSingleCharstring` that is true when concatenated content <=255
+//     allowing the tool to treat some multi-part TXT RRs as a single logical string for robustness.
+//   - Keep and report the raw count but do not automatically reject records simply because
+//     the server split a logical single string into multiple character-strings (common in practice).
+//   - Validate textual content for UTF-8 and forbidden control characters per the draft's recommendations.
+//   - Add a per-record TTL warning when the observed TTL exceeds the recommended 3600 seconds
+//     (noting that this may come from a resolver cache).
+//   - Add an explicit warning when TXT RRs are multi-part (raw_count>1) and report decoded per-part lengths.
+func analyzeTXT(t *dns.TXT) recordResult {
+	return analyzeCharacterStrings(t, nil)
+}
+
+// analyzeWireTXT validates a TXT RR taken from a DNS response, using the
+// character-strings as they were on the wire instead of decoding t's
+// presentation strings. t must hold the same character-strings.
+func analyzeWireTXT(t *dns.TXT, wire [][]byte) recordResult {
+	return analyzeCharacterStrings(t, wire)
+}
+
+// analyzeCharacterStrings does the work of analyzeTXT and analyzeWireTXT;
+// wire is nil when the octets have to be decoded from t's presentation form.
+func analyzeCharacterStrings(t *dns.TXT, wire [][]byte) recordResult {
+	res := recordResult{
+		TTL:      t.Hdr.Ttl,
+		RawTxts:  append([]string(nil), t.Txt...),
+		RawCount: len(t.Txt),
+	}
+
+	// Warn when observed TTL exceeds recommended value (note: may be a cached reply)
+	if res.TTL > 3600 {
+		res.add("warning", "ttl", fmt.Sprintf("observed TTL=%d exceeds the recommended 3600s (1 hour). Note: this value may come from a resolver cache and not the authoritative server.", res.TTL))
+	}
+
+	// If zero character-strings, invalid
+	if res.RawCount == 0 {
+		res.add("error", "rdata", "TXT RR contains zero character-strings (invalid).")
+		res.Valid = false
+		return res
+	}
+
+	// Decode each character-string from presentation escapes to raw bytes (unless the wire
+	// octets are known), collect decoded lengths, then concatenate
+	var b []byte
+	decodedLens := make([]int, 0, len(t.Txt))
+	for i, part := range t.Txt {
+		if wire != nil {
+			decodedLens = append(decodedLens, len(wire[i]))
+			b = append(b, wire[i]...)
+			continue
+		}
+		ub, err := unescapePresentation(part)
+		if err != nil {
+			// record the error but continue; ub may contain partial decoded bytes
+			res.add("warning", "rdata", fmt.Sprintf("error while unescaping presentation string: %v", err))
+		}
+		decodedLens = append(decodedLens, len(ub))
+		b = append(b, ub...)
+	}
+	res.RawDecodedLens = decodedLens
+
+	res.ConcatenatedLength = len(b)
+	res.Content = string(b)
+
+	// Heuristic: consider the concatenation as a single logical string if concatenated length <= 255
+	// This handles cases where servers split long quoted string data into multiple character-strings.
+	if res.ConcatenatedLength <= maxTxtStr {
+		res.FitsSingleCharstring = true
+	} else {
+		res.FitsSingleCharstring = false
+	}
+
+	// Warn if the server split into multiple raw character-strings
+	if res.RawCount > 1 {
+		// explicit multi-part warning requested by user
+		res.add("warning", "multi-part", fmt.Sprintf("TXT RR contains %d raw character-strings (multi-part RR). The draft RECOMMENDS using a single character-string; consider converting to a single string to avoid ambiguity.", res.RawCount))
+		// If any raw part decoded length >255 (octets), it's definitely non-conformant
+		for i, decLen := range decodedLens {
+			if decLen > maxTxtStr {
+				res.add("error", "rdata", fmt.Sprintf("Raw character-string #%d decoded length %d octets exceeds 255 octets (maximum).", i, decLen))
+				// mark invalid, but continue diagnostics
+				res.Valid = false
+			}
+		}
+	}
+
+	// If concatenation exceeds 255 bytes, that's non-conformant with the draft's requirement that
+	// each TXT record's RDATA MUST be a single character-string of at most 255 bytes.
+	if res.ConcatenatedLength > maxTxtStr {
+		res.add("error", "rdata", fmt.Sprintf("Decoded concatenated content byte length %d exceeds 255 octets; this is non-conformant.", res.ConcatenatedLength))
+		// keep going to give diagnostics, but mark invalid
+		res.Valid = false
+	}
+
+	// Check version tag presence (must be at start, case-sensitive) on the concatenated content
+	content := res.Content
+	if !strings.HasPrefix(content, versionTag) {
+		// Robustness: accept versionTag followed by single space or tab (warn)
+		if strings.HasPrefix(content, versionTag+" ") || strings.HasPrefix(content, versionTag+"\t") {
+			res.add("warning", "version-tag", "Record starts with version tag followed by whitespace - accepted under robustness, but spaces are not allowed by the ABNF.")
+			rest := content[len(versionTag):]
+			if len(rest) > 0 && (rest[0] == ' ' || rest[0] == '\t') {
+				rest = rest[1:]
+			}
+			content = rest
+		} else {
+			res.add("error", "version-tag", "No valid version tag found at start of the TXT record. TXT records without the exact, case-sensitive version tag \"v=FORSALE1;\" MUST NOT be interpreted as valid _for-sale indicators (this record will be ignored).")
+			res.Ignored = true
+			res.Valid = false
+			return res
+		}
+	} else {
+		content = content[len(versionTag):]
+	}
+
+	// If no content after version tag => valid indicator with no further info
+	if content == "" {
+		res.Valid = true
+		res.add("note", "content-tag", "Record contains only the version tag and no content: valid indicator that the domain is for sale.")
+		return res
+	}
+
+	// Content must be exactly one tag-value pair
+	tags := []string{"fcod=", "ftxt=", "furi=", "fval="}
+	foundTag := ""
+	for _, tg := range tags {
+		if strings.HasPrefix(content, tg) {
+			foundTag = tg[:len(tg)-1] // remove '='
+			break
+		}
+	}
+	if foundTag == "" {
+		res.add("error", "content-tag", fmt.Sprintf("Content does not start with a recognised content tag (fcod=, ftxt=, furi=, fval=). Found content: %q", content))
+		// Per draft: if version present but content invalid, processors SHOULD assume domain is for sale
+		res.Valid = true
+		res.add("note", "content-tag", "Per the draft, since a valid version tag is present but content is invalid, processors SHOULD still treat the domain as for sale. This tool marks the record as ACCEPTED (but with warnings).")
+		return res
+	}
+
+	val := content[len(foundTag)+1:]
+	res.Tag = foundTag
+	res.TagValue = val
+
+	// detect ambiguous constructs: additional tag markers inside value
+	for _, tg := range tags {
+		needle := ";" + tg
+		if strings.Contains(val, needle) {
+			res.add("warning", "content-tag", fmt.Sprintf("The content value contains %q which looks like an additional tag-value pair. The draft REQUIRES exactly one tag-value pair per record; embedding additional tags in the value can be ambiguous.", needle))
+		}
+	}
+
+	// Validate per tag
+	switch foundTag {
+	case "fcod":
+		if len([]byte(val)) < 1 {
+			res.add("error", "fcod", "fcod= has an empty value (must be at least 1 octet).")
+			res.Valid = false
+			return res
+		}
+		if len([]byte(val)) > 239 {
+			res.add("error", "fcod", fmt.Sprintf("fcod value byte length %d exceeds the draft's maximum of 239 octets for fcod-value.", len([]byte(val))))
+			res.Valid = false
+			return res
+		}
+		// fcod is opaque; do not apply UTF-8 checks
+		res.Valid = true
+		res.add("note", "fcod", "fcod content tag is syntactically acceptable (semantic interpretation is proprietary).")
+		return res
+
+	case "ftxt":
+		// ftxt-value = 1*239OCTET
+		if len([]byte(val)) < 1 {
+			res.add("error", "ftxt", "ftxt= has an empty value (must be at least 1 octet).")
+			res.Valid = false
+			return res
+		}
+		if len([]byte(val)) > 239 {
+			res.add("error", "ftxt", fmt.Sprintf("ftxt value byte length %d exceeds the draft's maximum of 239 octets for ftxt-value.", len([]byte(val))))
+			res.Valid = false
+			return res
+		}
+
+		// New: enforce recommendations about UTF-8 / control characters:
+		warns, errs := checkUnicodeContent(val)
+		for _, w := range warns {
+			res.add("warning", "unicode", w)
+		}
+		for _, w := range checkUnicodeSecurity(val) {
+			res.add("warning", "security", w)
+		}
+		if len(errs) > 0 {
+			for _, e := range errs {
+				res.add("error", "unicode", e)
+			}
+			res.Valid = false
+			return res
+		}
+
+		res.Valid = true
+		res.add("note", "ftxt", "ftxt content tag is syntactically acceptable. Note: avoid using URIs in ftxt; prefer furi=. Ensure non-ASCII text is UTF-8 encoded.")
+		return res
+
+	case "furi":
+		if len(val) < 1 {
+			res.add("error", "furi", "furi= has an empty value (must contain exactly one URI or IRI).")
+			res.Valid = false
+			return res
+		}
+
+		// Check for recommended schemes and warn if not recommended
+		u, perr := url.Parse(val)
+		if perr == nil {
+			scheme := strings.ToLower(u.Scheme)
+			// Recommended schemes per the draft
+			recommended := map[string]bool{"http": true, "https": true, "mailto": true, "tel": true}
+			if !recommended[scheme] {
+				// Moderate warning: syntactically allowed but not recommended
+				res.add("warning", "furi-scheme", fmt.Sprintf("furi uses non-recommended scheme %q; the draft RECOMMENDS only http, https, mailto and tel. Non-recommended schemes may be unsafe; do NOT auto-follow without user confirmation.", scheme))
+				if scheme == "javascript" || scheme == "data" {
+					res.add("note", "furi-scheme", "Note: this scheme can be dangerous (may execute code or embed data). Treat as potentially unsafe and require manual review before following.")
+				}
+			}
+		}
+
+		// As with ftxt, check that textual content is valid UTF-8 and free of disallowed control characters.
+		warns, errs := checkUnicodeContent(val)
+		for _, w := range warns {
+			// for URIs, control characters are usually invalid; we treat errors strictly
+			res.add("warning", "unicode", w)
+		}
+		for _, w := range checkUnicodeSecurity(val) {
+			res.add("warning", "security", w)
+		}
+		if host := uriHost(val); host != "" {
+			for _, w := range checkHostSecurity(host) {
+				res.add("warning", "security", w)
+			}
+		}
+		if len(errs) > 0 {
+			for _, e := range errs {
+				res.add("error", "unicode", e)
+			}
+			// Let validateURI also run, but mark invalid because of disallowed characters
+			res.Valid = false
+			return res
+		}
+
+		// Now run existing validation (which provides additional syntax/semantic checks).
+		if err := validateURI(val); err != nil {
+			res.add("error", "furi", fmt.Sprintf("furi parsing error: %v", err))
+			// Per spec: URIs MUST conform; but since version tag is present, processors MAY treat as for sale while warning.
+			res.Valid = true
+			res.add("note", "furi", "Because the version tag is present, processors SHOULD treat the domain as for sale even if the furi value is syntactically invalid. This tool marks the record as ACCEPTED with warnings.")
+			return res
+		}
+
+		// If we reached here, the URI parsed and passed validateURI checks.
+		res.Valid = true
+		res.add("note", "furi", "furi content tag contains a syntactically valid URI/IRI. Do NOT auto-redirect users to this URI without prompting (security risk).")
+		return res
+
+	case "fval":
+		if len(val) < 2 {
+			res.add("error", "fval", "fval value too short (must be at least 2 characters: currency+amount).")
+			res.Valid = false
+			return res
+		}
+		if len([]byte(val)) > 239 {
+			res.add("error", "fval", fmt.Sprintf("fval value byte length %d exceeds the draft's maximum of 239 characters for fval-value.", len([]byte(val))))
+			res.Valid = false
+			return res
+		}
+		if !fvalRe.MatchString(val) {
+			res.add("error", "fval", "fval value does not conform to the required format: <CURRENCY><AMOUNT>, e.g. USD750 or BTC0.000010. Currency MUST be uppercase letters; amount MUST be digits with optional fractional part.")
+			res.Valid = false
+			return res
+		}
+		idx := firstDigitIndex(val)
+		if idx <= 0 {
+			res.add("error", "fval", "Unable to separate currency code and amount in fval value.")
+			res.Valid = false
+			return res
+		}
+		_ = val[:idx] // currency (not strictly enforcing ISO4217)
+		res.Valid = true
+		res.add("note", "fval", "fval content tag is syntactically acceptable. Note: prices are indicative only; verify with seller.")
+		return res
+
+	default:
+		res.add("error", "content-tag", fmt.Sprintf("Unknown content tag: %q", foundTag))
+		res.Valid = false
+		return res
+	}
+}
+
+// checkUnicodeContent checks that the given string is valid UTF-8 and
+// flags the presence of control characters or non-characters according to the
+// draft's recommendations.
+//
+// Returns two slices: warnings and errors. Warnings are moderate advisory notes
+// (for example: presence of tab/CR/LF which are "best avoided"); errors are
+// violations that should cause the record to be treated as invalid (e.g. other
+// control characters, C1 controls, invalid UTF-8).
+func checkUnicodeContent(s string) (warnings []string, errorsOut []string) {
+	if !utf8.ValidString(s) {
+		errorsOut = append(errorsOut, "content is not valid UTF-8; the draft RECOMMENDS UTF-8 encoding for text content")
+		return
+	}
+
+	for i, r := range s {
+		// C0 controls (U+0000..U+001F) and DEL (U+007F)
+		if r <= 0x1F || r == 0x7F {
+			// Exception per draft: U+0009 (TAB), U+000A (LF), U+000D (CR) are "best avoided" -> warn
+			if r == 0x09 || r == 0x0A || r == 0x0D {
+				warnings = append(warnings, fmt.Sprintf("contains control character U+%04X at byte index %d (TAB/CR/LF are allowed but RECOMMENDED to be avoided)", r, i))
+			} else {
+				errorsOut = append(errorsOut, fmt.Sprintf("contains disallowed control character U+%04X at byte index %d; other control characters are not permitted in content values", r, i))
+			}
+		}
+
+		// C1 controls (U+0080..U+009F) are controls and should be considered invalid
+		if r >= 0x80 && r <= 0x9F {
+			errorsOut = append(errorsOut, fmt.Sprintf("contains C1 control U+%04X at byte index %d; C1 controls are not permitted", r, i))
+		}
+
+		// Non-characters: U+FDD0..U+FDEF and any codepoint where low 16 bits are 0xFFFE or 0xFFFF
+		if (r >= 0xFDD0 && r <= 0xFDEF) || (r&0xFFFF == 0xFFFE) || (r&0xFFFF == 0xFFFF) {
+			warnings = append(warnings, fmt.Sprintf("contains Unicode non-character U+%04X at index %d; non-characters are discouraged for interchange", r, i))
+		}
+	}
+
+	return
+}
+
+// confusables maps code points to their UTS #39 prototype. Only a few common
+// look-alikes of Latin letters are built in; load the full confusables.txt
+// from unicode.org with loadConfusables for complete coverage.
+var confusables = map[rune]string{
+	'а': "a", 'в': "B", 'е': "e", 'к': "k", 'м': "M", 'н': "H", 'о': "o", 'р': "p",
+	'с': "c", 'т': "T", 'у': "y", 'х': "x", 'ѕ': "s", 'і': "i", 'ј': "j", 'һ': "h",
+	'ԁ': "d", 'ɡ': "g", 'ӏ': "l", 'ο': "o", 'α': "a", 'ν': "v", 'ρ': "p", 'ι': "i", 'κ': "k",
+	'τ': "t", 'υ': "u", 'χ': "x", 'ε': "e", 'ı': "i", 'ℓ': "l", '0': "O", '1': "l",
+}
+
+// protectedBrands maps the skeleton of each protected name to the name itself.
+var protectedBrands = map[string]string{}
+
+// loadConfusables reads confusables.txt (UTS #39 format: "0430 ;\t0061 ;\tMA\t# ...")
+// and adds its mappings to the built-in table.
+func loadConfusables(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	for n, line := range strings.Split(string(data), "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Split(line, ";")
+		if len(fields) < 2 {
+			continue
+		}
+		src, err := parseCodePoints(fields[0])
+		if err != nil || len(src) != 1 {
+			return fmt.Errorf("%s:%d: bad source code point", path, n+1)
+		}
+		dst, err := parseCodePoints(fields[1])
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", path, n+1, err)
+		}
+		confusables[src[0]] = string(dst)
+	}
+	return nil
+}
+
+// parseCodePoints parses space-separated hexadecimal code points.
+func parseCodePoints(s string) ([]rune, error) {
+	var out []rune
+	for _, f := range strings.Fields(s) {
+		v, err := strconv.ParseUint(f, 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("bad code point %q", f)
+		}
+		out = append(out, rune(v))
+	}
+	return out, nil
+}
+
+// loadBrands reads one protected name per line; empty lines and lines
+// starting with '#' are skipped.
+func loadBrands(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		protectedBrands[skeleton(line)] = line
+	}
+	return nil
+}
+
+// skeleton computes a UTS #39 style skeleton: the string is case-folded and
+// each code point is replaced by its prototype. Unlike UTS #39 no NFD
+// normalisation is done, so precomposed and decomposed forms may differ.
+func skeleton(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if p, ok := confusables[r]; ok {
+			b.WriteString(strings.ToLower(p))
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// checkUnicodeSecurity flags invisible characters that can be used to make
+// text look different from what it is: bidirectional formatting characters
+// (Trojan Source style reordering) and zero-width characters.
+func checkUnicodeSecurity(s string) (warnings []string) {
+	for i, r := range s {
+		switch {
+		case r >= 0x202A && r <= 0x202E, r >= 0x2066 && r <= 0x2069:
+			warnings = append(warnings, fmt.Sprintf("contains bidirectional override/isolate U+%04X at byte index %d; it can reorder how the text is displayed", r, i))
+		case r == 0x200E || r == 0x200F || r == 0x061C:
+			warnings = append(warnings, fmt.Sprintf("contains bidirectional mark U+%04X at byte index %d", r, i))
+		case r == 0x200B || r == 0x200C || r == 0x200D || r == 0x2060 || r == 0xFEFF:
+			warnings = append(warnings, fmt.Sprintf("contains zero-width character U+%04X at byte index %d; it is invisible when displayed", r, i))
+		}
+	}
+	return
+}
+
+// checkHostSecurity looks for homograph attacks in a host name: labels that
+// mix scripts, and names whose skeleton matches a protected brand without
+// being that brand. A-labels (xn--) are decoded first.
+func checkHostSecurity(host string) (warnings []string) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	labels := strings.Split(host, ".")
+	ulabels := make([]string, len(labels))
+	for i, l := range labels {
+		ulabels[i] = l
+		if strings.HasPrefix(l, "xn--") {
+			u, err := idna.Punycode.ToUnicode(l)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("host label %q is not valid Punycode: %v", l, err))
+				continue
+			}
+			ulabels[i] = u
+		}
+		if scripts := labelScripts(ulabels[i]); !allowedScriptMix(scripts) {
+			warnings = append(warnings, fmt.Sprintf("host label %q mixes scripts (%s); this is a common homograph technique", ulabels[i], strings.Join(scripts, ", ")))
+		}
+	}
+	if len(protectedBrands) == 0 {
+		return
+	}
+	// compare the full host and every label against the protected names
+	candidates := append([]string{strings.Join(ulabels, ".")}, ulabels...)
+	for _, c := range candidates {
+		if brand, ok := protectedBrands[skeleton(c)]; ok && c != strings.ToLower(brand) {
+			warnings = append(warnings, fmt.Sprintf("host %q is confusable with protected name %q", strings.Join(ulabels, "."), brand))
+			break
+		}
+	}
+	return
+}
+
+// labelScripts returns the sorted names of the scripts used in s, ignoring
+// Common and Inherited characters such as digits and hyphens.
+func labelScripts(s string) []string {
+	seen := map[string]bool{}
+	for _, r := range s {
+		for name, table := range unicode.Scripts {
+			if name == "Common" || name == "Inherited" {
+				continue
+			}
+			if unicode.Is(table, r) {
+				seen[name] = true
+				break
+			}
+		}
+	}
+	out := make([]string, 0, len(seen))
+	for name := range seen {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// allowedScriptMix implements the "Highly Restrictive" profile of UTS #39:
+// a single script, or Latin combined with one of the usual CJK sets.
+func allowedScriptMix(scripts []string) bool {
+	if len(scripts) <= 1 {
+		return true
+	}
+	for _, set := range [][]string{
+		{"Latin", "Han", "Hiragana", "Katakana"},
+		{"Latin", "Han", "Bopomofo"},
+		{"Latin", "Han", "Hangul"},
+	} {
+		ok := true
+		for _, s := range scripts {
+			if !slices.Contains(set, s) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// unescapePresentation decodes presentation-format escapes found in DNS zone file strings.
+// It supports:
+//   - \DDD where D are 1..3 decimal digits representing an octet value (0..255)
+//   - backslash escaping of a single character: e.g. \"  \\  \;  etc.
+//
+// This matches common DNS zone-file presentation semantics (and handles the examples
+// where TXT RDATA contains sequences like "\240\159\142\133" representing UTF-8 bytes).
+func unescapePresentation(s string) ([]byte, error) {
+	var out []byte
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		if c != '\\' {
+			out = append(out, c)
+			i++
+			continue
+		}
+		// backslash found
+		i++
+		if i >= len(s) {
+			// stray backslash at end -> treat as literal backslash
+			out = append(out, '\\')
+			break
+		}
+		// If next is digit, parse up to 3 decimal digits
+		if s[i] >= '0' && s[i] <= '9' {
+			start := i
+			end := i
+			for end < len(s) && end-start < 3 && s[end] >= '0' && s[end] <= '9' {
+				end++
+			}
+			numStr := s[start:end]
+			var val int
+			for _, ch := range numStr {
+				val = val*10 + int(ch-'0')
+			}
+			if val < 0 || val > 255 {
+				return out, fmt.Errorf("escaped decimal value out of range: %s", numStr)
+			}
+			out = append(out, byte(val))
+			i = end
+			continue
+		}
+		// Not digits: take the next character literally (as per presentation escaping)
+		out = append(out, s[i])
+		i++
+	}
+	return out, nil
+}
+
+// uriHost returns the host of an http(s) URI or the domain of a mailto URI,
+// or "" if there is none.
+func uriHost(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return ""
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return u.Hostname()
+	case "mailto":
+		addr := u.Opaque
+		if addr == "" {
+			addr = u.Path
+		}
+		if i := strings.LastIndexByte(addr, '@'); i >= 0 {
+			return strings.SplitN(addr[i+1:], ",", 2)[0]
+		}
+	}
+	return ""
+}
+
+func firstDigitIndex(s string) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= '0' && s[i] <= '9' {
+			return i
+		}
+	}
+	return -1
+}
+
+// validateURI attempts to parse the value as a URI per RFC3986.
+// net/url.Parse is used as a sanity check. A scheme is required.
+// For http(s) URIs, checks for obviously invalid host characters (e.g., backslash).
+func validateURI(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return fmt.Errorf("url.Parse failed: %w", err)
+	}
+	if u.Scheme == "" {
+		return errors.New("no URI scheme found (e.g., https, http, mailto, tel). A scheme is required for furi")
+	}
+	if strings.Contains(s, " ") {
+		return fmt.Errorf("URI contains unencoded spaces")
+	}
+	if u.Scheme == "mailto" {
+		if u.Opaque == "" && u.Path == "" {
+			return errors.New("mailto: URI contains no recipient address")
+		}
+	}
+	if u.Scheme == "tel" && u.Opaque == "" && u.Path == "" {
+		return errors.New("tel: URI contains no telephone number")
+	}
+	if u.Scheme == "http" || u.Scheme == "https" {
+		host := u.Host
+		// Strip optional port
+		if strings.Contains(host, ":") {
+			h, _, err := net.SplitHostPort(host)
+			if err == nil {
+				host = h
+			}
+		}
+		if host == "" {
+			return errors.New("http(s) URI has empty host")
+		}
+		if strings.ContainsAny(host, "\\\n\r\t\x00") {
+			return errors.New("URI host contains invalid characters")
+		}
+	}
+	return nil
+}
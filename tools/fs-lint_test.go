@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// wantRecord is a record a parser should find: its line, owner, TTL and
+// decoded content.
+type wantRecord struct {
+	line    int
+	owner   string
+	ttl     uint32
+	content string
+}
+
+func checkRecords(t *testing.T, got []foundRecord, want []wantRecord) {
+	t.Helper()
+	if len(got) != len(want) {
+		for _, r := range got {
+			t.Logf("found %s:%d %s", r.File, r.Line, r.TXT)
+		}
+		t.Fatalf("found %d records, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		r := got[i]
+		if c := analyzeTXT(r.TXT).Content; r.Line != w.line || r.TXT.Hdr.Name != w.owner || r.TXT.Hdr.Ttl != w.ttl || c != w.content {
+			t.Errorf("record %d = line %d %s %d %q, want line %d %s %d %q", i, r.Line, r.TXT.Hdr.Name, r.TXT.Hdr.Ttl, c, w.line, w.owner, w.ttl, w.content)
+		}
+	}
+}
+
+func checkFindings(t *testing.T, got []finding, want []string) {
+	t.Helper()
+	var s []string
+	for _, f := range got {
+		s = append(s, fmt.Sprintf("%s:%d %s %s", f.File, f.Line, f.Severity, f.Rule))
+	}
+	if !slices.Equal(s, want) {
+		t.Errorf("findings = %q, want %q", s, want)
+	}
+}
+
+func TestParseBIND(t *testing.T) {
+	zone := `$TTL 600
+@          IN SOA ns1 hostmaster 1 7200 3600 1209600 3600
+_for-sale  IN TXT "v=FORSALE1;fval=EUR5" ; a comment with "quotes"
+           IN TXT ( "v=FORSALE1;"
+                    "ftxt=semi\;colon" )
+www        IN A 192.0.2.1
+$ORIGIN sub.example.nl.
+_for-sale  3600 IN TXT "v=FORSALE1;fcod=X"
+_for-sale.other.nl. IN TXT "v=FORSALE1;"
+_for-sale  IN TXT "v=FORSALE1;
+`
+	records, findings := parseBIND("example.nl.zone", []byte(zone))
+	checkRecords(t, records, []wantRecord{
+		{3, "_for-sale.example.nl.", 600, "v=FORSALE1;fval=EUR5"},
+		{4, "_for-sale.example.nl.", 600, "v=FORSALE1;ftxt=semi;colon"},
+		{8, "_for-sale.sub.example.nl.", 3600, "v=FORSALE1;fcod=X"},
+		{9, "_for-sale.other.nl.", 600, "v=FORSALE1;"},
+	})
+	checkFindings(t, findings, []string{"example.nl.zone:10 error syntax"})
+}
+
+func TestParseOctoDNS(t *testing.T) {
+	yml := `---
+'':
+  type: A
+  value: 192.0.2.1
+_for-sale:
+  type: TXT
+  ttl: 600
+  values:
+  - v=FORSALE1\;fval=EUR5
+  - v=FORSALE1;ftxt=unescaped
+_for-sale.sub:
+- type: MX
+  value:
+    exchange: mx.example.nl.
+    preference: 10
+- type: TXT
+  value: v=FORSALE1\;fcod=X
+- type: TXT
+  ttl: soon
+  value: v=FORSALE1\;
+`
+	records, findings := parseOctoDNS("zones/example.nl.yaml", []byte(yml))
+	checkRecords(t, records, []wantRecord{
+		{9, "_for-sale.example.nl.", 600, "v=FORSALE1;fval=EUR5"},
+		{10, "_for-sale.example.nl.", 600, "v=FORSALE1;ftxt=unescaped"},
+		{17, "_for-sale.sub.example.nl.", 3600, "v=FORSALE1;fcod=X"},
+	})
+	checkFindings(t, findings, []string{
+		"zones/example.nl.yaml:10 error syntax",
+		"zones/example.nl.yaml:19 error syntax",
+	})
+
+	_, findings = parseOctoDNS("example.nl.yaml", []byte("_for-sale:\n  type: TXT\n\tvalue: x\n"))
+	if len(findings) != 1 || findings[0].Rule != "syntax" || findings[0].Line != 2 {
+		t.Errorf("invalid YAML: findings = %+v", findings)
+	}
+}
+
+func TestParseDNSControl(t *testing.T) {
+	js := `var DNS = NewDnsProvider("cloudflare");
+D("example.nl", REG_NONE, DnsProvider(DNS),
+	DefaultTTL(600),
+	TXT("_for-sale", "v=FORSALE1;fval=EUR999", TTL(3600)), // TXT("_for-sale", "old")
+	TXT("_for-sale.sub", ["v=FORSALE1;", "ftxt=two"]),
+	TXT("_for-sale.var", offer),
+	/* TXT("_for-sale", "commented out") */
+);
+D_EXTEND("example.org",
+	TXT("_for-sale", 'v=FORSALE1;ftxt=it\'s café'),
+	TXT("_for-sale.abs.example.com.", ` + "`v=FORSALE1;`" + `),
+);
+`
+	records, findings := parseDNSControl("dnsconfig.js", []byte(js))
+	checkRecords(t, records, []wantRecord{
+		{4, "_for-sale.example.nl.", 3600, "v=FORSALE1;fval=EUR999"},
+		{5, "_for-sale.sub.example.nl.", 600, "v=FORSALE1;ftxt=two"},
+		{10, "_for-sale.example.org.", 300, "v=FORSALE1;ftxt=it's café"},
+		{11, "_for-sale.abs.example.com.", 300, "v=FORSALE1;"},
+	})
+	if got := records[1].TXT.Txt; len(got) != 2 {
+		t.Errorf("array value = %q, want 2 character-strings", got)
+	}
+	checkFindings(t, findings, []string{"dnsconfig.js:6 note syntax"})
+}
+
+func TestParseJSString(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+		end  int
+		ok   bool
+	}{
+		{`"plain" + x`, "plain", 7, true},
+		{`'single \'quoted\''`, "single 'quoted'", 19, true},
+		{"`template`", "template", 10, true},
+		{"`with ${sub}`", "", 6, false},
+		{`"\x41é\u{1F600}\t"`, "Aé😀\t", 19, true},
+		{`"a\
+b"`, "ab", 6, true},
+		{"\"broken\nline\"", "", 7, false},
+		{`"unterminated`, "", 13, false},
+		{`nope`, "", 0, false},
+	}
+	for _, tt := range tests {
+		got, end, ok := parseJSString(tt.src, 0)
+		if got != tt.want || end != tt.end || ok != tt.ok {
+			t.Errorf("parseJSString(%q) = %q, %d, %v; want %q, %d, %v", tt.src, got, end, ok, tt.want, tt.end, tt.ok)
+		}
+	}
+}
+
+func TestLintRecords(t *testing.T) {
+	rec := func(line int, owner string, ttl uint32, txt string) foundRecord {
+		return foundRecord{"z", line, &dns.TXT{Hdr: dns.RR_Header{Name: owner, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: ttl}, Txt: []string{txt}}}
+	}
+	results := lintRecords([]foundRecord{
+		rec(1, "_for-sale.a.nl.", 3600, "v=FORSALE1;fval=EUR5"),
+		rec(2, "_for-sale.b.nl.", 7200, "v=FORSALE1;fval=EUR5"),
+		rec(3, "_for-sale.c.nl.", 3600, "v=FORSALE1;fval=eur5"),
+		rec(4, "_for-sale.d.nl.", 3600, "V=FORSALE1;"),
+		rec(5, "_for-sale.e.nl.", 3600, "v=FORSALE1;furi=ftp://e.nl/"),
+		rec(6, "_for-sale.f.nl.", 3600, "v=FORSALE1;ftxt=a\\226\\128\\174b"),
+		rec(7, "x._for-sale.g.nl.", 3600, "v=FORSALE1;"),
+		rec(8, "_for-sale.home.arpa.", 3600, "v=FORSALE1;"),
+		rec(9, "_for-sale.i.nl.", 600, "v=FORSALE1;"),
+		rec(10, "_for-sale.i.nl.", 3600, "v=FORSALE1;fval=EUR5"),
+		rec(11, "_for-sale.k.nl.", 3600, "v=FORSALE1;foo=bar"),
+	})
+	var got []finding
+	for _, r := range results {
+		got = append(got, r.Findings...)
+	}
+	checkFindings(t, got, []string{
+		"z:2 warning ttl",
+		"z:3 error fval",
+		"z:4 error version-tag",
+		"z:5 warning furi-scheme",
+		"z:6 warning security",
+		"z:7 error placement",
+		"z:8 warning special-use",
+		"z:9 warning rrset-ttl",
+		"z:11 error content-tag",
+	})
+	for _, f := range got {
+		if f.Rule == "ttl" && f.Message != "TTL=7200 exceeds the recommended 3600s (1 hour)." {
+			t.Errorf("ttl message = %q", f.Message)
+		}
+		if !slices.ContainsFunc(lintRules, func(r struct{ ID, Description string }) bool { return r.ID == f.Rule }) {
+			t.Errorf("rule %q is not in lintRules", f.Rule)
+		}
+	}
+}
+
+// testResults are findings for the report writers.
+var testResults = []result{
+	{File: "zones/a.nl.zone", Line: 3, Name: "_for-sale.a.nl.", Findings: []finding{
+		{"zones/a.nl.zone", 3, "error", "fval", "fval value does not conform"},
+		{"zones/a.nl.zone", 3, "warning", "ttl", "TTL=7200 exceeds the recommended 3600s (1 hour)."},
+	}},
+	{File: "zones/a.nl.zone", Line: 5, Name: "_for-sale.b.a.nl."},
+	{File: "dnsconfig.js", Line: 6, Findings: []finding{
+		{"dnsconfig.js", 6, "note", "syntax", `TXT value is not a string literal & "not" checked`},
+	}},
+	{File: "dnsconfig.js", Line: 7, Name: "_for-sale.c.nl.", Findings: []finding{
+		{"dnsconfig.js", 7, "warning", "multi-part", "TXT RR contains 2 raw character-strings"},
+	}},
+}
+
+func TestWriteSARIF(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeSARIF(&buf, testResults, false); err != nil {
+		t.Fatal(err)
+	}
+	var log struct {
+		Version string
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Name  string
+					Rules []struct{ ID string }
+				}
+			}
+			Results []struct {
+				RuleID    string
+				Level     string
+				Message   struct{ Text string }
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct{ URI string }
+						Region           struct{ StartLine int }
+					}
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 || len(log.Runs[0].Tool.Driver.Rules) != len(lintRules) {
+		t.Fatalf("unexpected SARIF log: %s", buf.String())
+	}
+	res := log.Runs[0].Results
+	if len(res) != 4 {
+		t.Fatalf("%d results, want 4", len(res))
+	}
+	r := res[2]
+	if r.RuleID != "syntax" || r.Level != "note" || r.Message.Text != testResults[2].Findings[0].Message ||
+		r.Locations[0].PhysicalLocation.ArtifactLocation.URI != "dnsconfig.js" || r.Locations[0].PhysicalLocation.Region.StartLine != 6 {
+		t.Errorf("result 2 = %+v", r)
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	type suites struct {
+		Tests    int `xml:"tests,attr"`
+		Failures int `xml:"failures,attr"`
+		Suites   []struct {
+			Name      string `xml:"name,attr"`
+			Tests     int    `xml:"tests,attr"`
+			Testcases []struct {
+				Name    string `xml:"name,attr"`
+				Failure *struct {
+					Type string `xml:"type,attr"`
+					Text string `xml:",chardata"`
+				} `xml:"failure"`
+				SystemOut string `xml:"system-out"`
+			} `xml:"testcase"`
+		} `xml:"testsuite"`
+	}
+	for _, tt := range []struct {
+		strict   bool
+		failures int
+	}{{false, 1}, {true, 2}} {
+		var buf bytes.Buffer
+		if err := writeJUnit(&buf, testResults, tt.strict); err != nil {
+			t.Fatal(err)
+		}
+		var got suites
+		if err := xml.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Tests != 4 || got.Failures != tt.failures || len(got.Suites) != 2 || got.Suites[0].Tests != 2 {
+			t.Fatalf("strict=%v: %s", tt.strict, buf.String())
+		}
+		tc := got.Suites[0].Testcases[0]
+		if tc.Name != "_for-sale.a.nl. (line 3)" || tc.Failure == nil || tc.Failure.Type != "fval" || !strings.Contains(tc.Failure.Text, "warning: TTL=7200") {
+			t.Errorf("strict=%v: first test case = %+v", tt.strict, tc)
+		}
+		if tc := got.Suites[1].Testcases[0]; tc.Name != "syntax (line 6)" || tc.Failure != nil || !strings.Contains(tc.SystemOut, "note:") {
+			t.Errorf("strict=%v: syntax test case = %+v", tt.strict, tc)
+		}
+	}
+}
+
+func TestWriteCheckstyle(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeCheckstyle(&buf, testResults, false); err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Files []struct {
+			Name   string `xml:"name,attr"`
+			Errors []struct {
+				Line     int    `xml:"line,attr"`
+				Severity string `xml:"severity,attr"`
+				Message  string `xml:"message,attr"`
+				Source   string `xml:"source,attr"`
+			} `xml:"error"`
+		} `xml:"file"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Files) != 2 || len(got.Files[0].Errors) != 2 || len(got.Files[1].Errors) != 2 {
+		t.Fatalf("unexpected checkstyle report: %s", buf.String())
+	}
+	e := got.Files[1].Errors[0]
+	if e.Line != 6 || e.Severity != "info" || e.Message != testResults[2].Findings[0].Message || e.Source != "fs-lint.syntax" {
+		t.Errorf("note = %+v", e)
+	}
+}
+
+// sharedDecls are copied from fs-check-new.go and must stay the same, so
+// that fs-lint applies the rules fs-check-new does.
+var sharedDecls = []string{
+	"recordFinding", "recordResult.add", "analyzeTXT", "analyzeWireTXT", "analyzeCharacterStrings",
+	"checkUnicodeContent", "checkUnicodeSecurity", "checkHostSecurity", "confusables", "loadConfusables",
+	"parseCodePoints", "loadBrands", "skeleton", "labelScripts", "allowedScriptMix",
+	"unescapePresentation", "uriHost", "firstDigitIndex", "validateURI", "escapeTXT", "fvalRe",
+	"specialUse", "specialUseNames", "builtinSpecialUse", "loadSpecialUseNames", "addSpecialUseNames",
+	"lookupSpecialUse", "specialUse.String",
+}
+
+// decls returns the source of the top-level declarations in path by name;
+// methods are named type.method.
+func decls(t *testing.T, path string) map[string]string {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := map[string]string{}
+	for _, d := range f.Decls {
+		var name string
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			name = d.Name.Name
+			if d.Recv != nil {
+				typ := d.Recv.List[0].Type
+				if star, ok := typ.(*ast.StarExpr); ok {
+					typ = star.X
+				}
+				name = typ.(*ast.Ident).Name + "." + name
+			}
+		case *ast.GenDecl:
+			switch s := d.Specs[0].(type) {
+			case *ast.TypeSpec:
+				name = s.Name.Name
+			case *ast.ValueSpec:
+				name = s.Names[0].Name
+			}
+		}
+		var buf bytes.Buffer
+		printer.Fprint(&buf, fset, d)
+		m[name] = buf.String()
+	}
+	return m
+}
+
+func TestValidatorInSyncWithFsCheckNew(t *testing.T) {
+	if _, err := os.Stat("fs-check-new.go"); err != nil {
+		t.Skip("fs-check-new.go not next to the test: ", err)
+	}
+	lint, check := decls(t, "fs-lint.go"), decls(t, "fs-check-new.go")
+	for _, name := range sharedDecls {
+		switch {
+		case lint[name] == "":
+			t.Errorf("%s is missing from fs-lint.go", name)
+		case lint[name] != check[name]:
+			t.Errorf("%s differs between fs-lint.go and fs-check-new.go", name)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+// Embeds the for-sale widget next to this script tag:
+//   <script src="https://forsale.example/widget.js" data-domain="example.nl" async></script>
+// Optional: data-lang="nl", data-width, data-height.
+(function () {
+  var s = document.currentScript;
+  if (!s || !s.dataset.domain) {
+    return;
+  }
+  var u = new URL("widget", s.src);
+  u.searchParams.set("domain", s.dataset.domain);
+  if (s.dataset.lang) {
+    u.searchParams.set("lang", s.dataset.lang);
+  }
+  var f = document.createElement("iframe");
+  f.src = u.href;
+  f.title = "_for-sale: " + s.dataset.domain;
+  f.width = s.dataset.width || "320";
+  f.height = s.dataset.height || "140";
+  f.style.border = "0";
+  f.setAttribute("sandbox", "allow-popups allow-popups-to-escape-sandbox");
+  s.parentNode.insertBefore(f, s.nextSibling);
+})();
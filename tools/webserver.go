@@ -1,20 +1,53 @@
 package main
 
-// supports version -12 of draft
+// supports version -19 of draft
 // caveats: handles _for-sale IN TXT "v=FORSALE1;" "ftxt=foo" "bar" "invalid" well
 //          (even though the draft says it's invalid)
-//          No IDNA-support (so entering δοκιμή.example won't work)
-//          Does not filter out .arpa
+//          Domains are looked up as entered: U-labels are not converted to A-labels
+//          (so entering δοκιμή.example won't work, xn--jxalpdlp.example does);
+//          golang.org/x/net/idna only decodes A-labels for the public suffix list and the
+//          homograph checks
 
 import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"embed"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"html/template"
-	"log"
+	"io"
+	"log/slog"
+	"maps"
+	"math"
 	"net"
 	"net/http"
+	"net/netip"
 	"net/url"
+	"os"
+	"os/signal"
 	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/miekg/dns"
+	"golang.org/x/net/idna"
+	"golang.org/x/text/language"
+	"golang.org/x/text/unicode/norm"
 )
 
 // DomainInfo struct contains all relevant information about the 'for-sale' status of a domain.
@@ -24,195 +57,3196 @@ type DomainInfo struct {
 	ValidTags  []string
 	InvalidRaw []string
 	ErrorMsg   string
+	// Fcods holds the interpretation of fcod values recognised by a
+	// registered FcodHandler; unrecognised codes are absent.
+	Fcods map[string]*FcodView
+	// Findings holds Unicode security warnings per valid tag (bidi controls,
+	// zero-width characters, homograph hosts).
+	Findings map[string][]string
+	// Furis holds the link decision for each furi value.
+	Furis map[string]*FuriView
+	// Registration holds RDAP/WHOIS contacts, looked up when the version
+	// tag is present but the content is absent or invalid.
+	Registration      *registrationInfo
+	RegistrationError string
+	// ContentMissing is set when the version tag is present without valid content.
+	ContentMissing bool
+	// UnreliableStatus is the registry status, e.g. "pendingDelete", during
+	// which the records are likely void.
+	UnreliableStatus string
+	// Placement classifies the domain by the Public Suffix List, if loaded.
+	Placement *placement
+	// Negative explains why there are no records: NXDOMAIN of _for-sale or
+	// of the domain itself, NODATA, SERVFAIL or a timeout.
+	Negative *negativeAnswer
+}
+
+// FcodView is how a recognised fcod value is shown in the result page.
+type FcodView struct {
+	Handler     string
+	Description string
+	Link        string // confirmation page for the landing page, if any
+}
+
+// FcodAction is a handler's interpretation of an fcod value.
+type FcodAction struct {
+	Handler     string // prefix of the handler that recognised the value
+	Description string // human-readable meaning
+	LandingPage string // sales page to offer, if any; never followed automatically
+}
+
+// FcodHandler interprets the fcod values of one party (registry, registrar
+// or marketplace). Values are matched on the prefix before the first "-",
+// e.g. "EXCO" for "EXCO-S2lscm95IHdhcyBoZXJl", as in the draft's examples.
+type FcodHandler interface {
+	Prefix() string
+	Interpret(value string) (FcodAction, error)
 }
 
 var (
-	validFVALChar = regexp.MustCompile(`^[A-Z]{3}[0-9.,]{1,236}$`)
+	// fcodHandlers holds the registered handlers by prefix.
+	fcodHandlers = map[string]FcodHandler{}
+
+	// fcodStoreAll resolves the prefixes without a registered handler, as
+	// they are in the store at the time of the request; nil unless the
+	// store serves all its prefixes.
+	fcodStoreAll *fcodStore
 )
 
-func main() {
-	http.HandleFunc("/", formHandler)
-	http.HandleFunc("/check", checkHandler)
+// registerFcodHandler adds h to the registry. A prefix can have only one
+// handler.
+func registerFcodHandler(h FcodHandler) error {
+	if _, dup := fcodHandlers[h.Prefix()]; dup {
+		return fmt.Errorf("fcod prefix %q has more than one handler", h.Prefix())
+	}
+	fcodHandlers[h.Prefix()] = h
+	return nil
+}
 
-	log.Println("Server running on http://localhost:8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+// fcodHandler returns the handler for prefix: a registered one, or the
+// store when it currently holds codes with that prefix.
+func fcodHandler(prefix string) (FcodHandler, error) {
+	if h := fcodHandlers[prefix]; h != nil {
+		return h, nil
+	}
+	if fcodStoreAll == nil {
+		return nil, nil
+	}
+	prefixes, err := fcodStoreAll.prefixes()
+	if err != nil || !slices.Contains(prefixes, prefix) {
+		return nil, err
+	}
+	return storeFcodHandler{prefix: prefix, store: fcodStoreAll}, nil
 }
 
-func formHandler(w http.ResponseWriter, r *http.Request) {
-	tmpl := template.Must(template.New("form").Parse(`
-		<!DOCTYPE html>
-		<html lang="en">
-		<head>
-		  <title>For Sale Check</title>
-		  <meta name="viewport" content="width=device-width, initial-scale=1">
-		</head>
-		<body>
-		  <h2>Check if a domain name is for sale</h2>
-		  <form action="/check" method="get">
-		    <label>
-		    Domain Name:
-		    <br>
-		      <input type="text" name="domain" value="example.nl" required autocomplete="off" spellcheck="false" autocapitalize="off" inputmode="url">
-		    </label>
-		    <br><br>
-		      <input type="submit" value="Check">
-		  </form>
-		</body>
-		</html>
-	`))
-	tmpl.Execute(w, nil)
+// interpretFcod runs the handler for value's prefix. ok is false if no
+// handler recognises the prefix.
+func interpretFcod(value string) (action FcodAction, ok bool, err error) {
+	prefix, _, found := strings.Cut(value, "-")
+	if !found {
+		return FcodAction{}, false, nil
+	}
+	h, err := fcodHandler(prefix)
+	if err != nil {
+		return FcodAction{}, true, err
+	}
+	if h == nil {
+		return FcodAction{}, false, nil
+	}
+	action, err = h.Interpret(value)
+	return action, true, err
 }
 
-func checkHandler(w http.ResponseWriter, r *http.Request) {
-	domain := r.URL.Query().Get("domain")
-	info := DomainInfo{Domain: domain}
+// storeFcodHandler resolves codes minted by fs-generate through the fcod store.
+type storeFcodHandler struct {
+	prefix string
+	store  *fcodStore
+}
 
-	if domain == "" {
-		info.ErrorMsg = "No domain name provided"
-		renderResult(w, info)
-		return
+func (h storeFcodHandler) Prefix() string { return h.prefix }
+
+func (h storeFcodHandler) Interpret(value string) (FcodAction, error) {
+	e, err := h.store.lookup(value)
+	if err != nil {
+		return FcodAction{}, err
+	}
+	if e == nil {
+		return FcodAction{}, fmt.Errorf("code %q is not in the %s registry", value, h.prefix)
 	}
+	return FcodAction{
+		Handler:     h.prefix,
+		Description: "registered sales landing page",
+		LandingPage: e.URL,
+	}, nil
+}
 
-	queryName := "_for-sale." + domain
-	txts, err := net.LookupTXT(queryName)
+// base64FcodHandler shows the decoded payload of Base64 codes. A decoded URL
+// is only displayed, not offered as a landing page: unlike a registry entry
+// it is under the control of whoever publishes the record.
+type base64FcodHandler struct {
+	prefix string
+}
+
+func (h base64FcodHandler) Prefix() string { return h.prefix }
+
+func (h base64FcodHandler) Interpret(value string) (FcodAction, error) {
+	payload := strings.TrimPrefix(value, h.prefix+"-")
+	// standard Base64 with padding, as in the draft's examples
+	data, err := base64.StdEncoding.DecodeString(payload)
 	if err != nil {
-		info.ErrorMsg = fmt.Sprintf("No _for-sale TXT records found: %v", err)
-		renderResult(w, info)
-		return
+		return FcodAction{}, fmt.Errorf("payload is not Base64: %w", err)
 	}
+	if !utf8.Valid(data) {
+		return FcodAction{Handler: h.prefix, Description: fmt.Sprintf("%d octets of binary data", len(data))}, nil
+	}
+	return FcodAction{Handler: h.prefix, Description: fmt.Sprintf("payload %q", data)}, nil
+}
 
-	seen := map[string]bool{}
-	foundValidVersionTag := false
+// fcodEntry is one code in the fcod store written by fs-generate.
+type fcodEntry struct {
+	Code   string `json:"code"`
+	Prefix string `json:"prefix"`
+	URL    string `json:"url"`
+}
 
-	for _, txt := range txts {
-		if seen[txt] {
-			continue
+// fcodStore resolves fcod values to landing pages. The store file is
+// re-read whenever its modification time changes, so codes minted with
+// fs-generate show up without a restart.
+type fcodStore struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	codes   map[string]fcodEntry
+}
+
+const (
+	// lookupTimeout bounds the DNS lookups done for one request.
+	lookupTimeout = 5 * time.Second
+	// shutdownTimeout is how long in-flight requests get after SIGTERM.
+	shutdownTimeout = 10 * time.Second
+	// contentSecurityPolicy allows nothing but the stylesheet and form
+	// submissions to this site; no scripts, frames or remote content.
+	contentSecurityPolicy = "default-src 'none'; style-src 'self'; form-action 'self'; base-uri 'none'; frame-ancestors 'none'"
+)
+
+//go:embed templates/*.html templates/*.svg templates/style.css templates/widget.js templates/locales/*.json
+var templateFS embed.FS
+
+// templates holds all pages, parsed once at startup. The per-request
+// functions are placeholders here and replaced by pageFuncs when rendering.
+var templates = template.Must(template.New("").Funcs(pageFuncs(&http.Request{URL: &url.URL{}}, "en")).Funcs(template.FuncMap{
+	"hasPrefix": func(s, prefix string) bool {
+		return strings.HasPrefix(s, prefix)
+	},
+	"stripPrefix": func(s, prefix string) string {
+		return strings.TrimPrefix(s, prefix)
+	},
+	// base is the configured base path, e.g. "/demo", to prefix site links with
+	"base": func() string {
+		return basePath
+	},
+	"upper": strings.ToUpper,
+	"display": func(s string) string {
+		return displaySafe(s, textPolicy)
+	},
+	// only used for URIs that passed the URI policies
+	"safeURL": func(s string) template.URL {
+		return template.URL(s)
+	},
+}).ParseFS(templateFS, "templates/*.html", "templates/*.svg"))
+
+var (
+	validFVALChar = regexp.MustCompile(`^[A-Z]{3}[0-9.,]{1,236}$`)
+
+	// textPolicy is how problematic characters in displayed values are replaced.
+	textPolicy = sanitizeReplacement
+
+	// basePath is the URL path prefix the site is served under, without a
+	// trailing slash; empty when served from the root.
+	basePath string
+
+	// guard rate-limits the handlers that send DNS queries.
+	guard *abuseGuard
+)
+
+// serverConfig holds the listener settings. It can be read from a JSON file
+// with -config; command-line flags override the file.
+type serverConfig struct {
+	// Listen lists the addresses to serve on: "host:port" or "http://host:port"
+	// for plain HTTP, "https://host:port" for TLS, "unix:/path" for a Unix socket.
+	Listen   []string `json:"listen"`
+	TLSCert  string   `json:"tls_cert"`
+	TLSKey   string   `json:"tls_key"`
+	BasePath string   `json:"base_path"`
+	// H2C enables unencrypted HTTP/2, e.g. behind a reverse proxy.
+	H2C bool `json:"h2c"`
+}
+
+// loadServerConfig reads a JSON server configuration file.
+func loadServerConfig(path string) (serverConfig, error) {
+	var cfg serverConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// certReloader serves a TLS certificate from disk and reloads it when the
+// certificate or key file changes, so renewed certificates are picked up
+// without a restart.
+type certReloader struct {
+	certFile, keyFile string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+// certCheckInterval limits how often the certificate files are stat'ed.
+const certCheckInterval = 10 * time.Second
+
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cert != nil && time.Since(c.checked) < certCheckInterval {
+		return c.cert, nil
+	}
+	c.checked = time.Now()
+	mod, err := latestModTime(c.certFile, c.keyFile)
+	if err != nil {
+		if c.cert != nil {
+			slog.Warn("cannot stat TLS certificate, keeping the loaded one", "err", err)
+			return c.cert, nil
 		}
-		seen[txt] = true
+		return nil, err
+	}
+	if c.cert != nil && !mod.After(c.modTime) {
+		return c.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		if c.cert != nil {
+			// e.g. the certificate was written but the key not yet
+			slog.Warn("cannot reload TLS certificate, keeping the loaded one", "err", err)
+			return c.cert, nil
+		}
+		return nil, err
+	}
+	if c.cert != nil {
+		slog.Info("reloaded TLS certificate", "cert", c.certFile)
+	}
+	c.cert, c.modTime = &cert, mod
+	return c.cert, nil
+}
 
-		if !strings.HasPrefix(txt, "v=FORSALE1;") {
-			info.InvalidRaw = append(info.InvalidRaw, txt)
-			continue
+func latestModTime(paths ...string) (time.Time, error) {
+	var latest time.Time
+	for _, p := range paths {
+		st, err := os.Stat(p)
+		if err != nil {
+			return time.Time{}, err
 		}
+		if st.ModTime().After(latest) {
+			latest = st.ModTime()
+		}
+	}
+	return latest, nil
+}
 
-		foundValidVersionTag = true
-		info.ForSale = true
+// listen opens the listener for one address of serverConfig.Listen and
+// reports whether TLS must be served on it.
+func listen(addr string) (l net.Listener, useTLS bool, err error) {
+	switch {
+	case strings.HasPrefix(addr, "unix:"):
+		path := strings.TrimPrefix(addr, "unix:")
+		// remove a socket left behind by an unclean shutdown
+		if st, err := os.Stat(path); err == nil && st.Mode()&os.ModeSocket != 0 {
+			os.Remove(path)
+		}
+		l, err = net.Listen("unix", path)
+		return l, false, err
+	case strings.HasPrefix(addr, "https://"):
+		l, err = net.Listen("tcp", strings.TrimPrefix(addr, "https://"))
+		return l, true, err
+	default:
+		l, err = net.Listen("tcp", strings.TrimPrefix(addr, "http://"))
+		return l, false, err
+	}
+}
 
-		content := strings.TrimPrefix(txt, "v=FORSALE1;")
-		content = strings.TrimLeft(content, " ")
+func main() {
+	fcodStorePath := flag.String("fcod-store", "", "JSON fcod code store (as written by fs-generate); empty disables fcod resolution")
+	fcodPrefixes := flag.String("fcod-prefixes", "", "comma-separated fcod prefixes to resolve through the store (default: all prefixes in the store, including ones added later)")
+	fcodBase64 := flag.String("fcod-base64", "", "comma-separated fcod prefixes whose payload is shown Base64-decoded")
+	brandsFile := flag.String("brands", "", "file with protected names (one per line) that furi hosts must not be confusable with")
+	confusablesFile := flag.String("confusables", "", "UTS #39 confusables.txt extending the built-in look-alike table")
+	uriAllowFile := flag.String("uri-allow", "", "file with domains and schemes (\"scheme:\") whose furi links are always offered")
+	uriDenyFile := flag.String("uri-deny", "", "file with domains and schemes (\"scheme:\") whose furi values are never linked")
+	uriHashFile := flag.String("uri-hashlist", "", "file with hex SHA-256 hash prefixes of Safe Browsing style URL expressions that are never linked")
+	sanitizeFlag := flag.String("sanitize", "fffd", "replace problematic characters in displayed text with a space (space) or U+FFFD (fffd)")
+	logFormat := flag.String("log-format", "text", "request log format: text or json")
+	configFile := flag.String("config", "", "JSON file with listener settings (listen, tls_cert, tls_key, base_path, h2c)")
+	listenFlag := flag.String("listen", "", "comma-separated listen addresses: host:port, http://host:port, https://host:port or unix:/path (default :8080)")
+	tlsCert := flag.String("tls-cert", "", "TLS certificate file (PEM), reloaded when it changes")
+	tlsKey := flag.String("tls-key", "", "TLS private key file (PEM)")
+	basePathFlag := flag.String("base-path", "", "URL path prefix the site is served under, e.g. /demo")
+	h2c := flag.Bool("h2c", false, "also accept unencrypted HTTP/2 (h2c), e.g. behind a reverse proxy")
+	rateFlag := flag.Float64("rate", 1, "checks per second allowed per client (IPv6 clients per /64)")
+	burstFlag := flag.Float64("burst", 10, "burst of checks allowed per client")
+	globalQPS := flag.Float64("global-qps", 50, "outbound DNS lookups per second for all clients together; 0 means unlimited")
+	apiKeysFile := flag.String("api-keys", "", "JSON file with API keys and their quotas: [{\"key\", \"name\", \"rate\", \"burst\"}]")
+	powBits := flag.Int("pow-bits", 0, "offer clients over their limit a proof-of-work challenge of this many bits (1-32); 0 disables")
+	trustedProxies := flag.String("trusted-proxies", "", "comma-separated CIDRs of reverse proxies whose X-Forwarded-For is trusted")
+	cacheTTL := flag.Duration("cache-ttl", time.Minute, "maximum time TXT lookups are cached, shorter when the record TTL is; 0 disables the cache")
+	rdapBootstrapFile := flag.String("rdap-bootstrap", "", "IANA RDAP bootstrap file (dns.json) used to look up contacts when the content is absent or invalid")
+	flag.BoolVar(&whoisFallback, "whois", false, "fall back to port-43 WHOIS when RDAP is unavailable or fails")
+	flag.StringVar(&whoisServer, "whois-server", "", "WHOIS server to use instead of the one whois.iana.org refers to")
+	flag.BoolVar(&checkRegistryStatus, "registry-status", false, "look up the registry status via RDAP/WHOIS and flag domains in redemption or pendingDelete")
+	specialUseFile := flag.String("special-use", "", "IANA special-use domain names registry (CSV or one name per line) extending the built-in list")
+	pslFile := flag.String("psl", "", "Public Suffix List file, to show where the domain sits relative to registry boundaries")
+	flag.StringVar(&widgetAncestors, "widget-ancestors", widgetAncestors, "CSP frame-ancestors of the embeddable widget, e.g. 'https://registrar.example'")
+	metricsListen := flag.String("metrics-listen", "", "serve /metrics, /healthz and /readyz on this separate address, e.g. localhost:9090; empty disables them")
+	flag.StringVar(&readyProbe, "ready-probe", readyProbe, "name looked up by /readyz to check that a resolver answers")
+	flag.Parse()
 
-		if content == "" {
-			info.ValidTags = append(info.ValidTags, "v=FORSALE1;")
-			continue
+	switch *logFormat {
+	case "text":
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	case "json":
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	default:
+		fatal("unknown log format", "format", *logFormat)
+	}
+
+	var cfg serverConfig
+	if *configFile != "" {
+		c, err := loadServerConfig(*configFile)
+		if err != nil {
+			fatal("cannot load config", "err", err)
 		}
+		cfg = c
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "listen":
+			cfg.Listen = strings.Split(*listenFlag, ",")
+		case "tls-cert":
+			cfg.TLSCert = *tlsCert
+		case "tls-key":
+			cfg.TLSKey = *tlsKey
+		case "base-path":
+			cfg.BasePath = *basePathFlag
+		case "h2c":
+			cfg.H2C = *h2c
+		}
+	})
+	if len(cfg.Listen) == 0 {
+		cfg.Listen = []string{":8080"}
+	}
+	basePath = strings.TrimSuffix(cfg.BasePath, "/")
+	if basePath != "" && !strings.HasPrefix(basePath, "/") {
+		fatal("base path must start with /", "base_path", cfg.BasePath)
+	}
 
-		parts := strings.SplitN(content, "=", 2)
-		if len(parts) != 2 {
-			info.InvalidRaw = append(info.InvalidRaw, txt)
-			continue
+	guard = &abuseGuard{clients: newRateLimiter(*rateFlag, *burstFlag)}
+	if *globalQPS > 0 {
+		guard.global = newTokenBucket(*globalQPS, *globalQPS)
+	}
+	if *apiKeysFile != "" {
+		keys, err := loadAPIKeys(*apiKeysFile)
+		if err != nil {
+			fatal("cannot load API keys", "err", err)
+		}
+		guard.keys = keys
+	}
+	if *powBits != 0 {
+		pow, err := newPoWChallenge(*powBits)
+		if err != nil {
+			fatal("cannot set up proof of work", "err", err)
+		}
+		guard.challenge = pow
+	}
+	if *trustedProxies != "" {
+		for _, c := range strings.Split(*trustedProxies, ",") {
+			pfx, err := netip.ParsePrefix(strings.TrimSpace(c))
+			if err != nil {
+				fatal("invalid -trusted-proxies", "err", err)
+			}
+			guard.trusted = append(guard.trusted, pfx)
 		}
+	}
 
-		tag, value := parts[0], parts[1]
+	if *rdapBootstrapFile != "" {
+		if err := loadRDAPBootstrap(*rdapBootstrapFile); err != nil {
+			fatal("cannot load RDAP bootstrap file", "err", err)
+		}
+	}
 
-		switch tag {
-		case "fcod":
-			if len(value) >= 1 && len(value) <= 239 {
-				info.ValidTags = append(info.ValidTags, content)
-			} else {
-				info.InvalidRaw = append(info.InvalidRaw, txt)
+	if *specialUseFile != "" {
+		if err := loadSpecialUseNames(*specialUseFile); err != nil {
+			fatal("cannot load special-use domain names", "err", err)
+		}
+	}
+	if *pslFile != "" {
+		l, err := loadPublicSuffixList(*pslFile)
+		if err != nil {
+			fatal("cannot load Public Suffix List", "err", err)
+		}
+		psl = l
+	}
+
+	if conf, err := dns.ClientConfigFromFile("/etc/resolv.conf"); err == nil {
+		for _, s := range conf.Servers {
+			resolvers = append(resolvers, net.JoinHostPort(s, conf.Port))
+		}
+	} else {
+		// like the Go resolver without a resolv.conf
+		slog.Warn("cannot read /etc/resolv.conf, using a resolver on localhost", "err", err)
+		resolvers = []string{"127.0.0.1:53", "[::1]:53"}
+	}
+
+	if *cacheTTL > 0 {
+		cache = &txtCache{ttl: *cacheTTL, max: 10000, entries: map[string]txtCacheEntry{}}
+		regCache = &registrationCache{ttl: *cacheTTL, max: 10000, entries: map[string]registrationCacheEntry{}}
+	}
+
+	p, err := parseSanitizePolicy(*sanitizeFlag)
+	if err != nil {
+		fatal("invalid -sanitize", "err", err)
+	}
+	textPolicy = p
+
+	if err := loadURIPolicies(*uriHashFile, *uriAllowFile, *uriDenyFile); err != nil {
+		fatal("cannot load URI policy", "err", err)
+	}
+
+	if *confusablesFile != "" {
+		if err := loadConfusables(*confusablesFile); err != nil {
+			fatal("cannot load confusables", "err", err)
+		}
+	}
+	if *brandsFile != "" {
+		if err := loadBrands(*brandsFile); err != nil {
+			fatal("cannot load protected names", "err", err)
+		}
+	}
+
+	if *fcodBase64 != "" {
+		for _, p := range strings.Split(*fcodBase64, ",") {
+			if err := registerFcodHandler(base64FcodHandler{prefix: strings.TrimSpace(p)}); err != nil {
+				fatal("invalid -fcod-base64", "err", err)
 			}
-		case "ftxt":
-			if len(value) >= 1 && len(value) <= 239 {
-				info.ValidTags = append(info.ValidTags, content)
-			} else {
-				info.InvalidRaw = append(info.InvalidRaw, txt)
+		}
+	}
+	if *fcodStorePath != "" {
+		store := &fcodStore{path: *fcodStorePath}
+		prefixes, err := store.prefixes()
+		if err != nil {
+			fatal("cannot load fcod store", "err", err)
+		}
+		if *fcodPrefixes != "" {
+			for _, p := range strings.Split(*fcodPrefixes, ",") {
+				if err := registerFcodHandler(storeFcodHandler{prefix: strings.TrimSpace(p), store: store}); err != nil {
+					fatal("invalid -fcod-prefixes", "err", err)
+				}
 			}
-		case "furi":
-			u, err := url.Parse(value)
-			if err == nil {
-				scheme := strings.ToLower(u.Scheme)
-				if scheme == "http" || scheme == "https" || scheme == "mailto" || scheme == "tel" {
-					info.ValidTags = append(info.ValidTags, content)
-					break
+		} else {
+			// prefixes added to the store later are resolved as well, but
+			// one that is in use by another handler at startup is an error
+			for _, p := range prefixes {
+				if _, dup := fcodHandlers[p]; dup {
+					fatal("fcod prefix is both in the store and handled otherwise", "prefix", p)
 				}
 			}
-			info.InvalidRaw = append(info.InvalidRaw, txt)
-		case "fval":
-			if len(value) >= 4 && len(value) <= 239 && validFVALChar.MatchString(value) && strings.Count(value, ".") <= 1 {
-				info.ValidTags = append(info.ValidTags, content)
+			fcodStoreAll = store
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", formHandler)
+	mux.HandleFunc("/check", guard.wrap(checkHandler))
+	mux.HandleFunc("/fcod", guard.wrap(fcodConfirmHandler))
+	mux.HandleFunc("/go", guard.wrap(furiConfirmHandler))
+	mux.HandleFunc("/static/style.css", styleHandler)
+	mux.HandleFunc("/badge/", guard.wrap(badgeHandler))
+	mux.HandleFunc("/widget", guard.wrap(widgetHandler))
+	mux.HandleFunc("/widget.js", widgetScriptHandler)
+
+	// the operational endpoints are never on the public listeners
+	ops := http.NewServeMux()
+	ops.HandleFunc("/metrics", metricsHandler)
+	ops.HandleFunc("/healthz", healthzHandler)
+	ops.HandleFunc("/readyz", readyzHandler)
+
+	var handler http.Handler = mux
+	if basePath != "" {
+		root := http.NewServeMux()
+		root.Handle(basePath+"/", http.StripPrefix(basePath, mux))
+		root.Handle(basePath, http.RedirectHandler(basePath+"/", http.StatusMovedPermanently))
+		handler = root
+	}
+
+	srv := &http.Server{
+		Handler:           logRequests(securityHeaders(handler)),
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       120 * time.Second,
+		MaxHeaderBytes:    16 << 10,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+		Protocols:         new(http.Protocols),
+	}
+	srv.Protocols.SetHTTP1(true)
+	srv.Protocols.SetHTTP2(true)
+	srv.Protocols.SetUnencryptedHTTP2(cfg.H2C)
+	if cfg.TLSCert != "" || cfg.TLSKey != "" {
+		// a certificate without a listener to use it on would silently
+		// leave the site on plain HTTP
+		if !slices.ContainsFunc(cfg.Listen, func(addr string) bool { return strings.HasPrefix(strings.TrimSpace(addr), "https://") }) {
+			fatal("TLS certificate given, but no https:// listener to use it on", "listen", strings.Join(cfg.Listen, ","))
+		}
+		certs := &certReloader{certFile: cfg.TLSCert, keyFile: cfg.TLSKey}
+		if _, err := certs.GetCertificate(nil); err != nil {
+			fatal("cannot load TLS certificate", "err", err)
+		}
+		srv.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certs.GetCertificate,
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errc := make(chan error, len(cfg.Listen)+1)
+	for _, addr := range cfg.Listen {
+		addr = strings.TrimSpace(addr)
+		l, useTLS, err := listen(addr)
+		if err != nil {
+			fatal("cannot listen", "addr", addr, "err", err)
+		}
+		if useTLS && srv.TLSConfig == nil {
+			fatal("https listener needs -tls-cert and -tls-key", "addr", addr)
+		}
+		go func() {
+			slog.Info("server running", "addr", addr, "tls", useTLS, "base_path", basePath)
+			if useTLS {
+				errc <- srv.ServeTLS(l, "", "")
 			} else {
-				info.InvalidRaw = append(info.InvalidRaw, txt)
+				errc <- srv.Serve(l)
 			}
-		default:
-			info.InvalidRaw = append(info.InvalidRaw, txt)
+		}()
+	}
+
+	var opsSrv *http.Server
+	if *metricsListen != "" {
+		opsSrv = &http.Server{
+			Addr:              *metricsListen,
+			Handler:           ops,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
 		}
+		go func() {
+			slog.Info("metrics server running", "addr", *metricsListen)
+			errc <- opsSrv.ListenAndServe()
+		}()
 	}
 
-	if !foundValidVersionTag {
-		info.ForSale = false
+	select {
+	case err := <-errc:
+		fatal("server failed", "err", err)
+	case <-ctx.Done():
+	}
+	slog.Info("shutting down")
+	sctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(sctx); err != nil {
+		slog.Error("shutdown incomplete", "err", err)
+	}
+	if opsSrv != nil {
+		opsSrv.Shutdown(sctx)
+	}
+}
+
+// fatal logs msg at error level and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// securityHeaders sets the headers that apply to every response.
+func securityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Content-Security-Policy", contentSecurityPolicy)
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("Referrer-Policy", "no-referrer")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// statusRecorder remembers the status code and size of a response for logging.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += n
+	return n, err
+}
+
+// privateParams are the query parameters that say which domain was checked
+// or which contact was followed; they are not logged (see the draft's
+// privacy considerations).
+var privateParams = []string{"d", "domain", "u", "code"}
+
+// loggedQuery returns the query string of r with the values of
+// privateParams redacted.
+func loggedQuery(r *http.Request) string {
+	q := r.URL.Query()
+	for _, p := range privateParams {
+		if q.Has(p) {
+			q.Set(p, "REDACTED")
+		}
+	}
+	return q.Encode()
+}
+
+// logRequests writes one structured log line per request.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		path := r.URL.Path
+		if strings.HasPrefix(path, basePath+"/badge/") {
+			// the domain is part of the path
+			path = basePath + "/badge/REDACTED.svg"
+		}
+		slog.Info("request",
+			"method", r.Method,
+			"path", path,
+			"query", loggedQuery(r),
+			"status", rec.status,
+			"bytes", rec.bytes,
+			"duration_ms", float64(time.Since(start).Microseconds())/1000,
+			"remote", r.RemoteAddr,
+			"user_agent", r.UserAgent(),
+		)
+	})
+}
+
+// render executes a template into a buffer first, so a template error gives
+// a clean 500 instead of a half-written page.
+func render(w http.ResponseWriter, r *http.Request, name string, data any) {
+	renderStatus(w, r, http.StatusOK, name, data)
+}
+
+// renderStatus is render with a status code other than 200. Pages are
+// rendered in the language of the request.
+func renderStatus(w http.ResponseWriter, r *http.Request, status int, name string, data any) {
+	lang := requestLang(r)
+	t, err := templates.Clone()
+	if err == nil {
+		var buf bytes.Buffer
+		err = t.Funcs(pageFuncs(r, lang)).ExecuteTemplate(&buf, name, data)
+		if err == nil {
+			h := w.Header()
+			if strings.HasSuffix(name, ".svg") {
+				h.Set("Content-Type", "image/svg+xml")
+			} else {
+				h.Set("Content-Type", "text/html; charset=utf-8")
+			}
+			h.Set("Content-Language", lang)
+			h.Add("Vary", "Accept-Language, Cookie")
+			if r.URL.Query().Get("lang") == lang {
+				http.SetCookie(w, &http.Cookie{
+					Name: "lang", Value: lang, Path: basePath + "/",
+					MaxAge: 365 * 24 * 3600, SameSite: http.SameSiteLaxMode,
+				})
+			}
+			w.WriteHeader(status)
+			if _, err := w.Write(buf.Bytes()); err != nil {
+				slog.Debug("writing response failed", "err", err)
+			}
+			return
+		}
+	}
+	slog.Error("template execution failed", "template", name, "err", err)
+	http.Error(w, "Internal server error", http.StatusInternalServerError)
+}
+
+// catalog maps message keys to format strings for one language.
+type catalog map[string]string
+
+// uiLanguage is an entry of the language switcher.
+type uiLanguage struct {
+	Code, Name string
+}
+
+var (
+	// catalogs holds the message catalogs by language code; English is
+	// the fallback for missing keys.
+	catalogs = loadCatalogs()
+	// languages lists the supported languages, English first.
+	languages   = []uiLanguage{{"en", catalogs["en"]["language"]}, {"nl", catalogs["nl"]["language"]}}
+	langMatcher = language.NewMatcher([]language.Tag{language.English, language.Dutch})
+)
+
+func loadCatalogs() map[string]catalog {
+	cats := map[string]catalog{}
+	for _, code := range []string{"en", "nl"} {
+		b, err := templateFS.ReadFile("templates/locales/" + code + ".json")
+		if err != nil {
+			panic(err)
+		}
+		var c catalog
+		if err := json.Unmarshal(b, &c); err != nil {
+			panic(fmt.Sprintf("locales/%s.json: %v", code, err))
+		}
+		cats[code] = c
+	}
+	return cats
+}
+
+// text formats the message key in lang, falling back to English and then
+// to the key itself.
+func text(lang, key string, args ...any) string {
+	f, ok := catalogs[lang][key]
+	if !ok {
+		if f, ok = catalogs["en"][key]; !ok {
+			f = key
+		}
+	}
+	if len(args) == 0 {
+		return f
 	}
+	return fmt.Sprintf(f, args...)
+}
 
-	renderResult(w, info)
+// requestLang picks the language for a request: ?lang= first, then the
+// lang cookie it sets, then Accept-Language.
+func requestLang(r *http.Request) string {
+	if l := r.URL.Query().Get("lang"); catalogs[l] != nil {
+		return l
+	}
+	if c, err := r.Cookie("lang"); err == nil && catalogs[c.Value] != nil {
+		return c.Value
+	}
+	tags, _, _ := language.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+	_, i, _ := langMatcher.Match(tags...)
+	return languages[i].Code
 }
 
-func renderResult(w http.ResponseWriter, info DomainInfo) {
-	funcMap := template.FuncMap{
-		"hasPrefix": func(s, prefix string) bool {
-			return strings.HasPrefix(s, prefix)
+// pageFuncs returns the per-request template functions for lang.
+func pageFuncs(r *http.Request, lang string) template.FuncMap {
+	return template.FuncMap{
+		"lang": func() string {
+			return lang
+		},
+		"languages": func() []uiLanguage {
+			return languages
+		},
+		// t translates a message; the catalog is trusted markup, the
+		// arguments are escaped
+		"t": func(key string, args ...any) template.HTML {
+			for i, a := range args {
+				args[i] = template.HTMLEscapeString(fmt.Sprint(a))
+			}
+			return template.HTML(text(lang, key, args...))
 		},
-		"stripPrefix": func(s, prefix string) string {
-			return strings.TrimPrefix(s, prefix)
+		// role names an RDAP role, e.g. "registrar"; unknown roles are shown as is
+		"role": func(role string) string {
+			if _, ok := catalogs["en"]["role."+role]; !ok {
+				return role
+			}
+			return text(lang, "role."+role)
 		},
-		"htmlEscape": func(s string) string {
-			return template.HTMLEscapeString(s)
+		"price": func(fval string) string {
+			return formatPrice(lang, fval)
 		},
-		"safeURL": func(s string) template.URL {
-			return template.URL(s)
+		"langURL": func(code string) string {
+			q := r.URL.Query()
+			q.Set("lang", code)
+			return basePath + r.URL.Path + "?" + q.Encode()
 		},
 	}
+}
+
+// currencySymbols are shown instead of the ISO 4217 code for common currencies.
+var currencySymbols = map[string]string{
+	"EUR": "€",
+	"USD": "$",
+	"GBP": "£",
+	"JPY": "¥",
+}
+
+// minorUnits is the number of decimals amounts are padded to; currencies
+// not listed keep the decimals given in the record.
+var minorUnits = map[string]int{
+	"EUR": 2, "USD": 2, "GBP": 2, "CHF": 2, "AUD": 2, "CAD": 2,
+	"SEK": 2, "NOK": 2, "DKK": 2, "PLN": 2, "CZK": 2, "JPY": 0,
+}
+
+// formatPrice renders an fval value such as "EUR999" the way lang writes
+// amounts: "€ 999,00" in Dutch, "€999.00" in English. Values it does not
+// understand are returned as they are.
+func formatPrice(lang, fval string) string {
+	i := strings.IndexFunc(fval, func(r rune) bool { return r < 'A' || r > 'Z' })
+	if i <= 0 {
+		return fval
+	}
+	cur, amount := fval[:i], fval[i:]
+	intPart, frac, _ := strings.Cut(amount, ".")
+	if intPart == "" || strings.Trim(intPart+frac, "0123456789") != "" {
+		return fval
+	}
+	intPart = strings.TrimLeft(intPart, "0")
+	if intPart == "" {
+		intPart = "0"
+	}
+	if n, ok := minorUnits[cur]; ok && len(frac) < n {
+		frac += strings.Repeat("0", n-len(frac))
+	}
+
+	group, point := ",", "."
+	if lang == "nl" {
+		group, point = ".", ","
+	}
+	var b strings.Builder
+	for j, c := range intPart {
+		if j > 0 && (len(intPart)-j)%3 == 0 {
+			b.WriteString(group)
+		}
+		b.WriteRune(c)
+	}
+	if frac != "" {
+		b.WriteString(point + frac)
+	}
 
-	tmpl := template.Must(template.New("result").Funcs(funcMap).Parse(`
-		<!DOCTYPE html>
-		<html lang="en">
-		<head>
-		  <title>For Sale Check</title>
-		  <meta name="viewport" content="width=device-width, initial-scale=1">
-		</head>
-		<body>
-		<h2>Result for {{.Domain}}</h2>
-		{{if .ErrorMsg}}
-			<p style="color: red;">Error: {{.ErrorMsg}}</p>
-		{{else if .ForSale}}
-			<p style="color: green;">✅ Domain appears to be for sale based on found records.</p>
-			<ul>
-			{{range .ValidTags}}
-				{{- if hasPrefix . "furi=" -}}
-					{{ $uri := stripPrefix . "furi=" }}
-					<li><a href="{{safeURL $uri}}" target="_blank" rel="noopener noreferrer">{{htmlEscape $uri}}</a> - click at own risk!</li>
-				{{- else if hasPrefix . "fcod=" -}}
-					{{ $cod := stripPrefix . "fcod=" }}
-					<li><code style="color: #888;">Code: {{$cod}}</code></li>
-				{{- else if hasPrefix . "ftxt=" -}}
-					{{ $txt := stripPrefix . "ftxt=" }}
-					<li><code>Text message: {{$txt}}</code></li>
-				{{- else if hasPrefix . "fval=" -}}
-					{{ $val := stripPrefix . "fval=" }}
-					<li><code>Price: {{$val}}</code></li>
-				{{- else -}}
-					<li><code>{{.}}</code></li>
-				{{- end }}
-			{{end}}
-			</ul>
-			{{if .InvalidRaw}}
-				<p style="color: orange;">⚠️ Some records were syntactically invalid or not recommended.</p>
-				<ul>{{range .InvalidRaw}}<li><code>{{.}}</code></li>{{end}}</ul>
-			{{end}}
-		{{else}}
-			<p>❌ No valid indications found that the domain is for sale.</p>
-		{{end}}
-		<a href="/demo">Back</a>
-		</body></html>
-	`))
-
-	tmpl.Execute(w, info)
+	sym, ok := currencySymbols[cur]
+	switch {
+	case !ok:
+		return cur + " " + b.String()
+	case lang == "nl":
+		return sym + " " + b.String()
+	default:
+		return sym + b.String()
+	}
+}
+
+func styleHandler(w http.ResponseWriter, r *http.Request) {
+	css, err := templateFS.ReadFile("templates/style.css")
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/css; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Write(css)
+}
+
+func formHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	render(w, r, "form.html", nil)
+}
+
+// widgetAncestors is the CSP frame-ancestors value of the widget page. By
+// default no site may frame it; operators list the sites that may.
+var widgetAncestors = "'none'"
+
+// cacheFor sets the caching headers of a verdict that may be cached for
+// ttl, the TTL of the records it is based on.
+func cacheFor(w http.ResponseWriter, ttl time.Duration, status int) {
+	switch {
+	case status != http.StatusOK:
+		w.Header().Set("Cache-Control", "no-store")
+	case ttl <= 0:
+		w.Header().Set("Cache-Control", "no-cache")
+	default:
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(ttl.Seconds())))
+	}
+}
+
+// firstValue returns the value of the first valid record with the given
+// tag, e.g. "fval=".
+func firstValue(info DomainInfo, tag string) string {
+	for _, t := range info.ValidTags {
+		if strings.HasPrefix(t, tag) {
+			return strings.TrimPrefix(t, tag)
+		}
+	}
+	return ""
+}
+
+// badgeHandler serves /badge/<domain>.svg, a small image with the verdict,
+// or the price when one is published.
+func badgeHandler(w http.ResponseWriter, r *http.Request) {
+	domain, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/badge/"), ".svg")
+	if !ok || domain == "" || strings.Contains(domain, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	lang := requestLang(r)
+	info, ttl, status := checkDomain(r.Context(), lang, domain)
+
+	label := displaySafe(domain, textPolicy)
+	value, color := text(lang, "badge.not_for_sale"), "#9f9f9f"
+	switch {
+	case status != http.StatusOK:
+		value = text(lang, "badge.unknown")
+	case info.ForSale:
+		value, color = text(lang, "badge.for_sale"), "#4c1"
+		if fval := firstValue(info, "fval="); fval != "" {
+			value = formatPrice(lang, fval)
+		}
+	}
+	// roughly 7 pixels per character at font-size 11, plus padding
+	lw := 7*utf8.RuneCountInString(label) + 10
+	vw := 7*utf8.RuneCountInString(value) + 10
+	cacheFor(w, ttl, status)
+	// always 200, or the image would not be shown
+	renderStatus(w, r, http.StatusOK, "badge.svg", struct {
+		Label, Value, Color           string
+		Width, LabelWidth, ValueWidth int
+		LabelX, ValueX                float64
+	}{label, value, color, lw + vw, lw, vw, float64(lw) / 2, float64(lw) + float64(vw)/2})
+}
+
+// widgetHandler serves the page embedded by widget.js: the verdict, the
+// price and a link to the contact confirmation page.
+func widgetHandler(w http.ResponseWriter, r *http.Request) {
+	info, ttl, status := checkDomain(r.Context(), requestLang(r), r.URL.Query().Get("domain"))
+	var contact string
+	for _, t := range info.ValidTags {
+		if v := info.Furis[strings.TrimPrefix(t, "furi=")]; strings.HasPrefix(t, "furi=") && v != nil && v.Link != "" {
+			contact = v.Link
+			break
+		}
+	}
+	h := w.Header()
+	h.Set("Content-Security-Policy", strings.Replace(contentSecurityPolicy, "frame-ancestors 'none'", "frame-ancestors "+widgetAncestors, 1))
+	h.Del("X-Frame-Options")
+	cacheFor(w, ttl, status)
+	renderStatus(w, r, status, "widget.html", struct {
+		Info           DomainInfo
+		Price, Contact string
+	}{info, firstValue(info, "fval="), contact})
+}
+
+func widgetScriptHandler(w http.ResponseWriter, r *http.Request) {
+	js, err := templateFS.ReadFile("templates/widget.js")
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Write(js)
+}
+
+func checkHandler(w http.ResponseWriter, r *http.Request) {
+	info, _, status := checkDomain(r.Context(), requestLang(r), r.URL.Query().Get("domain"))
+	renderStatus(w, r, status, "result.html", info)
+}
+
+// checkDomain looks up and evaluates the _for-sale records of domain, with
+// messages in lang. It also returns how long the verdict may be cached and
+// the HTTP status to answer with.
+func checkDomain(ctx context.Context, lang, domain string) (DomainInfo, time.Duration, int) {
+	info := DomainInfo{Domain: domain}
+
+	if domain == "" {
+		info.ErrorMsg = text(lang, "error.no_domain")
+		checksTotal.inc("error")
+		return info, 0, http.StatusOK
+	}
+
+	// special-use names are out of scope; no query is sent for them
+	if su, ok := lookupSpecialUse(domain); ok {
+		reason := su.Reason
+		if _, ok := catalogs["en"]["special."+su.Name]; ok {
+			reason = text(lang, "special."+su.Name)
+		}
+		info.ErrorMsg = text(lang, "error.special_use", su.Name, su.Reference, reason)
+		checksTotal.inc("out_of_scope")
+		return info, 0, http.StatusOK
+	}
+
+	queryName := "_for-sale." + domain
+	res, err := lookupTXT(ctx, queryName)
+	if errors.Is(err, errBusy) {
+		info.ErrorMsg = text(lang, "error.busy")
+		checksTotal.inc("error")
+		return info, 0, http.StatusServiceUnavailable
+	}
+	info.Negative = res.negative
+	var dnsErr *net.DNSError
+	if err != nil && !(errors.As(err, &dnsErr) && dnsErr.IsNotFound) {
+		info.ErrorMsg = text(lang, "error.lookup", err)
+		if res.negative != nil {
+			info.ErrorMsg = negativeText(lang, domain, res.negative)
+		}
+		checksTotal.inc("error")
+		return info, 0, http.StatusBadGateway
+	}
+	if err != nil {
+		// no records: not for sale, explained by info.Negative
+		checksTotal.inc("not_for_sale")
+		return info, res.ttl, http.StatusOK
+	}
+
+	seen := map[string]bool{}
+	foundValidVersionTag := false
+
+	for _, txt := range res.txts {
+		if seen[txt] {
+			continue
+		}
+		seen[txt] = true
+
+		if !strings.HasPrefix(txt, "v=FORSALE1;") {
+			info.InvalidRaw = append(info.InvalidRaw, txt)
+			continue
+		}
+
+		foundValidVersionTag = true
+		info.ForSale = true
+
+		content := strings.TrimPrefix(txt, "v=FORSALE1;")
+		content = strings.TrimLeft(content, " ")
+
+		if content == "" {
+			info.ValidTags = append(info.ValidTags, "v=FORSALE1;")
+			continue
+		}
+
+		parts := strings.SplitN(content, "=", 2)
+		if len(parts) != 2 {
+			info.InvalidRaw = append(info.InvalidRaw, txt)
+			continue
+		}
+
+		tag, value := parts[0], parts[1]
+
+		switch tag {
+		case "fcod":
+			if len(value) >= 1 && len(value) <= 239 {
+				info.ValidTags = append(info.ValidTags, content)
+			} else {
+				info.InvalidRaw = append(info.InvalidRaw, txt)
+			}
+		case "ftxt":
+			if len(value) >= 1 && len(value) <= 239 {
+				info.ValidTags = append(info.ValidTags, content)
+			} else {
+				info.InvalidRaw = append(info.InvalidRaw, txt)
+			}
+		case "furi":
+			u, err := url.Parse(value)
+			if err == nil {
+				scheme := strings.ToLower(u.Scheme)
+				if scheme == "http" || scheme == "https" || scheme == "mailto" || scheme == "tel" {
+					info.ValidTags = append(info.ValidTags, content)
+					break
+				}
+			}
+			info.InvalidRaw = append(info.InvalidRaw, txt)
+		case "fval":
+			if len(value) >= 4 && len(value) <= 239 && validFVALChar.MatchString(value) && strings.Count(value, ".") <= 1 {
+				info.ValidTags = append(info.ValidTags, content)
+			} else {
+				info.InvalidRaw = append(info.InvalidRaw, txt)
+			}
+		default:
+			info.InvalidRaw = append(info.InvalidRaw, txt)
+		}
+	}
+
+	if !foundValidVersionTag {
+		info.ForSale = false
+	}
+	if info.ForSale {
+		checksTotal.inc("for_sale")
+	} else {
+		checksTotal.inc("not_for_sale")
+	}
+	for _, t := range info.ValidTags {
+		tag, _, ok := strings.Cut(t, "=")
+		if !ok || strings.HasPrefix(t, "v=FORSALE1;") {
+			tag = "none"
+		}
+		recordsTotal.inc(tag)
+	}
+	for range info.InvalidRaw {
+		recordsTotal.inc("invalid")
+	}
+
+	for _, t := range info.ValidTags {
+		var findings []string
+		switch {
+		case strings.HasPrefix(t, "ftxt="):
+			findings = checkUnicodeSecurity(strings.TrimPrefix(t, "ftxt="))
+		case strings.HasPrefix(t, "furi="):
+			uri := strings.TrimPrefix(t, "furi=")
+			findings = checkUnicodeSecurity(uri)
+			if host := uriHost(uri); host != "" {
+				findings = append(findings, checkHostSecurity(host)...)
+			}
+			v := &FuriView{}
+			linkable, reason := evaluateURI(uri)
+			v.Reason = reason
+			if linkable {
+				v.Link = basePath + "/go?" + url.Values{"u": {uri}, "d": {domain}}.Encode()
+			}
+			if info.Furis == nil {
+				info.Furis = map[string]*FuriView{}
+			}
+			info.Furis[uri] = v
+		}
+		if len(findings) > 0 {
+			if info.Findings == nil {
+				info.Findings = map[string][]string{}
+			}
+			info.Findings[t] = findings
+		}
+	}
+
+	for _, t := range info.ValidTags {
+		if !strings.HasPrefix(t, "fcod=") {
+			continue
+		}
+		code := strings.TrimPrefix(t, "fcod=")
+		action, ok, err := interpretFcod(code)
+		if !ok {
+			continue
+		}
+		if err != nil {
+			slog.Warn("fcod interpretation failed", "code", code, "err", err)
+			continue
+		}
+		v := FcodView{Handler: action.Handler, Description: action.Description}
+		if action.LandingPage != "" {
+			v.Link = basePath + "/fcod?" + url.Values{"code": {code}, "d": {domain}}.Encode()
+		}
+		if info.Fcods == nil {
+			info.Fcods = map[string]*FcodView{}
+		}
+		info.Fcods[code] = &v
+	}
+
+	// registries only know registrable domains
+	regDomain := domain
+	if psl != nil {
+		p := psl.classifyPlacement(domain)
+		info.Placement = &p
+		if p.RegistrableDomain != "" {
+			regDomain = p.RegistrableDomain
+		}
+	}
+
+	info.ContentMissing = info.ForSale && !slices.ContainsFunc(info.ValidTags, func(t string) bool { return t != "v=FORSALE1;" })
+	if (rdapServices != nil || whoisFallback) && (info.ContentMissing || checkRegistryStatus && info.ForSale) {
+		if reg, ok := regCache.get(regDomain); ok {
+			info.Registration = reg
+		} else if !guard.lookupBudget() {
+			info.RegistrationError = text(lang, "error.busy")
+		} else if reg, err := lookupRegistration(ctx, regDomain); err != nil {
+			info.RegistrationError = err.Error()
+		} else {
+			regCache.put(regDomain, reg)
+			info.Registration = reg
+		}
+		if info.Registration != nil && checkRegistryStatus {
+			info.UnreliableStatus = unreliableRegistryStatus(info.Registration.Status)
+		}
+	}
+
+	return info, res.ttl, http.StatusOK
+}
+
+// lookup returns the store entry for code, or nil if the code is unknown.
+func (f *fcodStore) lookup(code string) (*fcodEntry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.reload(); err != nil {
+		return nil, err
+	}
+	e, ok := f.codes[code]
+	if !ok {
+		return nil, nil
+	}
+	return &e, nil
+}
+
+// prefixes returns the distinct prefixes currently in the store.
+func (f *fcodStore) prefixes() ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.reload(); err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var out []string
+	for _, e := range f.codes {
+		if !seen[e.Prefix] {
+			seen[e.Prefix] = true
+			out = append(out, e.Prefix)
+		}
+	}
+	return out, nil
+}
+
+// reload re-reads the store file if it changed. f.mu must be held.
+func (f *fcodStore) reload() error {
+	st, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	if f.codes == nil || !st.ModTime().Equal(f.modTime) {
+		data, err := os.ReadFile(f.path)
+		if err != nil {
+			return err
+		}
+		var entries []fcodEntry
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return fmt.Errorf("%s: %w", f.path, err)
+		}
+		f.codes = make(map[string]fcodEntry, len(entries))
+		for _, e := range entries {
+			f.codes[e.Code] = e
+		}
+		f.modTime = st.ModTime()
+	}
+	return nil
+}
+
+// salesURL returns the landing page with the domain added as the "d" query
+// parameter, as in the draft's example.
+func salesURL(landing, domain string) (string, error) {
+	u, err := url.Parse(landing)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return "", errors.New("landing page is not an http(s) URL")
+	}
+	q := u.Query()
+	q.Set("d", domain)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// fcodConfirmHandler shows where a recognised fcod code leads and lets the
+// user decide whether to go there. Per the draft's security considerations
+// the user is never redirected automatically.
+func fcodConfirmHandler(w http.ResponseWriter, r *http.Request) {
+	code := r.URL.Query().Get("code")
+	domain := r.URL.Query().Get("d")
+	if code == "" || domain == "" {
+		http.NotFound(w, r)
+		return
+	}
+	// only offer codes that are actually published for the domain
+	published, err := isPublished(r.Context(), domain, "fcod="+code)
+	if err != nil {
+		http.Error(w, "The service is busy, please try again later", http.StatusServiceUnavailable)
+		return
+	}
+	action, ok, err := interpretFcod(code)
+	if err != nil {
+		slog.Warn("fcod interpretation failed", "code", code, "err", err)
+	}
+	if !published || !ok || err != nil || action.LandingPage == "" {
+		http.NotFound(w, r)
+		return
+	}
+	target, err := salesURL(action.LandingPage, domain)
+	if err != nil {
+		http.Error(w, "Invalid landing page for this code", http.StatusInternalServerError)
+		return
+	}
+
+	render(w, r, "fcod.html", struct {
+		Domain, Code, Handler, Target string
+	}{domain, code, action.Handler, target})
+}
+
+// URIVerdict is the outcome of a URIPolicy check.
+type URIVerdict int
+
+const (
+	uriNeutral URIVerdict = iota // no opinion; the next policy decides
+	uriAllow                     // link, skipping the remaining list checks
+	uriBlock                     // never link
+)
+
+// URIPolicy decides whether a furi value may be shown as a link. Policies are
+// consulted in registration order; the first non-neutral verdict wins.
+type URIPolicy interface {
+	Check(u *url.URL) (URIVerdict, string)
+}
+
+// uriPolicies holds the registered policies. Scheme gating always runs first.
+var uriPolicies = []URIPolicy{schemePolicy{}}
+
+func registerURIPolicy(p URIPolicy) {
+	uriPolicies = append(uriPolicies, p)
+}
+
+// loadURIPolicies registers the list policies for the files that are set.
+// The threat list goes first, so an allowlisted domain is still blocked when
+// it is hash-listed; the allowlist only overrides the denylist.
+func loadURIPolicies(hashFile, allowFile, denyFile string) error {
+	if hashFile != "" {
+		hp, err := loadHashPrefixPolicy(hashFile)
+		if err != nil {
+			return fmt.Errorf("hash list: %w", err)
+		}
+		registerURIPolicy(hp)
+	}
+	if allowFile != "" {
+		lp, err := loadListPolicy(allowFile, "allowlist", uriAllow)
+		if err != nil {
+			return fmt.Errorf("allowlist: %w", err)
+		}
+		registerURIPolicy(lp)
+	}
+	if denyFile != "" {
+		lp, err := loadListPolicy(denyFile, "denylist", uriBlock)
+		if err != nil {
+			return fmt.Errorf("denylist: %w", err)
+		}
+		registerURIPolicy(lp)
+	}
+	return nil
+}
+
+// FuriView is how a furi value is shown in the result page.
+type FuriView struct {
+	Link   string // interstitial page for the URI; empty if it must not be linked
+	Reason string // why the URI is (not) linked
+}
+
+// evaluateURI runs the registered policies on raw. A URI that no policy
+// blocks is linkable.
+func evaluateURI(raw string) (linkable bool, reason string) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false, "not a valid URI"
+	}
+	for _, p := range uriPolicies {
+		switch v, why := p.Check(u); v {
+		case uriAllow:
+			return true, why
+		case uriBlock:
+			return false, why
+		}
+	}
+	return true, ""
+}
+
+// schemePolicy never links schemes that can run code or embed content, and
+// only links the schemes the draft recommends.
+type schemePolicy struct{}
+
+func (schemePolicy) Check(u *url.URL) (URIVerdict, string) {
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "mailto", "tel":
+		return uriNeutral, ""
+	case "javascript", "data", "vbscript", "file", "blob":
+		return uriBlock, fmt.Sprintf("%s: URIs are never linked", strings.ToLower(u.Scheme))
+	}
+	return uriBlock, fmt.Sprintf("scheme %q is not recommended by the draft", u.Scheme)
+}
+
+// listPolicy matches URIs against a local list of domains and schemes. A
+// domain entry also matches its subdomains.
+type listPolicy struct {
+	verdict URIVerdict
+	name    string // "allowlist" or "denylist", for the reason text
+	domains map[string]bool
+	schemes map[string]bool
+}
+
+// loadListPolicy reads a list file: one domain per line, or a scheme written
+// as "scheme:". Empty lines and lines starting with '#' are skipped.
+func loadListPolicy(path, name string, verdict URIVerdict) (*listPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &listPolicy{verdict: verdict, name: name, domains: map[string]bool{}, schemes: map[string]bool{}}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.ToLower(strings.TrimSpace(line))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasSuffix(line, ":") {
+			p.schemes[strings.TrimSuffix(line, ":")] = true
+		} else {
+			p.domains[strings.TrimSuffix(line, ".")] = true
+		}
+	}
+	return p, nil
+}
+
+func (p *listPolicy) Check(u *url.URL) (URIVerdict, string) {
+	if p.schemes[strings.ToLower(u.Scheme)] {
+		return p.verdict, fmt.Sprintf("scheme %s: is on the %s", strings.ToLower(u.Scheme), p.name)
+	}
+	host := strings.TrimSuffix(strings.ToLower(uriHost(u.String())), ".")
+	for host != "" {
+		if p.domains[host] {
+			return p.verdict, fmt.Sprintf("%s is on the %s", host, p.name)
+		}
+		_, parent, ok := strings.Cut(host, ".")
+		if !ok {
+			break
+		}
+		host = parent
+	}
+	return uriNeutral, ""
+}
+
+// hashPrefixPolicy blocks URIs whose Safe Browsing style expressions (host
+// suffix plus path prefix, e.g. "a.example.com/shop/") have a SHA-256 hash
+// starting with one of the listed prefixes. There is no full-hash lookup, so
+// a prefix hit is treated as a match.
+type hashPrefixPolicy struct {
+	prefixes map[int]map[string]bool // prefix length in bytes -> set of prefixes
+}
+
+// loadHashPrefixPolicy reads hexadecimal hash prefixes (4 to 32 bytes), one
+// per line. Empty lines and lines starting with '#' are skipped.
+func loadHashPrefixPolicy(path string) (*hashPrefixPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &hashPrefixPolicy{prefixes: map[int]map[string]bool{}}
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		b, err := hex.DecodeString(line)
+		if err != nil || len(b) < 4 || len(b) > sha256.Size {
+			return nil, fmt.Errorf("%s:%d: expected 4 to 32 hex-encoded bytes", path, n+1)
+		}
+		if p.prefixes[len(b)] == nil {
+			p.prefixes[len(b)] = map[string]bool{}
+		}
+		p.prefixes[len(b)][string(b)] = true
+	}
+	return p, nil
+}
+
+func (p *hashPrefixPolicy) Check(u *url.URL) (URIVerdict, string) {
+	for _, expr := range urlExpressions(u) {
+		sum := sha256.Sum256([]byte(expr))
+		for n, set := range p.prefixes {
+			if set[string(sum[:n])] {
+				return uriBlock, fmt.Sprintf("%s is on the local threat list", expr)
+			}
+		}
+	}
+	return uriNeutral, ""
+}
+
+// urlExpressions returns the host-suffix/path-prefix combinations used for
+// Safe Browsing style lookups: the exact host and up to four parent domains,
+// combined with the exact path (with and without query), "/" and up to four
+// leading path prefixes.
+func urlExpressions(u *url.URL) []string {
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return nil
+	}
+	hosts := []string{host}
+	if net.ParseIP(host) == nil {
+		labels := strings.Split(host, ".")
+		for i := max(1, len(labels)-5); i < len(labels)-1 && len(hosts) < 5; i++ {
+			hosts = append(hosts, strings.Join(labels[i:], "."))
+		}
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	paths := []string{}
+	if u.RawQuery != "" {
+		paths = append(paths, path+"?"+u.RawQuery)
+	}
+	paths = append(paths, path)
+	prefix := "/"
+	for i, seg := range strings.Split(strings.Trim(path, "/"), "/") {
+		if !slices.Contains(paths, prefix) {
+			paths = append(paths, prefix)
+		}
+		if i == 3 || seg == "" {
+			break
+		}
+		prefix += seg + "/"
+	}
+
+	var out []string
+	for _, h := range hosts {
+		for _, p := range paths {
+			out = append(out, h+p)
+		}
+	}
+	return out
+}
+
+// tokenBucket is a classic token bucket: it holds up to burst tokens and is
+// refilled at rate tokens per second.
+type tokenBucket struct {
+	rate, burst float64
+	tokens      float64
+	last        time.Time
+}
+
+func newTokenBucket(rate, burst float64) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// take removes one token if available. If not, it returns how long until the
+// next token arrives.
+func (b *tokenBucket) take(now time.Time) (ok bool, wait time.Duration) {
+	// a bucket created after now was taken has not lost any time
+	elapsed := max(0, now.Sub(b.last).Seconds())
+	b.tokens = math.Min(b.burst, b.tokens+elapsed*b.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if b.rate <= 0 {
+		return false, time.Hour
+	}
+	return false, time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// rateLimiter keeps one token bucket per client key. Buckets of clients that
+// have been idle long enough to be full again are dropped.
+type rateLimiter struct {
+	rate, burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	swept   time.Time
+}
+
+func newRateLimiter(rate, burst float64) *rateLimiter {
+	return &rateLimiter{rate: rate, burst: burst, buckets: map[string]*tokenBucket{}}
+}
+
+// allow takes a token from key's bucket, using rate and burst for a new
+// bucket (API keys have their own quota).
+func (l *rateLimiter) allow(key string, rate, burst float64) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.swept) > time.Minute {
+		for k, b := range l.buckets {
+			if b.rate > 0 && now.Sub(b.last).Seconds()*b.rate >= b.burst {
+				delete(l.buckets, k)
+			}
+		}
+		l.swept = now
+	}
+	b := l.buckets[key]
+	if b == nil {
+		b = newTokenBucket(rate, burst)
+		l.buckets[key] = b
+	}
+	return b.take(now)
+}
+
+// apiKey is an integrator with its own quota, identified by the
+// "Authorization: Bearer <key>" or "X-API-Key" request header.
+type apiKey struct {
+	Key   string  `json:"key"`
+	Name  string  `json:"name"`
+	Rate  float64 `json:"rate"`  // requests per second
+	Burst float64 `json:"burst"` // maximum burst
+}
+
+// loadAPIKeys reads a JSON array of apiKey.
+func loadAPIKeys(path string) (map[string]apiKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var list []apiKey
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	keys := make(map[string]apiKey, len(list))
+	for _, k := range list {
+		if k.Key == "" || k.Rate <= 0 || k.Burst < 1 {
+			return nil, fmt.Errorf("%s: API key %q needs a key, a positive rate and a burst of at least 1", path, k.Name)
+		}
+		if prev, dup := keys[k.Key]; dup {
+			return nil, fmt.Errorf("%s: API keys %q and %q have the same key", path, prev.Name, k.Name)
+		}
+		keys[k.Key] = k
+	}
+	return keys, nil
+}
+
+// Challenge lets a client that exceeded its rate limit prove it is worth
+// serving anyway, e.g. with proof of work or a CAPTCHA. Verify is called
+// first; if it fails, Issue writes the challenge response.
+type Challenge interface {
+	Verify(r *http.Request, client string) bool
+	Issue(w http.ResponseWriter, r *http.Request, client string)
+}
+
+// powChallenge is a hashcash-style proof of work: the client gets a nonce
+// in the X-PoW-Challenge header and must find a counter such that
+// SHA-256(nonce ":" counter) starts with bits zero bits, then repeat the
+// request with "X-PoW-Solution: nonce:counter". Each nonce is bound to the
+// client, valid for powValidity and usable once.
+type powChallenge struct {
+	secret []byte
+	bits   int
+
+	mu   sync.Mutex
+	used map[string]time.Time
+}
+
+const (
+	powValidity = 5 * time.Minute
+	// maxPoWBits keeps challenges solvable: 32 bits already take billions
+	// of hashes on average.
+	maxPoWBits = 32
+)
+
+func newPoWChallenge(bits int) (*powChallenge, error) {
+	if bits < 1 || bits > maxPoWBits {
+		return nil, fmt.Errorf("proof of work of %d bits, want 1 to %d", bits, maxPoWBits)
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return &powChallenge{secret: secret, bits: bits, used: map[string]time.Time{}}, nil
+}
+
+// nonce returns "<unix time>.<mac>", binding the issue time to the client.
+func (p *powChallenge) nonce(client string, t int64) string {
+	mac := hmac.New(sha256.New, p.secret)
+	fmt.Fprintf(mac, "%s|%d", client, t)
+	return fmt.Sprintf("%d.%s", t, hex.EncodeToString(mac.Sum(nil)[:16]))
+}
+
+func (p *powChallenge) Issue(w http.ResponseWriter, r *http.Request, client string) {
+	w.Header().Set("X-PoW-Challenge", fmt.Sprintf("%s; bits=%d", p.nonce(client, time.Now().Unix()), p.bits))
+	http.Error(w, fmt.Sprintf("Too many requests. Solve the proof of work in the X-PoW-Challenge header (%d leading zero bits of SHA-256(nonce:counter)) and retry with X-PoW-Solution: nonce:counter.", p.bits), http.StatusTooManyRequests)
+}
+
+func (p *powChallenge) Verify(r *http.Request, client string) bool {
+	sol := r.Header.Get("X-PoW-Solution")
+	nonce, _, ok := strings.Cut(sol, ":")
+	if !ok {
+		return false
+	}
+	ts, _, _ := strings.Cut(nonce, ".")
+	t, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || time.Since(time.Unix(t, 0)) > powValidity || !hmac.Equal([]byte(nonce), []byte(p.nonce(client, t))) {
+		return false
+	}
+	sum := sha256.Sum256([]byte(sol))
+	for i := 0; i < p.bits; i++ {
+		if sum[i/8]&(0x80>>(i%8)) != 0 {
+			return false
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for n, at := range p.used {
+		if time.Since(at) > powValidity {
+			delete(p.used, n)
+		}
+	}
+	if _, seen := p.used[nonce]; seen {
+		return false
+	}
+	p.used[nonce] = time.Now()
+	return true
+}
+
+// abuseGuard protects the handlers that send DNS queries: a token bucket per
+// client (or per API key), an optional challenge for clients over their
+// limit, and a global budget for outbound queries.
+type abuseGuard struct {
+	clients   *rateLimiter
+	keys      map[string]apiKey
+	challenge Challenge
+	trusted   []netip.Prefix // proxies whose X-Forwarded-For is believed
+
+	globalMu sync.Mutex
+	global   *tokenBucket // nil means no global budget
+}
+
+// clientKey identifies the client for rate limiting: its API key if it has
+// a valid one, otherwise its address (IPv6 clients by /64).
+func (g *abuseGuard) clientKey(r *http.Request) (key string, quota *apiKey) {
+	k := r.Header.Get("X-API-Key")
+	if k == "" {
+		k, _ = strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	if ak, ok := g.keys[k]; ok && k != "" {
+		// by key, not name: names are only labels and need not be unique
+		return "key:" + ak.Key, &ak
+	}
+	addr := clientAddr(r, g.trusted)
+	if addr.Is6() && !addr.Is4In6() {
+		p, _ := addr.Prefix(64)
+		return "ip:" + p.String(), nil
+	}
+	return "ip:" + addr.Unmap().String(), nil
+}
+
+// clientAddr returns the remote address, or the nearest address in
+// X-Forwarded-For that is not a trusted proxy when the request came through one.
+func clientAddr(r *http.Request, trusted []netip.Prefix) netip.Addr {
+	isTrusted := func(a netip.Addr) bool {
+		for _, p := range trusted {
+			if p.Contains(a.Unmap()) {
+				return true
+			}
+		}
+		return false
+	}
+	ap, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		// Unix socket: only a local proxy can connect
+		ap = netip.AddrPortFrom(netip.IPv6Loopback(), 0)
+	}
+	addr := ap.Addr()
+	if !isTrusted(addr) {
+		return addr
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		a, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		addr = a
+		if !isTrusted(a) {
+			break
+		}
+	}
+	return addr
+}
+
+// lookupBudget reports whether the global outbound query budget allows one
+// more DNS lookup.
+func (g *abuseGuard) lookupBudget() bool {
+	if g == nil || g.global == nil {
+		return true
+	}
+	g.globalMu.Lock()
+	defer g.globalMu.Unlock()
+	ok, _ := g.global.take(time.Now())
+	return ok
+}
+
+// wrap applies the per-client limit to next.
+func (g *abuseGuard) wrap(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, quota := g.clientKey(r)
+		rate, burst := g.clients.rate, g.clients.burst
+		if quota != nil {
+			rate, burst = quota.Rate, quota.Burst
+		}
+		ok, wait := g.clients.allow(key, rate, burst)
+		if !ok && g.challenge != nil && quota == nil {
+			if g.challenge.Verify(r, key) {
+				ok = true
+			} else {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				g.challenge.Issue(w, r, key)
+				return
+			}
+		}
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "Too many requests, please slow down.", http.StatusTooManyRequests)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// errBusy is returned by lookupTXT when the global query budget is used up.
+var errBusy = errors.New("outbound DNS query budget exhausted")
+
+// The escaping of the Prometheus text exposition format: backslash, double
+// quote and line feed in label values; backslash and line feed in HELP.
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+// counterVec is a Prometheus counter with one label.
+type counterVec struct {
+	name, help, label string
+
+	mu     sync.Mutex
+	values map[string]uint64
+}
+
+func newCounterVec(name, help, label string) *counterVec {
+	return &counterVec{name: name, help: help, label: label, values: map[string]uint64{}}
+}
+
+func (c *counterVec) inc(labelValue string) {
+	c.mu.Lock()
+	c.values[labelValue]++
+	c.mu.Unlock()
+}
+
+func (c *counterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, helpEscaper.Replace(c.help), c.name)
+	for _, lv := range slices.Sorted(maps.Keys(c.values)) {
+		fmt.Fprintf(w, "%s{%s=\"%s\"} %d\n", c.name, c.label, labelEscaper.Replace(lv), c.values[lv])
+	}
+}
+
+// histogramVec is a Prometheus histogram with one label.
+type histogramVec struct {
+	name, help, label string
+	buckets           []float64
+
+	mu     sync.Mutex
+	series map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+func newHistogramVec(name, help, label string, buckets []float64) *histogramVec {
+	return &histogramVec{name: name, help: help, label: label, buckets: buckets, series: map[string]*histogram{}}
+}
+
+func (h *histogramVec) observe(labelValue string, v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.series[labelValue]
+	if s == nil {
+		s = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.series[labelValue] = s
+	}
+	if i, _ := slices.BinarySearch(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.sum += v
+	s.count++
+}
+
+func (h *histogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, helpEscaper.Replace(h.help), h.name)
+	for _, lv := range slices.Sorted(maps.Keys(h.series)) {
+		s := h.series[lv]
+		label := fmt.Sprintf("%s=\"%s\"", h.label, labelEscaper.Replace(lv))
+		var cum uint64
+		for i, le := range h.buckets {
+			cum += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%g\"} %d\n", h.name, label, le, cum)
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", h.name, label, s.count)
+		fmt.Fprintf(w, "%s_sum{%s} %g\n", h.name, label, s.sum)
+		fmt.Fprintf(w, "%s_count{%s} %d\n", h.name, label, s.count)
+	}
+}
+
+var (
+	checksTotal   = newCounterVec("forsale_checks_total", "Domain checks by verdict.", "verdict")
+	recordsTotal  = newCounterVec("forsale_records_total", "_for-sale TXT records seen, by content tag.", "tag")
+	dnsErrors     = newCounterVec("forsale_dns_errors_total", "Failed DNS lookups by response code: NXDOMAIN, SERVFAIL and other rcodes, NODATA for NOERROR without records, TIMEOUT or NETWORK when no resolver answered.", "rcode")
+	cacheRequests = newCounterVec("forsale_dns_cache_requests_total", "DNS cache lookups by result.", "result")
+	dnsLatency    = newHistogramVec("forsale_dns_lookup_duration_seconds", "Duration of DNS lookups by resolver.", "resolver",
+		[]float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5})
+)
+
+// metricsHandler serves the metrics in the Prometheus text format.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	for _, m := range []interface{ write(io.Writer) }{checksTotal, recordsTotal, dnsErrors, cacheRequests, dnsLatency} {
+		m.write(w)
+	}
+}
+
+// resolvers are the recursive resolvers from /etc/resolv.conf, queried in
+// turn, as host:port. They are queried directly rather than through the Go
+// resolver because the answer's TTLs and rcode are needed.
+var resolvers []string
+
+// lookupResult is the answer to a TXT lookup.
+type lookupResult struct {
+	txts []string
+	// ttl is how long the answer may be cached: the smallest TTL in the
+	// answer, or the negative caching TTL from the SOA record
+	ttl time.Duration
+	// negative explains why there are no records
+	negative *negativeAnswer
+	// rcode labels a failure in the metrics: the response code of the
+	// answer, NODATA for NOERROR without records, or TIMEOUT or NETWORK
+	// when no resolver answered
+	rcode string
+}
+
+// queryTXT asks the resolvers in turn for the TXT records of name, with
+// EDNS0 and a TCP retry when the answer is truncated. Failures are reported
+// as *net.DNSError, like the Go resolver does, and explained by the
+// negative answer of the result.
+func queryTXT(ctx context.Context, name string) (lookupResult, error) {
+	dnsErr := &net.DNSError{Err: "no resolvers configured", Name: name}
+	// the last failure, explained if no resolver answers
+	var failedResp *dns.Msg
+	var failedServer string
+	failedRcode := "NETWORK"
+	for _, server := range resolvers {
+		start := time.Now()
+		resp, err := exchange(ctx, server, name, dns.TypeTXT, false)
+		dnsLatency.observe(server, time.Since(start).Seconds())
+
+		var netErr net.Error
+		switch {
+		case errors.As(err, &netErr) && netErr.Timeout(), errors.Is(err, context.DeadlineExceeded):
+			dnsErr = &net.DNSError{Err: "i/o timeout", Name: name, Server: server, IsTimeout: true, IsTemporary: true}
+			failedResp, failedRcode = nil, "TIMEOUT"
+			continue
+		case err != nil:
+			dnsErr = &net.DNSError{Err: err.Error(), Name: name, Server: server, IsTemporary: true}
+			failedResp, failedRcode = nil, "NETWORK"
+			continue
+		case resp.Rcode == dns.RcodeNameError:
+			return lookupResult{ttl: negativeTTL(resp), negative: classifyNegative(ctx, name, resp, server), rcode: dns.RcodeToString[resp.Rcode]},
+				&net.DNSError{Err: "no such host", Name: name, Server: server, IsNotFound: true}
+		case resp.Rcode != dns.RcodeSuccess:
+			dnsErr = &net.DNSError{Err: "server misbehaving: " + dns.RcodeToString[resp.Rcode], Name: name, Server: server, IsTemporary: true}
+			failedResp, failedServer, failedRcode = resp, server, dns.RcodeToString[resp.Rcode]
+			continue
+		}
+
+		var res lookupResult
+		minTTL := uint32(math.MaxUint32)
+		for _, rr := range resp.Answer {
+			minTTL = min(minTTL, rr.Header().Ttl)
+			t, ok := rr.(*dns.TXT)
+			if !ok {
+				continue
+			}
+			// like the Go resolver, join the character-strings of an RR
+			parts, err := txtStrings(t)
+			if err != nil {
+				continue
+			}
+			res.txts = append(res.txts, strings.Join(parts, ""))
+		}
+		if len(res.txts) == 0 {
+			return lookupResult{ttl: negativeTTL(resp), negative: classifyNegative(ctx, name, resp, server), rcode: "NODATA"},
+				&net.DNSError{Err: "no such host", Name: name, Server: server, IsNotFound: true}
+		}
+		res.ttl = time.Duration(minTTL) * time.Second
+		return res, nil
+	}
+	switch {
+	case dnsErr.IsTimeout:
+		return lookupResult{negative: &negativeAnswer{Class: "timeout"}, rcode: failedRcode}, dnsErr
+	case failedResp != nil:
+		return lookupResult{negative: classifyNegative(ctx, name, failedResp, failedServer), rcode: failedRcode}, dnsErr
+	}
+	return lookupResult{rcode: failedRcode}, dnsErr
+}
+
+// negativeAnswer explains why a lookup gave no TXT records. The explanation
+// shown is the message "negative.<Class>".
+type negativeAnswer struct {
+	// Class is "nxdomain" (_for-sale does not exist, the domain does),
+	// "nxdomain-parent" (the domain itself does not exist), "nodata" (the
+	// name exists without TXT records), "servfail", "servfail-dnssec"
+	// (DNSSEC validation failed), "timeout" or "error" (another rcode)
+	Class       string   `json:"class"`
+	Rcode       string   `json:"rcode,omitempty"`
+	NegativeTTL uint32   `json:"negative_ttl,omitempty"` // seconds: min(SOA TTL, SOA MINIMUM) (RFC 2308)
+	Zone        string   `json:"zone,omitempty"`         // owner of the SOA record; empty without one
+	EDE         []string `json:"ede,omitempty"`          // extended DNS errors (RFC 8914)
+}
+
+// dnssecEDE are the extended DNS error codes that report a DNSSEC
+// validation failure.
+var dnssecEDE = map[uint16]bool{
+	dns.ExtendedErrorCodeUnsupportedDNSKEYAlgorithm:  true,
+	dns.ExtendedErrorCodeUnsupportedDSDigestType:     true,
+	dns.ExtendedErrorCodeDNSSECIndeterminate:         true,
+	dns.ExtendedErrorCodeDNSBogus:                    true,
+	dns.ExtendedErrorCodeSignatureExpired:            true,
+	dns.ExtendedErrorCodeSignatureNotYetValid:        true,
+	dns.ExtendedErrorCodeDNSKEYMissing:               true,
+	dns.ExtendedErrorCodeRRSIGsMissing:               true,
+	dns.ExtendedErrorCodeNoZoneKeyBitSet:             true,
+	dns.ExtendedErrorCodeNSECMissing:                 true,
+	dns.ExtendedErrorCodeSignatureExpiredBeforeValid: true,
+}
+
+// classifyNegative explains a response to the TXT query for name without
+// TXT records. After NXDOMAIN it asks server whether the parent of name
+// exists (nothing exists below a name that does not, RFC 8020); after
+// SERVFAIL it repeats the query with checking disabled, which a validating
+// resolver answers if only DNSSEC validation failed.
+func classifyNegative(ctx context.Context, name string, resp *dns.Msg, server string) *negativeAnswer {
+	neg := &negativeAnswer{Rcode: dns.RcodeToString[resp.Rcode]}
+	for _, rr := range resp.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			neg.NegativeTTL = min(soa.Hdr.Ttl, soa.Minttl)
+			neg.Zone = soa.Hdr.Name
+			break
+		}
+	}
+	dnssecFailure := false
+	if opt := resp.IsEdns0(); opt != nil {
+		for _, o := range opt.Option {
+			if ede, ok := o.(*dns.EDNS0_EDE); ok {
+				e := fmt.Sprintf("%d (%s)", ede.InfoCode, dns.ExtendedErrorCodeToString[ede.InfoCode])
+				if ede.ExtraText != "" {
+					e += ": " + ede.ExtraText
+				}
+				neg.EDE = append(neg.EDE, e)
+				dnssecFailure = dnssecFailure || dnssecEDE[ede.InfoCode]
+			}
+		}
+	}
+
+	switch resp.Rcode {
+	case dns.RcodeNameError:
+		neg.Class = "nxdomain"
+		if _, parent, ok := strings.Cut(name, "."); ok {
+			if r, err := exchange(ctx, server, parent, dns.TypeSOA, false); err == nil && r.Rcode == dns.RcodeNameError {
+				neg.Class = "nxdomain-parent"
+			}
+		}
+	case dns.RcodeSuccess:
+		neg.Class = "nodata"
+	case dns.RcodeServerFailure:
+		neg.Class = "servfail"
+		if r, err := exchange(ctx, server, name, dns.TypeTXT, true); err == nil && (r.Rcode == dns.RcodeSuccess || r.Rcode == dns.RcodeNameError) {
+			dnssecFailure = true
+		}
+		if dnssecFailure {
+			neg.Class = "servfail-dnssec"
+		}
+	default:
+		neg.Class = "error"
+	}
+	return neg
+}
+
+// negativeText is the explanation of a failed lookup of domain's records.
+func negativeText(lang, domain string, neg *negativeAnswer) string {
+	msg := text(lang, "negative."+neg.Class, domain, neg.Rcode)
+	for _, e := range neg.EDE {
+		msg += " " + text(lang, "negative.ede", e)
+	}
+	return msg
+}
+
+// exchange sends one query for qname to server with EDNS0 over UDP, and
+// repeats it over TCP when the answer is truncated. cd sets the Checking
+// Disabled bit.
+func exchange(ctx context.Context, server, qname string, qtype uint16, cd bool) (*dns.Msg, error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(qname), qtype)
+	msg.SetEdns0(4096, false)
+	msg.CheckingDisabled = cd
+	client := &dns.Client{Net: "udp"}
+	resp, _, err := client.ExchangeContext(ctx, msg, server)
+	if err == nil && resp.Truncated {
+		client.Net = "tcp"
+		resp, _, err = client.ExchangeContext(ctx, msg, server)
+	}
+	return resp, err
+}
+
+// txtStrings returns the character-strings of t as octets: t.Txt holds
+// them in presentation format, so they are taken from the packed RDATA.
+func txtStrings(t *dns.TXT) ([]string, error) {
+	buf := make([]byte, dns.Len(t))
+	end, err := dns.PackRR(t, buf, 0, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	rdata := buf[end-int(t.Hdr.Rdlength) : end]
+	var out []string
+	for len(rdata) > 0 {
+		n := int(rdata[0])
+		if 1+n > len(rdata) {
+			return nil, errors.New("truncated character-string")
+		}
+		out = append(out, string(rdata[1:1+n]))
+		rdata = rdata[1+n:]
+	}
+	return out, nil
+}
+
+// negativeTTL is how long a negative answer may be cached (RFC 2308): the
+// smaller of the SOA record's TTL and MINIMUM field.
+func negativeTTL(resp *dns.Msg) time.Duration {
+	for _, rr := range resp.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return time.Duration(min(soa.Hdr.Ttl, soa.Minttl)) * time.Second
+		}
+	}
+	return 0
+}
+
+// txtCache caches TXT lookups for the TTL of the answer, capped at a
+// maximum. Temporary failures are not cached.
+type txtCache struct {
+	ttl time.Duration
+	max int
+
+	mu      sync.Mutex
+	entries map[string]txtCacheEntry
+}
+
+type txtCacheEntry struct {
+	txts     []string
+	negative *negativeAnswer
+	err      error
+	expires  time.Time
+}
+
+// cache is nil when caching is disabled.
+var cache *txtCache
+
+func (c *txtCache) get(name string) (txtCacheEntry, bool) {
+	if c == nil {
+		return txtCacheEntry{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[name]
+	if !ok || time.Now().After(e.expires) {
+		return txtCacheEntry{}, false
+	}
+	return e, true
+}
+
+func (c *txtCache) put(name string, res lookupResult, err error) {
+	if c == nil || res.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if len(c.entries) >= c.max {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= c.max {
+			return
+		}
+	}
+	c.entries[name] = txtCacheEntry{txts: res.txts, negative: res.negative, err: err, expires: now.Add(min(res.ttl, c.ttl))}
+}
+
+// lookupTXT looks up TXT records through the cache and the global query
+// budget. The TTL of a cached answer is what remains of it.
+func lookupTXT(ctx context.Context, name string) (lookupResult, error) {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if e, ok := cache.get(name); ok {
+		cacheRequests.inc("hit")
+		return lookupResult{txts: e.txts, ttl: time.Until(e.expires).Truncate(time.Second), negative: e.negative}, e.err
+	}
+	cacheRequests.inc("miss")
+	if !guard.lookupBudget() {
+		return lookupResult{}, errBusy
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+	res, err := queryTXT(ctx, name)
+
+	if err != nil {
+		dnsErrors.inc(res.rcode)
+	}
+	var dnsErr *net.DNSError
+	if err == nil || errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		cache.put(name, res, err)
+	}
+	return res, err
+}
+
+// readiness caches the outcome of the resolver probe for a few seconds, so
+// /readyz cannot be used to generate DNS traffic.
+var readiness struct {
+	mu      sync.Mutex
+	checked time.Time
+	err     error
+}
+
+// readyProbe is the name /readyz looks up to verify that a resolver answers.
+var readyProbe = "_for-sale.testdns.nl"
+
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+// readyzHandler reports ready when a resolver answers the probe query; an
+// NXDOMAIN answer counts, only an unreachable resolver does not.
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	readiness.mu.Lock()
+	if time.Since(readiness.checked) > 10*time.Second {
+		ctx, cancel := context.WithTimeout(r.Context(), lookupTimeout)
+		_, err := queryTXT(ctx, readyProbe)
+		cancel()
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			err = nil
+		}
+		readiness.checked, readiness.err = time.Now(), err
+	}
+	err := readiness.err
+	readiness.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "resolver unreachable: %v\n", err)
+		return
+	}
+	fmt.Fprintln(w, "ready")
+}
+
+// registrationInfo holds contact information from RDAP or WHOIS, shown when
+// the version tag is present but the content is absent or invalid, as the
+// draft suggests.
+type registrationInfo struct {
+	Source   string    `json:"source"` // "rdap" or "whois"
+	Server   string    `json:"server"`
+	Contacts []contact `json:"contacts,omitempty"`
+	Status   []string  `json:"status,omitempty"` // registry statuses, e.g. "active" or "pending delete"
+}
+
+// contact is one entity of the registration, e.g. the registrar or its abuse desk.
+type contact struct {
+	Role  string `json:"role"`
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email,omitempty"`
+	Phone string `json:"phone,omitempty"`
+	URL   string `json:"url,omitempty"`
+}
+
+const registrationTimeout = 10 * time.Second
+
+// registrationCache caches RDAP/WHOIS lookups like txtCache does DNS
+// answers: for at most -cache-ttl, and failures not at all. Registries
+// give no TTL, so the maximum is used.
+type registrationCache struct {
+	ttl time.Duration
+	max int
+
+	mu      sync.Mutex
+	entries map[string]registrationCacheEntry
+}
+
+type registrationCacheEntry struct {
+	info    *registrationInfo
+	expires time.Time
+}
+
+// regCache is nil when caching is disabled.
+var regCache *registrationCache
+
+func (c *registrationCache) get(domain string) (*registrationInfo, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[strings.ToLower(domain)]
+	if !ok || time.Now().After(e.expires) {
+		return nil, false
+	}
+	return e.info, true
+}
+
+func (c *registrationCache) put(domain string, info *registrationInfo) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if len(c.entries) >= c.max {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= c.max {
+			return
+		}
+	}
+	c.entries[strings.ToLower(domain)] = registrationCacheEntry{info: info, expires: now.Add(c.ttl)}
+}
+
+var (
+	// rdapServices maps domain suffixes (usually TLDs) to RDAP base URLs,
+	// from the IANA bootstrap file (RFC 9224); nil when RDAP is disabled.
+	rdapServices map[string][]string
+	// whoisFallback enables port-43 WHOIS when RDAP is unavailable or fails.
+	whoisFallback bool
+	// whoisServer overrides the WHOIS server found via whois.iana.org.
+	whoisServer string
+	// checkRegistryStatus flags domains in redemption or pendingDelete.
+	checkRegistryStatus bool
+)
+
+// loadRDAPBootstrap reads an IANA RDAP bootstrap file for DNS, such as
+// https://data.iana.org/rdap/dns.json saved to disk.
+func loadRDAPBootstrap(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var bootstrap struct {
+		Services [][][]string `json:"services"`
+	}
+	if err := json.Unmarshal(data, &bootstrap); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	rdapServices = map[string][]string{}
+	for _, svc := range bootstrap.Services {
+		if len(svc) != 2 {
+			continue
+		}
+		for _, suffix := range svc[0] {
+			rdapServices[strings.ToLower(suffix)] = svc[1]
+		}
+	}
+	return nil
+}
+
+// rdapBaseURL returns the RDAP base URL for domain, using the longest
+// matching suffix in the bootstrap file and preferring HTTPS.
+func rdapBaseURL(domain string) string {
+	labels := strings.Split(strings.ToLower(strings.TrimSuffix(domain, ".")), ".")
+	for i := range labels {
+		urls := rdapServices[strings.Join(labels[i:], ".")]
+		if len(urls) == 0 {
+			continue
+		}
+		base := urls[0]
+		for _, u := range urls {
+			if strings.HasPrefix(u, "https://") {
+				base = u
+				break
+			}
+		}
+		if !strings.HasSuffix(base, "/") {
+			base += "/"
+		}
+		return base
+	}
+	return ""
+}
+
+// lookupRegistration finds the contacts of domain via RDAP and, if that is
+// not possible and the fallback is enabled, via WHOIS.
+func lookupRegistration(ctx context.Context, domain string) (*registrationInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, registrationTimeout)
+	defer cancel()
+	var rdapErr error
+	if rdapServices != nil {
+		info, err := lookupRDAP(ctx, domain)
+		if err == nil || !whoisFallback {
+			return info, err
+		}
+		rdapErr = err
+	}
+	if !whoisFallback {
+		return nil, errors.New("RDAP and WHOIS lookups are disabled")
+	}
+	info, err := lookupWHOIS(ctx, domain)
+	if err != nil && rdapErr != nil {
+		return nil, fmt.Errorf("RDAP: %v; WHOIS: %w", rdapErr, err)
+	}
+	return info, err
+}
+
+// rdapEntity is the part of an RDAP entity object (RFC 9083) used here.
+type rdapEntity struct {
+	Roles      []string          `json:"roles"`
+	VcardArray []json.RawMessage `json:"vcardArray"`
+	Entities   []rdapEntity      `json:"entities"`
+}
+
+func lookupRDAP(ctx context.Context, domain string) (*registrationInfo, error) {
+	base := rdapBaseURL(domain)
+	if base == "" {
+		return nil, fmt.Errorf("no RDAP service for %s in the bootstrap file", domain)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"domain/"+url.PathEscape(strings.TrimSuffix(domain, ".")), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/rdap+json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("RDAP server %s answered %s", req.URL.Host, resp.Status)
+	}
+	var obj struct {
+		Status   []string     `json:"status"`
+		Entities []rdapEntity `json:"entities"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&obj); err != nil {
+		return nil, fmt.Errorf("invalid RDAP response: %w", err)
+	}
+	info := &registrationInfo{Source: "rdap", Server: req.URL.Host, Status: obj.Status}
+	var walk func([]rdapEntity)
+	walk = func(entities []rdapEntity) {
+		for _, e := range entities {
+			c := vcardContact(e.VcardArray)
+			if c != (contact{}) {
+				for _, role := range e.Roles {
+					c.Role = role
+					info.Contacts = append(info.Contacts, c)
+				}
+			}
+			walk(e.Entities)
+		}
+	}
+	walk(obj.Entities)
+	return info, nil
+}
+
+// vcardContact extracts the name, e-mail, phone and URL from a jCard
+// (RFC 7095): ["vcard", [["fn", {}, "text", "Example Registrar"], ...]].
+func vcardContact(vcard []json.RawMessage) contact {
+	var c contact
+	if len(vcard) != 2 {
+		return c
+	}
+	var props [][]json.RawMessage
+	if err := json.Unmarshal(vcard[1], &props); err != nil {
+		return c
+	}
+	for _, p := range props {
+		if len(p) < 4 {
+			continue
+		}
+		var name, value string
+		if json.Unmarshal(p[0], &name) != nil || json.Unmarshal(p[3], &value) != nil || value == "" {
+			continue
+		}
+		switch name {
+		case "fn":
+			c.Name = value
+		case "email":
+			c.Email = value
+		case "tel":
+			if c.Phone == "" {
+				c.Phone = strings.TrimPrefix(value, "tel:")
+			}
+		case "url":
+			c.URL = value
+		}
+	}
+	return c
+}
+
+// whoisQuery sends query to a port-43 WHOIS server (RFC 3912).
+func whoisQuery(ctx context.Context, server, query string) (string, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "43")
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", server)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if _, err := io.WriteString(conn, query+"\r\n"); err != nil {
+		return "", err
+	}
+	data, err := io.ReadAll(io.LimitReader(conn, 1<<20))
+	return string(data), err
+}
+
+func lookupWHOIS(ctx context.Context, domain string) (*registrationInfo, error) {
+	domain = strings.TrimSuffix(domain, ".")
+	server := whoisServer
+	if server == "" {
+		// ask IANA which server serves the TLD
+		tld := domain[strings.LastIndex(domain, ".")+1:]
+		answer, err := whoisQuery(ctx, "whois.iana.org", tld)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(answer, "\n") {
+			key, value, ok := strings.Cut(line, ":")
+			if ok && (strings.EqualFold(strings.TrimSpace(key), "refer") || strings.EqualFold(strings.TrimSpace(key), "whois")) {
+				server = strings.TrimSpace(value)
+				break
+			}
+		}
+		if server == "" {
+			return nil, fmt.Errorf("no WHOIS server known for .%s", tld)
+		}
+	}
+	answer, err := whoisQuery(ctx, server, domain)
+	if err != nil {
+		return nil, err
+	}
+	contacts, status := parseWHOIS(answer)
+	return &registrationInfo{Source: "whois", Server: server, Contacts: contacts, Status: status}, nil
+}
+
+// parseWHOIS picks the registrar and abuse contacts and the domain statuses
+// from a WHOIS answer.
+// The format is not standardised; this understands the common gTLD keys
+// and the block style used by several ccTLDs, where the value follows on
+// indented lines:
+//
+//	Registrar:
+//	   Example Registrar B.V.
+func parseWHOIS(answer string) ([]contact, []string) {
+	var registrar, abuse contact
+	var status []string
+	registrar.Role, abuse.Role = "registrar", "abuse"
+	lines := strings.Split(strings.ReplaceAll(answer, "\r", ""), "\n")
+	for i, line := range lines {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+		if value == "" && i+1 < len(lines) && strings.HasPrefix(lines[i+1], " ") {
+			value = strings.TrimSpace(lines[i+1])
+		}
+		if value == "" {
+			continue
+		}
+		switch key {
+		case "registrar", "registrar name", "sponsoring registrar":
+			if registrar.Name == "" {
+				registrar.Name = value
+			}
+		case "registrar url", "referral url":
+			registrar.URL = value
+		case "registrar abuse contact email", "abuse email", "abuse-mailbox", "abuse contact":
+			abuse.Email = value
+		case "registrar abuse contact phone", "abuse phone":
+			abuse.Phone = value
+		case "domain status", "status":
+			status = append(status, value)
+		}
+	}
+	var contacts []contact
+	if registrar.Name != "" || registrar.URL != "" {
+		contacts = append(contacts, registrar)
+	}
+	if abuse.Email != "" || abuse.Phone != "" {
+		contacts = append(contacts, abuse)
+	}
+	return contacts, status
+}
+
+// unreliableStatuses are the registry statuses during which the draft's
+// Scope section says _for-sale records cannot be relied on, keyed by their
+// normalised RDAP (RFC 8056) or EPP form.
+var unreliableStatuses = map[string]string{
+	"pendingdelete":    "pendingDelete",
+	"redemptionperiod": "redemption",
+	"pendingrestore":   "pendingRestore",
+	// .nl calls its redemption period quarantine
+	"quarantine":   "redemption",
+	"inquarantine": "redemption",
+}
+
+// unreliableRegistryStatus returns the first status that makes the records
+// unreliable, e.g. "pendingDelete", or "".
+func unreliableRegistryStatus(statuses []string) string {
+	for _, st := range statuses {
+		// WHOIS appends a URL: "pendingDelete https://icann.org/epp#pendingDelete"
+		if f := strings.Fields(st); len(f) > 1 && strings.HasPrefix(f[len(f)-1], "http") {
+			st = strings.Join(f[:len(f)-1], " ")
+		}
+		key := strings.NewReplacer(" ", "", "_", "", "-", "").Replace(strings.ToLower(st))
+		if name, ok := unreliableStatuses[key]; ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// specialUse is a special-use domain name (RFC 6761). The draft puts these
+// out of scope, and records under .arpa MUST be ignored.
+type specialUse struct {
+	Name      string // without trailing dot, e.g. "onion"
+	Reference string // e.g. "RFC 7686"
+	Reason    string
+}
+
+// specialUseNames holds the special-use domain names by name: the built-in
+// list in special-use.csv, extended by the IANA registry loaded from disk.
+var specialUseNames = map[string]specialUse{}
+
+//go:embed special-use.csv
+var builtinSpecialUse string
+
+func init() {
+	addSpecialUseNames(builtinSpecialUse)
+}
+
+// loadSpecialUseNames adds the names from the IANA "Special-Use Domain
+// Names" registry, saved as CSV (special-use-domain.csv: Name,Reference) or
+// as plain text with one name per line.
+func loadSpecialUseNames(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	addSpecialUseNames(string(data))
+	return nil
+}
+
+// addSpecialUseNames adds the names in data, one per line as
+// Name[,Reference[,Reason]]. Names already known keep their entry.
+func addSpecialUseNames(data string) {
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), ",", 3)
+		name := strings.ToLower(strings.TrimSuffix(strings.Trim(fields[0], `"`), "."))
+		if name == "" || name == "name" || strings.HasPrefix(name, "#") {
+			continue
+		}
+		if _, ok := specialUseNames[name]; ok {
+			continue
+		}
+		su := specialUse{Name: name, Reason: "listed in the IANA Special-Use Domain Names registry"}
+		if len(fields) > 1 {
+			ref := strings.NewReplacer("[", "", "]", "", `"`, "").Replace(strings.TrimSpace(fields[1]))
+			if !strings.Contains(ref, "RFC ") {
+				ref = strings.Replace(ref, "RFC", "RFC ", 1)
+			}
+			su.Reference = ref
+		}
+		if len(fields) > 2 {
+			su.Reason = strings.TrimSpace(fields[2])
+		}
+		specialUseNames[name] = su
+	}
+}
+
+// lookupSpecialUse reports whether domain is, or is under, a special-use
+// domain name. The shortest match wins, so anything under .arpa is .arpa.
+func lookupSpecialUse(domain string) (specialUse, bool) {
+	labels := strings.Split(strings.ToLower(strings.TrimSuffix(domain, ".")), ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		if su, ok := specialUseNames[strings.Join(labels[i:], ".")]; ok {
+			return su, true
+		}
+	}
+	return specialUse{}, false
+}
+
+// String describes the name for the user.
+func (su specialUse) String() string {
+	if su.Name == "arpa" {
+		return "." + su.Name + ": " + su.Reason
+	}
+	ref := ""
+	if su.Reference != "" {
+		ref = " (" + su.Reference + ")"
+	}
+	return "." + su.Name + ref + ": " + su.Reason + "; the draft does not apply to special-use domain names"
+}
+
+// publicSuffixList holds the rules of the Public Suffix List
+// (https://publicsuffix.org/list/public_suffix_list.dat), loaded from disk,
+// with internationalised rules in Unicode as in the file.
+type publicSuffixList struct {
+	rules      map[string]bool // "co.uk"
+	wildcards  map[string]bool // "*.ck" stored as "ck"
+	exceptions map[string]bool // "!www.ck" stored as "www.ck"
+}
+
+// psl is nil when no list was loaded.
+var psl *publicSuffixList
+
+func loadPublicSuffixList(path string) (*publicSuffixList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	l := &publicSuffixList{rules: map[string]bool{}, wildcards: map[string]bool{}, exceptions: map[string]bool{}}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "//") {
+			continue
+		}
+		rule := strings.ToLower(fields[0])
+		switch {
+		case strings.HasPrefix(rule, "!"):
+			l.exceptions[rule[1:]] = true
+		case strings.HasPrefix(rule, "*."):
+			l.wildcards[rule[2:]] = true
+		default:
+			l.rules[rule] = true
+		}
+	}
+	if len(l.rules) == 0 {
+		return nil, fmt.Errorf("%s: no rules found", path)
+	}
+	return l, nil
+}
+
+// publicSuffix returns the public suffix of domain following the PSL
+// algorithm: exceptions win, then the longest matching rule; "*" is the
+// implicit default rule.
+func (l *publicSuffixList) publicSuffix(domain string) string {
+	labels := strings.Split(strings.ToLower(strings.TrimSuffix(domain, ".")), ".")
+	// the list is in Unicode; match A-labels in their Unicode form
+	ulabels := make([]string, len(labels))
+	for i, label := range labels {
+		ulabels[i] = label
+		if strings.HasPrefix(label, "xn--") {
+			if u, err := idna.Punycode.ToUnicode(label); err == nil {
+				ulabels[i] = u
+			}
+		}
+	}
+	for i := range labels {
+		name := strings.Join(ulabels[i:], ".")
+		if l.exceptions[name] {
+			return strings.Join(labels[i+1:], ".")
+		}
+		if l.rules[name] || i+1 < len(labels) && l.wildcards[strings.Join(ulabels[i+1:], ".")] {
+			return strings.Join(labels[i:], ".")
+		}
+	}
+	return labels[len(labels)-1]
+}
+
+// placement is where a _for-sale name sits relative to the registry
+// boundaries of the Public Suffix List, with the matching row of the
+// draft's placement table.
+type placement struct {
+	Class             string `json:"class"` // "public_suffix", "registrable" or "subdomain"
+	PublicSuffix      string `json:"public_suffix"`
+	RegistrableDomain string `json:"registrable_domain,omitempty"`
+	Note              string `json:"note"`
+}
+
+// classifyPlacement classifies domain, the name the _for-sale label is
+// placed under.
+func (l *publicSuffixList) classifyPlacement(domain string) placement {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	suffix := l.publicSuffix(domain)
+	p := placement{PublicSuffix: suffix}
+	switch {
+	case domain == suffix:
+		p.Class = "public_suffix"
+		p.Note = "the name is a public suffix, administered by a registry itself: for sale"
+	case strings.Count(domain, ".") == strings.Count(suffix, ".")+1:
+		p.Class = "registrable"
+		p.RegistrableDomain = domain
+		p.Note = "registrable domain with a public registry: for sale"
+	default:
+		p.Class = "subdomain"
+		labels := strings.Split(domain, ".")
+		p.RegistrableDomain = strings.Join(labels[len(labels)-strings.Count(suffix, ".")-2:], ".")
+		p.Note = "subdomain of " + p.RegistrableDomain + ", without a public registry to record the rights to it " +
+			"(draft placement note 1): not a violation, but the parties need their own agreement"
+	}
+	return p
+}
+
+// isPublished reports whether the _for-sale RRset of domain contains a
+// record with the given content. Confirmation pages use it so they cannot be
+// abused to vouch for arbitrary destinations.
+func isPublished(ctx context.Context, domain, content string) (bool, error) {
+	if _, ok := lookupSpecialUse(domain); ok {
+		return false, nil
+	}
+	res, err := lookupTXT(ctx, "_for-sale."+domain)
+	if errors.Is(err, errBusy) {
+		return false, err
+	}
+	if err != nil {
+		return false, nil
+	}
+	for _, txt := range res.txts {
+		if strings.HasPrefix(txt, "v=FORSALE1;") && strings.TrimLeft(strings.TrimPrefix(txt, "v=FORSALE1;"), " ") == content {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// furiConfirmHandler is the interstitial page shown before following a furi
+// link. It re-checks the URI against the policies and shows the Unicode
+// security findings, so the user can make an informed decision.
+func furiConfirmHandler(w http.ResponseWriter, r *http.Request) {
+	uri := r.URL.Query().Get("u")
+	domain := r.URL.Query().Get("d")
+	if uri == "" || domain == "" {
+		http.NotFound(w, r)
+		return
+	}
+	published, err := isPublished(r.Context(), domain, "furi="+uri)
+	if err != nil {
+		http.Error(w, "The service is busy, please try again later", http.StatusServiceUnavailable)
+		return
+	}
+	if !published {
+		http.NotFound(w, r)
+		return
+	}
+	linkable, reason := evaluateURI(uri)
+	if !linkable {
+		http.Error(w, "This URI is not linked: "+reason, http.StatusForbidden)
+		return
+	}
+	findings := checkUnicodeSecurity(uri)
+	if host := uriHost(uri); host != "" {
+		findings = append(findings, checkHostSecurity(host)...)
+	}
+
+	render(w, r, "go.html", struct {
+		Domain, URI, Reason string
+		Findings            []string
+	}{domain, uri, reason, findings})
+}
+
+// sanitizePolicy selects what problematic code points in ftxt are replaced
+// with, per the Robustness section of the draft.
+type sanitizePolicy int
+
+const (
+	sanitizeSpace       sanitizePolicy = iota // replace with SPACE (U+0020)
+	sanitizeReplacement                       // replace with REPLACEMENT CHARACTER (U+FFFD)
+)
+
+// parseSanitizePolicy maps the command-line names "space" and "fffd" to a policy.
+func parseSanitizePolicy(s string) (sanitizePolicy, error) {
+	switch s {
+	case "space":
+		return sanitizeSpace, nil
+	case "fffd":
+		return sanitizeReplacement, nil
+	}
+	return 0, fmt.Errorf("unknown sanitise policy %q (use space or fffd)", s)
+}
+
+// isAssignable reports whether r is in the "Unicode Assignables" subset of
+// RFC 9839 section 4.3. Unlike the RFC, TAB, LF and CR are excluded as well,
+// since the draft says they are best avoided.
+func isAssignable(r rune) bool {
+	switch {
+	case r <= 0x1F || r == 0x7F: // C0 controls and DEL
+		return false
+	case r >= 0x80 && r <= 0x9F: // C1 controls
+		return false
+	case r >= 0xD800 && r <= 0xDFFF: // surrogates
+		return false
+	case r >= 0xFDD0 && r <= 0xFDEF, r&0xFFFE == 0xFFFE: // noncharacters
+		return false
+	}
+	return r <= unicode.MaxRune
+}
+
+// sanitizeText converts s to Network Unicode (RFC 5198): invalid UTF-8 is
+// replaced by U+FFFD, the text is normalised to NFC, and code points outside
+// the RFC 9839 subset are replaced according to policy.
+func sanitizeText(s string, policy sanitizePolicy) string {
+	repl := ' '
+	if policy == sanitizeReplacement {
+		repl = utf8.RuneError
+	}
+	s = norm.NFC.String(strings.ToValidUTF8(s, "\uFFFD"))
+	return strings.Map(func(r rune) rune {
+		if !isAssignable(r) {
+			return repl
+		}
+		return r
+	}, s)
+}
+
+// displaySafe is sanitizeText plus replacement of bidirectional embedding,
+// override and isolate controls, which are valid text but can reorder the
+// surrounding page when shown in a browser or terminal.
+func displaySafe(s string, policy sanitizePolicy) string {
+	repl := ' '
+	if policy == sanitizeReplacement {
+		repl = utf8.RuneError
+	}
+	return strings.Map(func(r rune) rune {
+		if (r >= 0x202A && r <= 0x202E) || (r >= 0x2066 && r <= 0x2069) {
+			return repl
+		}
+		return r
+	}, sanitizeText(s, policy))
+}
+
+// confusables maps code points to their UTS #39 prototype. Only a few common
+// look-alikes of Latin letters are built in; load the full confusables.txt
+// from unicode.org with loadConfusables for complete coverage.
+var confusables = map[rune]string{
+	'а': "a", 'в': "B", 'е': "e", 'к': "k", 'м': "M", 'н': "H", 'о': "o", 'р': "p",
+	'с': "c", 'т': "T", 'у': "y", 'х': "x", 'ѕ': "s", 'і': "i", 'ј': "j", 'һ': "h",
+	'ԁ': "d", 'ɡ': "g", 'ӏ': "l", 'ο': "o", 'α': "a", 'ν': "v", 'ρ': "p", 'ι': "i", 'κ': "k",
+	'τ': "t", 'υ': "u", 'χ': "x", 'ε': "e", 'ı': "i", 'ℓ': "l", '0': "O", '1': "l",
+}
+
+// protectedBrands maps the skeleton of each protected name to the name itself.
+var protectedBrands = map[string]string{}
+
+// loadConfusables reads confusables.txt (UTS #39 format: "0430 ;\t0061 ;\tMA\t# ...")
+// and adds its mappings to the built-in table.
+func loadConfusables(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	for n, line := range strings.Split(string(data), "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Split(line, ";")
+		if len(fields) < 2 {
+			continue
+		}
+		src, err := parseCodePoints(fields[0])
+		if err != nil || len(src) != 1 {
+			return fmt.Errorf("%s:%d: bad source code point", path, n+1)
+		}
+		dst, err := parseCodePoints(fields[1])
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", path, n+1, err)
+		}
+		confusables[src[0]] = string(dst)
+	}
+	return nil
+}
+
+// parseCodePoints parses space-separated hexadecimal code points.
+func parseCodePoints(s string) ([]rune, error) {
+	var out []rune
+	for _, f := range strings.Fields(s) {
+		v, err := strconv.ParseUint(f, 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("bad code point %q", f)
+		}
+		out = append(out, rune(v))
+	}
+	return out, nil
+}
+
+// loadBrands reads one protected name per line; empty lines and lines
+// starting with '#' are skipped.
+func loadBrands(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		protectedBrands[skeleton(line)] = line
+	}
+	return nil
+}
+
+// skeleton computes a UTS #39 style skeleton: the string is case-folded and
+// each code point is replaced by its prototype. Unlike UTS #39 no NFD
+// normalisation is done, so precomposed and decomposed forms may differ.
+func skeleton(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if p, ok := confusables[r]; ok {
+			b.WriteString(strings.ToLower(p))
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// checkUnicodeSecurity flags invisible characters that can be used to make
+// text look different from what it is: bidirectional formatting characters
+// (Trojan Source style reordering) and zero-width characters.
+func checkUnicodeSecurity(s string) (warnings []string) {
+	for i, r := range s {
+		switch {
+		case r >= 0x202A && r <= 0x202E, r >= 0x2066 && r <= 0x2069:
+			warnings = append(warnings, fmt.Sprintf("contains bidirectional override/isolate U+%04X at byte index %d; it can reorder how the text is displayed", r, i))
+		case r == 0x200E || r == 0x200F || r == 0x061C:
+			warnings = append(warnings, fmt.Sprintf("contains bidirectional mark U+%04X at byte index %d", r, i))
+		case r == 0x200B || r == 0x200C || r == 0x200D || r == 0x2060 || r == 0xFEFF:
+			warnings = append(warnings, fmt.Sprintf("contains zero-width character U+%04X at byte index %d; it is invisible when displayed", r, i))
+		}
+	}
+	return
+}
+
+// checkHostSecurity looks for homograph attacks in a host name: labels that
+// mix scripts, and names whose skeleton matches a protected brand without
+// being that brand. A-labels (xn--) are decoded first.
+func checkHostSecurity(host string) (warnings []string) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	labels := strings.Split(host, ".")
+	ulabels := make([]string, len(labels))
+	for i, l := range labels {
+		ulabels[i] = l
+		if strings.HasPrefix(l, "xn--") {
+			u, err := idna.Punycode.ToUnicode(l)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("host label %q is not valid Punycode: %v", l, err))
+				continue
+			}
+			ulabels[i] = u
+		}
+		if scripts := labelScripts(ulabels[i]); !allowedScriptMix(scripts) {
+			warnings = append(warnings, fmt.Sprintf("host label %q mixes scripts (%s); this is a common homograph technique", ulabels[i], strings.Join(scripts, ", ")))
+		}
+	}
+	if len(protectedBrands) == 0 {
+		return
+	}
+	// compare the full host and every label against the protected names
+	candidates := append([]string{strings.Join(ulabels, ".")}, ulabels...)
+	for _, c := range candidates {
+		if brand, ok := protectedBrands[skeleton(c)]; ok && c != strings.ToLower(brand) {
+			warnings = append(warnings, fmt.Sprintf("host %q is confusable with protected name %q", strings.Join(ulabels, "."), brand))
+			break
+		}
+	}
+	return
+}
+
+// labelScripts returns the sorted names of the scripts used in s, ignoring
+// Common and Inherited characters such as digits and hyphens.
+func labelScripts(s string) []string {
+	seen := map[string]bool{}
+	for _, r := range s {
+		for name, table := range unicode.Scripts {
+			if name == "Common" || name == "Inherited" {
+				continue
+			}
+			if unicode.Is(table, r) {
+				seen[name] = true
+				break
+			}
+		}
+	}
+	out := make([]string, 0, len(seen))
+	for name := range seen {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// allowedScriptMix implements the "Highly Restrictive" profile of UTS #39:
+// a single script, or Latin combined with one of the usual CJK sets.
+func allowedScriptMix(scripts []string) bool {
+	if len(scripts) <= 1 {
+		return true
+	}
+	for _, set := range [][]string{
+		{"Latin", "Han", "Hiragana", "Katakana"},
+		{"Latin", "Han", "Bopomofo"},
+		{"Latin", "Han", "Hangul"},
+	} {
+		ok := true
+		for _, s := range scripts {
+			if !slices.Contains(set, s) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// uriHost returns the host of an http(s) URI or the domain of a mailto URI,
+// or "" if there is none.
+func uriHost(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return ""
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return u.Hostname()
+	case "mailto":
+		addr := u.Opaque
+		if addr == "" {
+			addr = u.Path
+		}
+		if i := strings.LastIndexByte(addr, '@'); i >= 0 {
+			return strings.SplitN(addr[i+1:], ",", 2)[0]
+		}
+	}
+	return ""
 }
@@ -0,0 +1,581 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestFcodStorePrefixAddedLater(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fcod-store.json")
+	write := func(data string, mod time.Time) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`[{"code": "EXCO-1", "prefix": "EXCO", "url": "https://exco.example/"}]`, time.Now().Add(-time.Hour))
+
+	defer func(h map[string]FcodHandler, s *fcodStore) { fcodHandlers, fcodStoreAll = h, s }(fcodHandlers, fcodStoreAll)
+	fcodHandlers = map[string]FcodHandler{}
+	fcodStoreAll = &fcodStore{path: path}
+
+	if action, ok, err := interpretFcod("EXCO-1"); !ok || err != nil || action.LandingPage != "https://exco.example/" {
+		t.Fatalf("EXCO-1: got %+v, %v, %v", action, ok, err)
+	}
+	if _, ok, _ := interpretFcod("XYZ1-1"); ok {
+		t.Fatal("XYZ1-1 recognised before its prefix is in the store")
+	}
+	write(`[{"code": "EXCO-1", "prefix": "EXCO", "url": "https://exco.example/"},
+		{"code": "XYZ1-1", "prefix": "XYZ1", "url": "https://xyz.example/"}]`, time.Now())
+	if action, ok, err := interpretFcod("XYZ1-1"); !ok || err != nil || action.LandingPage != "https://xyz.example/" {
+		t.Fatalf("XYZ1-1 after adding it to the store: got %+v, %v, %v", action, ok, err)
+	}
+}
+
+func TestRegisterFcodHandlerDuplicate(t *testing.T) {
+	defer func(h map[string]FcodHandler) { fcodHandlers = h }(fcodHandlers)
+	fcodHandlers = map[string]FcodHandler{}
+
+	if err := registerFcodHandler(base64FcodHandler{prefix: "EXCO"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := registerFcodHandler(storeFcodHandler{prefix: "EXCO"}); err == nil {
+		t.Fatal("second handler for EXCO accepted")
+	}
+}
+
+func TestBase64FcodHandler(t *testing.T) {
+	tests := []struct {
+		value, want string
+		wantErr     bool
+	}{
+		{"EXCO-S2lscm95IHdhcyBoZXJl", `payload "Kilroy was here"`, false},
+		{"EXCO-aHR0cHM6Ly9zYWxlcy5leGFtcGxlL2V4Y28/eD0xPg==", `payload "https://sales.example/exco?x=1>"`, false},
+		{"EXCO-aHR0cHM6Ly9zYWxlcy5leGFtcGxlL2V4Y28_eD0xPg", "", true},
+		{"EXCO-/w==", "1 octets of binary data", false},
+		{"EXCO-not base64!", "", true},
+	}
+	h := base64FcodHandler{prefix: "EXCO"}
+	for _, tt := range tests {
+		action, err := h.Interpret(tt.value)
+		if (err != nil) != tt.wantErr || action.Description != tt.want {
+			t.Errorf("Interpret(%q) = %q, %v; want %q, error %v", tt.value, action.Description, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestLoggedQuery(t *testing.T) {
+	tests := []struct{ target, want string }{
+		{"/check?domain=example.nl&lang=nl", "domain=REDACTED&lang=nl"},
+		{"/go?u=https%3A%2F%2Fsales.example%2F&d=example.nl", "d=REDACTED&u=REDACTED"},
+		{"/fcod?code=EXCO-1&d=example.nl", "code=REDACTED&d=REDACTED"},
+		{"/widget.js", ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		if got := loggedQuery(r); got != tt.want {
+			t.Errorf("loggedQuery(%s) = %q, want %q", tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestNewPoWChallengeBits(t *testing.T) {
+	for _, bits := range []int{-1, 0, maxPoWBits + 1, 300} {
+		if _, err := newPoWChallenge(bits); err == nil {
+			t.Errorf("newPoWChallenge(%d) accepted", bits)
+		}
+	}
+	for _, bits := range []int{1, maxPoWBits} {
+		if _, err := newPoWChallenge(bits); err != nil {
+			t.Errorf("newPoWChallenge(%d): %v", bits, err)
+		}
+	}
+}
+
+func TestPoWChallenge(t *testing.T) {
+	p, err := newPoWChallenge(8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := p.nonce("ip:192.0.2.1", time.Now().Unix())
+	solve := func(nonce string) string {
+		for c := 0; ; c++ {
+			sol := fmt.Sprintf("%s:%d", nonce, c)
+			if sum := sha256.Sum256([]byte(sol)); sum[0] == 0 {
+				return sol
+			}
+		}
+	}
+	verify := func(sol, client string) bool {
+		r := httptest.NewRequest(http.MethodGet, "/check", nil)
+		r.Header.Set("X-PoW-Solution", sol)
+		return p.Verify(r, client)
+	}
+
+	sol := solve(nonce)
+	if verify(sol, "ip:192.0.2.2") {
+		t.Error("solution accepted for another client")
+	}
+	if !verify(sol, "ip:192.0.2.1") {
+		t.Error("solution rejected")
+	}
+	if verify(sol, "ip:192.0.2.1") {
+		t.Error("solution accepted twice")
+	}
+	if verify(solve(p.nonce("ip:192.0.2.1", time.Now().Add(-2*powValidity).Unix())), "ip:192.0.2.1") {
+		t.Error("expired nonce accepted")
+	}
+	fresh := p.nonce("ip:192.0.2.1", time.Now().Unix()-1)
+	for c := 0; ; c++ {
+		sol := fmt.Sprintf("%s:%d", fresh, c)
+		if sum := sha256.Sum256([]byte(sol)); sum[0] != 0 {
+			if verify(sol, "ip:192.0.2.1") {
+				t.Error("wrong solution accepted")
+			}
+			break
+		}
+	}
+}
+
+func TestAPIKeysRateLimitedByKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(path, []byte(`[{"key": "k1", "name": "acme", "rate": 1, "burst": 1},
+		{"key": "k2", "name": "acme", "rate": 1, "burst": 1}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := loadAPIKeys(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := &abuseGuard{clients: newRateLimiter(1, 1), keys: keys}
+	handler := g.wrap(func(w http.ResponseWriter, r *http.Request) {})
+	status := func(key string) int {
+		r := httptest.NewRequest(http.MethodGet, "/check", nil)
+		r.Header.Set("X-API-Key", key)
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Code
+	}
+	if s := status("k1"); s != http.StatusOK {
+		t.Errorf("k1: status %d", s)
+	}
+	if s := status("k1"); s != http.StatusTooManyRequests {
+		t.Errorf("k1 over its burst: status %d", s)
+	}
+	// same name, different key: its own quota
+	if s := status("k2"); s != http.StatusOK {
+		t.Errorf("k2: status %d", s)
+	}
+
+	if err := os.WriteFile(path, []byte(`[{"key": "k1", "name": "a", "rate": 1, "burst": 1},
+		{"key": "k1", "name": "b", "rate": 5, "burst": 5}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadAPIKeys(path); err == nil {
+		t.Error("duplicate key accepted")
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	b := newTokenBucket(2, 3)
+	now := b.last
+	for i := 0; i < 3; i++ {
+		if ok, _ := b.take(now); !ok {
+			t.Fatalf("take %d of the burst failed", i+1)
+		}
+	}
+	ok, wait := b.take(now)
+	if ok || wait != 500*time.Millisecond {
+		t.Errorf("take over the burst = %v, %v; want false, 500ms", ok, wait)
+	}
+	if ok, _ := b.take(now.Add(500 * time.Millisecond)); !ok {
+		t.Error("no token after refill")
+	}
+}
+
+func TestMetricsEscaping(t *testing.T) {
+	c := newCounterVec("test_total", "Help with \\ and\nnewline.", "l")
+	c.inc(`a"b\c` + "\nd")
+	h := newHistogramVec("test_seconds", "Latency.", "resolver", []float64{1})
+	h.observe("[2001:db8::53]:53", 0.5)
+
+	var b strings.Builder
+	c.write(&b)
+	h.write(&b)
+	want := `# HELP test_total Help with \\ and\nnewline.
+# TYPE test_total counter
+test_total{l="a\"b\\c\nd"} 1
+# HELP test_seconds Latency.
+# TYPE test_seconds histogram
+test_seconds_bucket{resolver="[2001:db8::53]:53",le="1"} 1
+test_seconds_bucket{resolver="[2001:db8::53]:53",le="+Inf"} 1
+test_seconds_sum{resolver="[2001:db8::53]:53"} 0.5
+test_seconds_count{resolver="[2001:db8::53]:53"} 1
+`
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestTXTStrings(t *testing.T) {
+	rr, err := dns.NewRR(`_for-sale.example.nl. 60 IN TXT "v=FORSALE1;ftxt=say \"hi\"" "H\195\169 " "a\;b" ""`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := txtStrings(rr.(*dns.TXT))
+	want := []string{`v=FORSALE1;ftxt=say "hi"`, "Hé ", "a;b", ""}
+	if err != nil || !slices.Equal(got, want) {
+		t.Errorf("txtStrings = %q, %v; want %q", got, err, want)
+	}
+}
+
+func TestRegistrationCache(t *testing.T) {
+	var none *registrationCache
+	none.put("example.nl", &registrationInfo{})
+	if _, ok := none.get("example.nl"); ok {
+		t.Error("disabled cache returned an entry")
+	}
+
+	c := &registrationCache{ttl: time.Minute, max: 1, entries: map[string]registrationCacheEntry{}}
+	info := &registrationInfo{Source: "rdap"}
+	c.put("Example.NL", info)
+	if got, ok := c.get("example.nl"); !ok || got != info {
+		t.Errorf("get = %v, %v; want the cached entry", got, ok)
+	}
+	c.put("other.nl", info) // full
+	if _, ok := c.get("other.nl"); ok {
+		t.Error("entry added beyond the maximum")
+	}
+	c.entries["example.nl"] = registrationCacheEntry{info: info, expires: time.Now().Add(-time.Second)}
+	if _, ok := c.get("example.nl"); ok {
+		t.Error("expired entry returned")
+	}
+}
+
+// stubTXT serves the given _for-sale RRsets from the TXT cache, so handlers
+// can be tested without DNS.
+func stubTXT(t *testing.T, rrsets map[string][]string) {
+	t.Helper()
+	defer func(c *txtCache) { t.Cleanup(func() { cache = c }) }(cache)
+	cache = &txtCache{ttl: time.Hour, max: 100, entries: map[string]txtCacheEntry{}}
+	for name, txts := range rrsets {
+		cache.entries[name] = txtCacheEntry{txts: txts, expires: time.Now().Add(time.Hour)}
+	}
+}
+
+func TestFcodConfirmHandler(t *testing.T) {
+	defer func(h map[string]FcodHandler) { fcodHandlers = h }(fcodHandlers)
+	fcodHandlers = map[string]FcodHandler{}
+	path := filepath.Join(t.TempDir(), "fcod-store.json")
+	if err := os.WriteFile(path, []byte(`[{"code": "EXCO-1", "prefix": "EXCO", "url": "https://exco.example/sale"},
+		{"code": "EXCO-2", "prefix": "EXCO", "url": "https://exco.example/other"}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := registerFcodHandler(storeFcodHandler{prefix: "EXCO", store: &fcodStore{path: path}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		status int
+		want   string
+	}{
+		{"published", "code=EXCO-1&d=example.nl", http.StatusOK, "https://exco.example/sale?d=example.nl"},
+		{"in the store, not published", "code=EXCO-2&d=example.nl", http.StatusNotFound, ""},
+		{"published, not in the store", "code=EXCO-3&d=example.nl", http.StatusNotFound, ""},
+		{"published for another domain", "code=EXCO-1&d=example.org", http.StatusNotFound, ""},
+		{"no domain", "code=EXCO-1", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubTXT(t, map[string][]string{
+				"_for-sale.example.nl":  {"v=FORSALE1;fcod=EXCO-1", "v=FORSALE1; fcod=EXCO-3"},
+				"_for-sale.example.org": {"v=FORSALE1;ftxt=EXCO-1"},
+			})
+			rec := httptest.NewRecorder()
+			fcodConfirmHandler(rec, httptest.NewRequest("GET", "/fcod?"+tt.query, nil))
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d", rec.Code, tt.status)
+			}
+			if body := rec.Body.String(); !strings.Contains(body, tt.want) {
+				t.Errorf("body does not contain %q:\n%s", tt.want, body)
+			}
+		})
+	}
+}
+
+// sharedDecls are copied from fs-check-new.go and must stay the same; their
+// tests are in fs-check-new_test.go.
+var sharedDecls = []string{
+	"checkUnicodeSecurity", "checkHostSecurity", "confusables", "loadConfusables", "parseCodePoints",
+	"protectedBrands", "loadBrands", "skeleton", "labelScripts", "allowedScriptMix", "uriHost",
+	"psl", "publicSuffixList", "loadPublicSuffixList", "publicSuffixList.publicSuffix", "placement",
+	"publicSuffixList.classifyPlacement",
+	"specialUse", "specialUseNames", "builtinSpecialUse", "loadSpecialUseNames", "addSpecialUseNames",
+	"lookupSpecialUse", "specialUse.String",
+	"sanitizePolicy", "parseSanitizePolicy", "isAssignable", "sanitizeText", "displaySafe",
+	"registrationInfo", "contact", "registrationTimeout", "loadRDAPBootstrap", "rdapBaseURL",
+	"lookupRegistration", "rdapEntity", "lookupRDAP", "vcardContact", "whoisQuery", "lookupWHOIS", "parseWHOIS",
+	"unreliableStatuses", "unreliableRegistryStatus",
+}
+
+// decls returns the source of the top-level declarations in path by name;
+// methods are named type.method.
+func decls(t *testing.T, path string) map[string]string {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := map[string]string{}
+	for _, d := range f.Decls {
+		var name string
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			name = d.Name.Name
+			if d.Recv != nil {
+				typ := d.Recv.List[0].Type
+				if star, ok := typ.(*ast.StarExpr); ok {
+					typ = star.X
+				}
+				name = typ.(*ast.Ident).Name + "." + name
+			}
+		case *ast.GenDecl:
+			switch s := d.Specs[0].(type) {
+			case *ast.TypeSpec:
+				name = s.Name.Name
+			case *ast.ValueSpec:
+				name = s.Names[0].Name
+			}
+		}
+		var buf bytes.Buffer
+		printer.Fprint(&buf, fset, d)
+		m[name] = buf.String()
+	}
+	return m
+}
+
+func TestInSyncWithFsCheckNew(t *testing.T) {
+	if _, err := os.Stat("fs-check-new.go"); err != nil {
+		t.Skip("fs-check-new.go not next to the test: ", err)
+	}
+	web, check := decls(t, "webserver.go"), decls(t, "fs-check-new.go")
+	for _, name := range sharedDecls {
+		switch {
+		case web[name] == "":
+			t.Errorf("%s is missing from webserver.go", name)
+		case web[name] != check[name]:
+			t.Errorf("%s differs between webserver.go and fs-check-new.go", name)
+		}
+	}
+}
+
+func TestURLExpressions(t *testing.T) {
+	tests := []struct {
+		uri  string
+		want []string
+	}{
+		{"http://a.b.c/1/2.html?param=1", []string{
+			"a.b.c/1/2.html?param=1", "a.b.c/1/2.html", "a.b.c/", "a.b.c/1/",
+			"b.c/1/2.html?param=1", "b.c/1/2.html", "b.c/", "b.c/1/",
+		}},
+		{"http://a.b.c.d.e.f.g/1.html", []string{
+			"a.b.c.d.e.f.g/1.html", "a.b.c.d.e.f.g/", "c.d.e.f.g/1.html", "c.d.e.f.g/",
+			"d.e.f.g/1.html", "d.e.f.g/", "e.f.g/1.html", "e.f.g/", "f.g/1.html", "f.g/",
+		}},
+		{"https://1.2.3.4/1/", []string{"1.2.3.4/1/", "1.2.3.4/"}},
+		{"https://Example.COM.", []string{"example.com/"}},
+		{"https://a.b/1/2/3/4/5/6", []string{"a.b/1/2/3/4/5/6", "a.b/", "a.b/1/", "a.b/1/2/", "a.b/1/2/3/"}},
+		{"mailto:sales@example.com", nil},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := urlExpressions(u); !slices.Equal(got, tt.want) {
+			t.Errorf("urlExpressions(%s) = %q, want %q", tt.uri, got, tt.want)
+		}
+	}
+}
+
+// testURIPolicies registers the policies of a hash list, an allowlist and a
+// denylist as the server does, and restores the defaults after the test.
+func testURIPolicies(t *testing.T) {
+	t.Helper()
+	defer func(p []URIPolicy) { t.Cleanup(func() { uriPolicies = p }) }(uriPolicies)
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	evil := sha256.Sum256([]byte("evil.good.example/"))
+	shop := sha256.Sum256([]byte("bad.example/shop/"))
+	hashes := write("hashes", fmt.Sprintf("# threat list\n%x\n%x\n", evil[:4], shop[:32]))
+	allow := write("allow", "good.example\n")
+	deny := write("deny", "# local denylist\nbad.example\nsub.good.example\nftp:\n")
+	if err := loadURIPolicies(hashes, allow, deny); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEvaluateURI(t *testing.T) {
+	testURIPolicies(t)
+	tests := []struct {
+		uri      string
+		linkable bool
+		reason   string
+	}{
+		{"https://example.com/", true, ""},
+		{"mailto:sales@example.com", true, ""},
+		{"tel:+31701234567", true, ""},
+		{"javascript:alert(1)", false, "javascript: URIs are never linked"},
+		{"JavaScript:alert(1)", false, "javascript: URIs are never linked"},
+		{"data:text/html,<script>alert(1)</script>", false, "data: URIs are never linked"},
+		{"ftp://files.example/", false, `scheme "ftp" is not recommended`},
+		// subdomains match, other names ending in the same text do not
+		{"https://good.example/", true, "good.example is on the allowlist"},
+		{"https://www.Good.Example./", true, "good.example is on the allowlist"},
+		{"https://notgood.example/", true, ""},
+		{"https://bad.example/", false, "bad.example is on the denylist"},
+		{"https://a.b.bad.example/", false, "bad.example is on the denylist"},
+		{"https://notbad.example/", true, ""},
+		// the allowlist overrides the denylist
+		{"https://sub.good.example/", true, "good.example is on the allowlist"},
+		// but not the threat list
+		{"https://evil.good.example/", false, "evil.good.example/ is on the local threat list"},
+		{"https://x.evil.good.example/login", false, "evil.good.example/ is on the local threat list"},
+		{"https://bad.example/shop/cart?id=1", false, "bad.example/shop/ is on the local threat list"},
+		{"https://%zz", false, "not a valid URI"},
+	}
+	for _, tt := range tests {
+		linkable, reason := evaluateURI(tt.uri)
+		if linkable != tt.linkable || !strings.Contains(reason, tt.reason) || tt.reason == "" && reason != "" {
+			t.Errorf("evaluateURI(%q) = %v, %q; want %v, %q", tt.uri, linkable, reason, tt.linkable, tt.reason)
+		}
+	}
+}
+
+func TestLoadHashPrefixPolicy(t *testing.T) {
+	for _, data := range []string{"0011\n", "zz112233\n", strings.Repeat("00", 33) + "\n"} {
+		path := filepath.Join(t.TempDir(), "hashes")
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadHashPrefixPolicy(path); err == nil {
+			t.Errorf("hash list %q accepted", data)
+		}
+	}
+}
+
+func TestFuriConfirmHandler(t *testing.T) {
+	testURIPolicies(t)
+	stubTXT(t, map[string][]string{
+		"_for-sale.example.nl": {
+			"v=FORSALE1;furi=https://good.example/sale",
+			"v=FORSALE1;furi=javascript:alert(1)",
+			"v=FORSALE1;furi=https://evil.good.example/",
+		},
+	})
+	tests := []struct {
+		name   string
+		uri    string
+		status int
+		want   string
+	}{
+		{"published", "https://good.example/sale", http.StatusOK, "https://good.example/sale"},
+		{"not published", "https://good.example/other", http.StatusNotFound, ""},
+		{"published, blocked scheme", "javascript:alert(1)", http.StatusForbidden, "never linked"},
+		{"published, allowlisted but hash-listed", "https://evil.good.example/", http.StatusForbidden, "local threat list"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		target := "/go?" + url.Values{"u": {tt.uri}, "d": {"example.nl"}}.Encode()
+		furiConfirmHandler(rec, httptest.NewRequest("GET", target, nil))
+		if rec.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, rec.Code, tt.status)
+		}
+		if body := rec.Body.String(); !strings.Contains(body, tt.want) {
+			t.Errorf("%s: body does not contain %q:\n%s", tt.name, tt.want, body)
+		}
+	}
+}
+
+func TestFormatPrice(t *testing.T) {
+	tests := []struct {
+		lang, fval, want string
+	}{
+		{"nl", "EUR999", "€ 999,00"},
+		{"en", "EUR999", "€999.00"},
+		{"nl", "EUR1234567.5", "€ 1.234.567,50"},
+		{"en", "EUR1234567.5", "€1,234,567.50"},
+		{"en", "USD1000", "$1,000.00"},
+		{"en", "GBP100000", "£100,000.00"},
+		{"nl", "JPY1500000", "¥ 1.500.000"},
+		{"en", "EUR007", "€7.00"},
+		{"en", "EUR0.125", "€0.125"},
+		{"nl", "CHF250", "CHF 250,00"},
+		{"en", "BTC0.5", "BTC 0.5"},
+		{"nl", "XYZ1000", "XYZ 1.000"},
+		{"en", "EUR", "EUR"},
+		{"en", "eur5", "eur5"},
+		{"en", "EUR1.2.3", "EUR1.2.3"},
+		{"en", "EUR.5", "EUR.5"},
+	}
+	for _, tt := range tests {
+		if got := formatPrice(tt.lang, tt.fval); got != tt.want {
+			t.Errorf("formatPrice(%q, %q) = %q, want %q", tt.lang, tt.fval, got, tt.want)
+		}
+	}
+}
+
+func TestRequestLang(t *testing.T) {
+	tests := []struct {
+		name, query, cookie, accept, want string
+	}{
+		{"default", "", "", "", "en"},
+		{"Accept-Language", "", "", "nl-NL,nl;q=0.9,en;q=0.8", "nl"},
+		{"Accept-Language, lower preference", "", "", "fr, nl;q=0.5", "nl"},
+		{"Accept-Language, unsupported", "", "", "de-DE", "en"},
+		{"cookie over Accept-Language", "", "nl", "en-GB", "nl"},
+		{"query over cookie", "lang=en", "nl", "nl", "en"},
+		{"query over Accept-Language", "lang=nl", "", "en", "nl"},
+		{"unknown query, cookie", "lang=de", "nl", "en", "nl"},
+		{"unknown cookie, Accept-Language", "", "de", "nl", "nl"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/?"+tt.query, nil)
+		if tt.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: "lang", Value: tt.cookie})
+		}
+		if tt.accept != "" {
+			r.Header.Set("Accept-Language", tt.accept)
+		}
+		if got := requestLang(r); got != tt.want {
+			t.Errorf("%s: requestLang = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}